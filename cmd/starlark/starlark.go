@@ -11,28 +11,44 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"sort"
 	"strings"
 
 	"go.starlark.net/repl"
-	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 )
 
 // flags
 var (
 	cpuprofile = flag.String("cpuprofile", "", "gather CPU profile in this file")
 	showenv    = flag.Bool("showenv", false, "on success, print final global environment")
+	checktypes = flag.Bool("checktypes", false, "check calls against built-in type annotations")
+	pragmas    = flag.Bool("pragmas", true, "allow files to enable dialect features with a '# starlark:' comment")
+	history    = flag.String("history", defaultHistory(), "save REPL input history in this file (if non-empty)")
 )
 
+// defaultHistory returns the default name of the REPL history file.
+func defaultHistory() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".starlark_history")
+	}
+	return ""
+}
+
 // non-standard dialect flags
+var opts syntax.FileOptions
+
 func init() {
-	flag.BoolVar(&resolve.AllowFloat, "fp", resolve.AllowFloat, "allow floating-point numbers")
-	flag.BoolVar(&resolve.AllowSet, "set", resolve.AllowSet, "allow set data type")
-	flag.BoolVar(&resolve.AllowLambda, "lambda", resolve.AllowLambda, "allow lambda expressions")
-	flag.BoolVar(&resolve.AllowNestedDef, "nesteddef", resolve.AllowNestedDef, "allow nested def statements")
-	flag.BoolVar(&resolve.AllowBitwise, "bitwise", resolve.AllowBitwise, "allow bitwise operations (&, |, ^, ~, <<, and >>)")
+	flag.BoolVar(&opts.Float, "fp", false, "allow floating-point numbers")
+	flag.BoolVar(&opts.Set, "set", false, "allow set data type")
+	flag.BoolVar(&opts.Lambda, "lambda", false, "allow lambda expressions")
+	flag.BoolVar(&opts.NestedDef, "nesteddef", false, "allow nested def statements")
+	flag.BoolVar(&opts.Bitwise, "bitwise", false, "allow bitwise operations (&, |, ^, ~, <<, and >>)")
+	flag.BoolVar(&opts.FString, "fstring", false, "allow f-string literals")
+	flag.BoolVar(&opts.Types, "types", false, "allow type annotations")
 }
 
 func main() {
@@ -40,6 +56,10 @@ func main() {
 	log.SetFlags(0)
 	flag.Parse()
 
+	if *pragmas {
+		opts.Permitted = syntax.AllFeatures()
+	}
+
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -51,18 +71,19 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	thread := &starlark.Thread{Load: repl.MakeLoad()}
+	thread := &starlark.Thread{Load: repl.MakeLoadOptions(&opts), CheckTypes: *checktypes}
 	globals := make(starlark.StringDict)
 
 	switch len(flag.Args()) {
 	case 0:
 		fmt.Println("Welcome to Starlark (go.starlark.net)")
-		repl.REPL(thread, globals)
+		cfg := &repl.Config{Options: &opts, HistoryFile: *history}
+		cfg.Run(thread, globals)
 	case 1:
 		// Execute specified file.
 		filename := flag.Args()[0]
 		var err error
-		globals, err = starlark.ExecFile(thread, filename, nil, nil)
+		globals, err = starlark.ExecFileOptions(&opts, thread, filename, nil, nil)
 		if err != nil {
 			repl.PrintError(err)
 			os.Exit(1)
@@ -0,0 +1,148 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The starlarkcheck command reports likely type errors in Starlark files
+// without executing them. See package go.starlark.net/typecheck.
+//
+// Usage:
+//
+// 	starlarkcheck [flags] file.star ...
+//
+// As in the starlark command, the name of a loaded module
+// is the name of its file, relative to the current directory.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"go.starlark.net/typecheck"
+)
+
+// flags
+var (
+	globals = flag.Bool("globals", false, "print the inferred type of each global variable")
+	pragmas = flag.Bool("pragmas", true, "allow files to enable dialect features with a '# starlark:' comment")
+)
+
+// non-standard dialect flags
+var opts syntax.FileOptions
+
+func init() {
+	flag.BoolVar(&opts.Float, "fp", false, "allow floating-point numbers")
+	flag.BoolVar(&opts.Set, "set", false, "allow set data type")
+	flag.BoolVar(&opts.Lambda, "lambda", false, "allow lambda expressions")
+	flag.BoolVar(&opts.NestedDef, "nesteddef", false, "allow nested def statements")
+	flag.BoolVar(&opts.Bitwise, "bitwise", false, "allow bitwise operations (&, |, ^, ~, <<, and >>)")
+	flag.BoolVar(&opts.FString, "fstring", false, "allow f-string literals")
+	flag.BoolVar(&opts.Types, "types", false, "allow type annotations")
+}
+
+func main() {
+	log.SetPrefix("starlarkcheck: ")
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: starlarkcheck [flags] file.star ...")
+	}
+	if *pragmas {
+		opts.Permitted = syntax.AllFeatures()
+	}
+
+	ok := true
+	for _, filename := range flag.Args() {
+		info, errors, err := check(filename)
+		if err != nil {
+			printErrors(err)
+			ok = false
+			continue
+		}
+		for _, err := range errors {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+		}
+		if *globals {
+			var names []string
+			for name := range info.Globals {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s: %s: %s\n", filename, name, info.Globals[name])
+			}
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+type entry struct {
+	info   *typecheck.Info
+	errors []typecheck.Error
+	err    error
+}
+
+// cache holds the result of checking each file,
+// or nil if checking is in progress.
+var cache = make(map[string]*entry)
+
+// check parses, resolves, and checks the named file,
+// and (recursively) the modules it loads.
+// It returns an error if the file could not be resolved.
+func check(filename string) (*typecheck.Info, []typecheck.Error, error) {
+	e, ok := cache[filename]
+	if e == nil {
+		if ok {
+			return nil, nil, fmt.Errorf("cycle in load graph")
+		}
+		cache[filename] = nil // load in progress
+		e = new(entry)
+		e.info, e.errors, e.err = check1(filename)
+		cache[filename] = e
+	}
+	return e.info, e.errors, e.err
+}
+
+func check1(filename string) (*typecheck.Info, []typecheck.Error, error) {
+	f, err := opts.Parse(filename, nil, syntax.RecoverErrors)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := resolve.File(f, func(string) bool { return false }, starlark.Universe.Has); err != nil {
+		return nil, nil, err
+	}
+	config := &typecheck.Config{
+		Load: func(module string) (map[string]typecheck.Type, error) {
+			info, _, err := check(module)
+			if err != nil {
+				return nil, err
+			}
+			return info.Globals, nil
+		},
+	}
+	info, errors := typecheck.File(f, config)
+	return info, errors, nil
+}
+
+func printErrors(err error) {
+	switch list := err.(type) {
+	case syntax.ErrorList:
+		for _, err := range list {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	case resolve.ErrorList:
+		for _, err := range list {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
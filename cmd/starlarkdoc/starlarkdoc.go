@@ -0,0 +1,84 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The starlarkdoc command prints reference documentation for Starlark
+// files, extracted from their docstrings. See package go.starlark.net/docgen.
+//
+// Usage:
+//
+// 	starlarkdoc [flags] file.star ...
+//
+// The documentation is printed as Markdown, or with the -html flag,
+// as an HTML fragment.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"go.starlark.net/docgen"
+	"go.starlark.net/syntax"
+)
+
+// flags
+var (
+	html    = flag.Bool("html", false, "print HTML instead of Markdown")
+	pragmas = flag.Bool("pragmas", true, "allow files to enable dialect features with a '# starlark:' comment")
+)
+
+// non-standard dialect flags
+var opts syntax.FileOptions
+
+func init() {
+	flag.BoolVar(&opts.Float, "fp", false, "allow floating-point numbers")
+	flag.BoolVar(&opts.Set, "set", false, "allow set data type")
+	flag.BoolVar(&opts.Lambda, "lambda", false, "allow lambda expressions")
+	flag.BoolVar(&opts.NestedDef, "nesteddef", false, "allow nested def statements")
+	flag.BoolVar(&opts.Bitwise, "bitwise", false, "allow bitwise operations (&, |, ^, ~, <<, and >>)")
+	flag.BoolVar(&opts.FString, "fstring", false, "allow f-string literals")
+	flag.BoolVar(&opts.Types, "types", false, "allow type annotations")
+}
+
+func main() {
+	log.SetPrefix("starlarkdoc: ")
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: starlarkdoc [flags] file.star ...")
+	}
+	if *pragmas {
+		opts.Permitted = syntax.AllFeatures()
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for i, filename := range flag.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f, err := opts.Parse(filename, src, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		m := docgen.File(f, src)
+		if *html {
+			err = m.WriteHTML(out)
+		} else {
+			err = m.WriteMarkdown(out)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The starlarklint command reports suspicious constructs in Starlark
+// files, such as unused loads and unreachable code.
+// See package go.starlark.net/lint.
+//
+// Usage:
+//
+// 	starlarklint [flags] file.star ...
+//
+// Each analyzer may be disabled by a flag of the same name, as in
+// -unusedlocal=false. With the -fix flag, starlarklint applies the
+// first suggested fix of each diagnostic, rewriting the file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"go.starlark.net/lint"
+	"go.starlark.net/refactor"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// flags
+var (
+	fix     = flag.Bool("fix", false, "apply suggested fixes")
+	pragmas = flag.Bool("pragmas", true, "allow files to enable dialect features with a '# starlark:' comment")
+)
+
+// non-standard dialect flags
+var opts syntax.FileOptions
+
+// enabled records which analyzers are enabled.
+var enabled = make(map[*lint.Analyzer]*bool)
+
+func init() {
+	flag.BoolVar(&opts.Float, "fp", false, "allow floating-point numbers")
+	flag.BoolVar(&opts.Set, "set", false, "allow set data type")
+	flag.BoolVar(&opts.Lambda, "lambda", false, "allow lambda expressions")
+	flag.BoolVar(&opts.NestedDef, "nesteddef", false, "allow nested def statements")
+	flag.BoolVar(&opts.Bitwise, "bitwise", false, "allow bitwise operations (&, |, ^, ~, <<, and >>)")
+	flag.BoolVar(&opts.FString, "fstring", false, "allow f-string literals")
+	flag.BoolVar(&opts.Types, "types", false, "allow type annotations")
+
+	for _, a := range lint.Analyzers {
+		enabled[a] = flag.Bool(a.Name, true, "enable "+a.Doc[:strings.IndexByte(a.Doc+"\n", '\n')]+" analysis")
+	}
+}
+
+func main() {
+	log.SetPrefix("starlarklint: ")
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: starlarklint [flags] file.star ...")
+	}
+	if *pragmas {
+		opts.Permitted = syntax.AllFeatures()
+	}
+
+	var analyzers []*lint.Analyzer
+	for _, a := range lint.Analyzers {
+		if *enabled[a] {
+			analyzers = append(analyzers, a)
+		}
+	}
+
+	ok := true
+	for _, filename := range flag.Args() {
+		if err := lintFile(filename, analyzers); err != nil {
+			printErrors(err)
+			ok = false
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// lintFile reports the diagnostics of the analyzers for the named file,
+// returning an error if the file could not be analyzed.
+func lintFile(filename string, analyzers []*lint.Analyzer) error {
+	f, err := opts.Parse(filename, nil, syntax.RecoverErrors|syntax.RetainTokens)
+	if err != nil {
+		return err
+	}
+	isPredeclared := func(string) bool { return false }
+	if err := resolve.File(f, isPredeclared, starlark.Universe.Has); err != nil {
+		return err
+	}
+
+	// Report each diagnostic, or apply its first suggested fix
+	// unless that conflicts with a fix already applied.
+	var edits []refactor.Edit
+	problems := 0
+	for _, d := range lint.Run(f, starlark.Universe.Has, analyzers) {
+		if *fix && len(d.SuggestedFixes) > 0 {
+			more := append(edits[:len(edits):len(edits)], d.SuggestedFixes[0].Edits...)
+			if _, err := refactor.Apply(f.Source(), more); err == nil {
+				edits = more
+				continue
+			}
+		}
+		fmt.Fprintln(os.Stderr, d)
+		problems++
+	}
+	if len(edits) > 0 {
+		src, err := refactor.Apply(f.Source(), edits)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, src, 0666); err != nil {
+			return err
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%s: %d problems", filename, problems)
+	}
+	return nil
+}
+
+func printErrors(err error) {
+	switch list := err.(type) {
+	case syntax.ErrorList:
+		for _, err := range list {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	case resolve.ErrorList:
+		for _, err := range list {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
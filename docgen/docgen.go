@@ -0,0 +1,204 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package docgen extracts the documentation of a Starlark module from its
+// syntax tree, and renders it as a reference page in Markdown or HTML.
+//
+// The documentation of a module consists of its docstring, the
+// signature and docstring of each of its public functions, and each
+// public global variable that has a docstring. A docstring is a string
+// literal that appears as the first statement of a file or def body,
+// or, for a global variable, as the statement immediately after its
+// assignment:
+//
+//	"""Utilities for frobnicating."""
+//
+//	MAX_DEPTH = 10
+//	"""The maximum depth of frobnication."""
+//
+//	def frob(x, depth = MAX_DEPTH):
+//	    """Returns x, frobnicated."""
+//	    ...
+//
+// Names beginning with an underscore are private and not documented.
+package docgen // import "go.starlark.net/docgen"
+
+import (
+	"bytes"
+	"strings"
+
+	"go.starlark.net/syntax"
+)
+
+// A Module is the documentation of a Starlark file.
+type Module struct {
+	Path    string    // name of the file
+	Doc     string    // module docstring
+	Funcs   []*Func   // public functions, in order of definition
+	Globals []*Global // documented public global variables, in order of definition
+}
+
+// A Func is the documentation of a function defined by a def statement.
+type Func struct {
+	Name   string
+	Pos    syntax.Position
+	Params []*Param
+	Result string // text of the result type annotation, or "" if none
+	Doc    string
+}
+
+// A Param is a parameter of a documented function.
+type Param struct {
+	Name    string
+	Prefix  string // "*" for *args, "**" for **kwargs, otherwise ""
+	Default string // text of the default value expression, or "" if none
+	Type    string // text of the type annotation, or "" if none
+}
+
+// A Global is the documentation of a global variable.
+type Global struct {
+	Name  string
+	Pos   syntax.Position
+	Value string // text of the assigned expression
+	Doc   string
+}
+
+// File returns the documentation of the file f. The src argument is
+// the content of the file, from which the text of default values,
+// annotations, and global values is taken.
+func File(f *syntax.File, src []byte) *Module {
+	text := func(e syntax.Expr) string {
+		start, end := e.Span()
+		i, j := start.Offset(), end.Offset()
+		if 0 <= i && i <= j && j <= len(src) {
+			return string(src[i:j])
+		}
+		return ""
+	}
+
+	m := &Module{Path: f.Path, Doc: docString(f.Stmts)}
+	for i, stmt := range f.Stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.DefStmt:
+			if isPrivate(stmt.Name.Name) {
+				continue
+			}
+			fn := &Func{
+				Name: stmt.Name.Name,
+				Pos:  stmt.Def,
+				Doc:  docString(stmt.Body),
+			}
+			for j, param := range stmt.Params {
+				p := new(Param)
+				switch param := param.(type) {
+				case *syntax.Ident:
+					p.Name = param.Name
+				case *syntax.BinaryExpr: // name=default
+					p.Name = param.X.(*syntax.Ident).Name
+					p.Default = text(param.Y)
+				case *syntax.UnaryExpr: // *args or **kwargs
+					p.Name = param.X.(*syntax.Ident).Name
+					p.Prefix = param.Op.String()
+				}
+				if stmt.ParamTypes != nil && stmt.ParamTypes[j] != nil {
+					p.Type = text(stmt.ParamTypes[j])
+				}
+				fn.Params = append(fn.Params, p)
+			}
+			if stmt.ResultType != nil {
+				fn.Result = text(stmt.ResultType)
+			}
+			m.Funcs = append(m.Funcs, fn)
+
+		case *syntax.AssignStmt:
+			id, ok := stmt.LHS.(*syntax.Ident)
+			if !ok || stmt.Op != syntax.EQ || isPrivate(id.Name) {
+				continue
+			}
+			if doc := docString(f.Stmts[i+1:]); doc != "" {
+				m.Globals = append(m.Globals, &Global{
+					Name:  id.Name,
+					Pos:   id.NamePos,
+					Value: text(stmt.RHS),
+					Doc:   doc,
+				})
+			}
+		}
+	}
+	return m
+}
+
+// Signature returns the signature of the function, as it would appear
+// in a def statement.
+func (fn *Func) Signature() string {
+	var buf bytes.Buffer
+	buf.WriteString(fn.Name)
+	buf.WriteByte('(')
+	for i, p := range fn.Params {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(p.Prefix)
+		buf.WriteString(p.Name)
+		if p.Type != "" {
+			buf.WriteString(": ")
+			buf.WriteString(p.Type)
+		}
+		if p.Default != "" {
+			buf.WriteString(" = ")
+			buf.WriteString(p.Default)
+		}
+	}
+	buf.WriteByte(')')
+	if fn.Result != "" {
+		buf.WriteString(" -> ")
+		buf.WriteString(fn.Result)
+	}
+	return buf.String()
+}
+
+// docString returns the docstring at the start of stmts: the value
+// of the first statement, if that is a string literal, with its
+// indentation removed.
+func docString(stmts []syntax.Stmt) string {
+	if len(stmts) > 0 {
+		if expr, ok := stmts[0].(*syntax.ExprStmt); ok {
+			if lit, ok := expr.X.(*syntax.Literal); ok && lit.Token == syntax.STRING {
+				return trimDoc(lit.Value.(string))
+			}
+		}
+	}
+	return ""
+}
+
+// trimDoc removes from a docstring its leading and trailing blank
+// lines, and the indentation common to all lines but the first,
+// which by convention starts just after the opening quotes.
+func trimDoc(doc string) string {
+	lines := strings.Split(strings.Replace(doc, "\t", "        ", -1), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		if trimmed := strings.TrimLeft(line, " "); trimmed != "" {
+			if n := len(line) - len(trimmed); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	lines[0] = strings.TrimSpace(lines[0])
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) >= indent && indent > 0 {
+			lines[i] = lines[i][indent:]
+		}
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isPrivate(name string) bool { return strings.HasPrefix(name, "_") }
@@ -0,0 +1,146 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docgen_test
+
+import (
+	"bytes"
+	"testing"
+
+	"go.starlark.net/docgen"
+	"go.starlark.net/syntax"
+)
+
+const src = `"""Utilities for frobnicating.
+
+See also: frob.
+"""
+
+load("other", "helper")
+
+MAX_DEPTH = 10
+"""The maximum depth of frobnication."""
+
+_LIMIT = 5
+"""Private."""
+
+UNDOCUMENTED = 1
+
+def frob(x, depth = MAX_DEPTH, *args, **kwargs):
+    """Returns x, frobnicated.
+
+    The depth is limited:
+
+        depth <= MAX_DEPTH
+    """
+    return helper(x)
+
+def typed(x: int, y: "str" = "a<b") -> list:
+    return [x, y]
+
+def _private():
+    """Not documented."""
+`
+
+func parse(t *testing.T) *docgen.Module {
+	t.Helper()
+	opts := &syntax.FileOptions{Types: true}
+	f, err := opts.Parse("frob.star", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return docgen.File(f, []byte(src))
+}
+
+func TestFile(t *testing.T) {
+	m := parse(t)
+	if want := "Utilities for frobnicating.\n\nSee also: frob."; m.Doc != want {
+		t.Errorf("module doc = %q, want %q", m.Doc, want)
+	}
+	var got []string
+	for _, fn := range m.Funcs {
+		got = append(got, fn.Signature(), fn.Doc)
+	}
+	for _, g := range m.Globals {
+		got = append(got, g.Name, g.Value, g.Doc)
+	}
+	want := []string{
+		"frob(x, depth = MAX_DEPTH, *args, **kwargs)",
+		"Returns x, frobnicated.\n\nThe depth is limited:\n\n    depth <= MAX_DEPTH",
+		`typed(x: int, y: "str" = "a<b") -> list`,
+		"",
+		"MAX_DEPTH", "10", "The maximum depth of frobnication.",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got[i], want[i])
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := parse(t).WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const want = "# frob.star\n" +
+		"\n" +
+		"Utilities for frobnicating.\n" +
+		"\n" +
+		"See also: frob.\n" +
+		"\n" +
+		"## Functions\n" +
+		"\n" +
+		"### frob\n" +
+		"\n" +
+		"```python\n" +
+		"frob(x, depth = MAX_DEPTH, *args, **kwargs)\n" +
+		"```\n" +
+		"\n" +
+		"Returns x, frobnicated.\n" +
+		"\n" +
+		"The depth is limited:\n" +
+		"\n" +
+		"    depth <= MAX_DEPTH\n" +
+		"\n" +
+		"### typed\n" +
+		"\n" +
+		"```python\n" +
+		"typed(x: int, y: \"str\" = \"a<b\") -> list\n" +
+		"```\n" +
+		"\n" +
+		"## Globals\n" +
+		"\n" +
+		"### MAX_DEPTH\n" +
+		"\n" +
+		"```python\n" +
+		"MAX_DEPTH = 10\n" +
+		"```\n" +
+		"\n" +
+		"The maximum depth of frobnication.\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := parse(t).WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h1>frob.star</h1>`,
+		`<dt id="frob"><code>frob(x, depth = MAX_DEPTH, *args, **kwargs)</code></dt>`,
+		`<code>typed(x: int, y: &#34;str&#34; = &#34;a&lt;b&#34;) -&gt; list</code>`,
+		`<dt id="MAX_DEPTH"><code>MAX_DEPTH = 10</code></dt>`,
+		`<pre class="doc">The maximum depth of frobnication.</pre>`,
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("HTML output does not contain %s:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docgen
+
+// This file defines the Markdown and HTML renderings of a Module.
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// WriteMarkdown writes the documentation of the module to w as a
+// Markdown reference page. Docstrings are assumed to be Markdown.
+func (m *Module) WriteMarkdown(w io.Writer) error {
+	return markdownTemplate.Execute(w, m)
+}
+
+// WriteHTML writes the documentation of the module to w as an HTML
+// fragment. Docstrings are presented as preformatted text.
+func (m *Module) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, m)
+}
+
+// shortValue returns the text of a global's value if it fits on one line.
+func (g *Global) shortValue() string {
+	if len(g.Value) > 60 || strings.Contains(g.Value, "\n") {
+		return ""
+	}
+	return g.Value
+}
+
+var funcs = map[string]interface{}{
+	"shortValue": (*Global).shortValue,
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(funcs).Parse(
+	"# {{.Path}}\n" +
+		"{{with .Doc}}\n{{.}}\n{{end}}" +
+		"{{if .Funcs}}\n## Functions\n" +
+		"{{range .Funcs}}\n### {{.Name}}\n\n```python\n{{.Signature}}\n```\n" +
+		"{{with .Doc}}\n{{.}}\n{{end}}" +
+		"{{end}}{{end}}" +
+		"{{if .Globals}}\n## Globals\n" +
+		"{{range .Globals}}\n### {{.Name}}\n" +
+		"{{$name := .Name}}{{with shortValue .}}\n```python\n{{$name}} = {{.}}\n```\n{{end}}" +
+		"\n{{.Doc}}\n" +
+		"{{end}}{{end}}"))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(
+	`<h1>{{.Path}}</h1>
+{{with .Doc}}<pre class="doc">{{.}}</pre>
+{{end}}{{if .Funcs}}<h2>Functions</h2>
+<dl>
+{{range .Funcs}}<dt id="{{.Name}}"><code>{{.Signature}}</code></dt>
+<dd>{{with .Doc}}<pre class="doc">{{.}}</pre>{{end}}</dd>
+{{end}}</dl>
+{{end}}{{if .Globals}}<h2>Globals</h2>
+<dl>
+{{range .Globals}}<dt id="{{.Name}}"><code>{{.Name}}{{with shortValue .}} = {{.}}{{end}}</code></dt>
+<dd><pre class="doc">{{.Doc}}</pre></dd>
+{{end}}</dl>
+{{end}}`))
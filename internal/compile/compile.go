@@ -37,7 +37,7 @@ import (
 const debug = false // TODO(adonovan): use a bitmap of options; and regexp to match files
 
 // Increment this to force recompilation of saved bytecode files.
-const Version = 3
+const Version = 7
 
 type Opcode uint8
 
@@ -125,6 +125,8 @@ const (
 	ATTR        //                x ATTR<name>          y           y = x.name
 	SETFIELD    //              x y SETFIELD<name>      -           x.name = y
 	UNPACK      //         iterable UNPACK<n>           vn ... v1
+	FORMAT      //                x FORMAT<constant>    string      [constant is "", "!conv", ":spec", or "!conv:spec"]
+	CONCAT      //        s1 ... sn CONCAT<n>           string
 
 	// n>>8 is #positional args and n&0xff is #named args (pairs).
 	CALL        // fn positional named                CALL<n>        result
@@ -148,12 +150,14 @@ var opcodeNames = [...]string{
 	CALL_VAR_KW: "call_var_kw",
 	CIRCUMFLEX:  "circumflex",
 	CJMP:        "cjmp",
+	CONCAT:      "concat",
 	CONSTANT:    "constant",
 	DUP2:        "dup2",
 	DUP:         "dup",
 	EQL:         "eql",
 	EXCH:        "exch",
 	FALSE:       "false",
+	FORMAT:      "format",
 	FREE:        "free",
 	GE:          "ge",
 	GLOBAL:      "global",
@@ -218,11 +222,13 @@ var stackEffect = [...]int8{
 	CALL_VAR_KW: variableStackEffect,
 	CIRCUMFLEX:  -1,
 	CJMP:        -1,
+	CONCAT:      variableStackEffect,
 	CONSTANT:    +1,
 	DUP2:        +2,
 	DUP:         +1,
 	EQL:         -1,
 	FALSE:       +1,
+	FORMAT:      0,
 	FREE:        +1,
 	GE:          -1,
 	GLOBAL:      +1,
@@ -284,14 +290,20 @@ func (op Opcode) String() string {
 // Programs are serialized by the gobProgram function,
 // which must be updated whenever this declaration is changed.
 type Program struct {
-	Loads     []Ident       // name (really, string) and position of each load stmt
-	Names     []string      // names of attributes and predeclared variables
-	Constants []interface{} // = string | int64 | float64 | *big.Int
+	Options   *syntax.FileOptions // dialect with which the program was compiled
+	Loads     []Ident             // name (really, string) and position of each load stmt
+	Names     []string            // names of attributes and predeclared variables
+	Constants []interface{}       // = string | int64 | float64 | *big.Int | Bytes
 	Functions []*Funcode
 	Globals   []Ident  // for error messages and tracing
 	Toplevel  *Funcode // module initialization function
 }
 
+// Bytes is the type of a bytes literal constant.
+// It is distinct from string so that the two kinds of
+// constant are not conflated in the constant pool.
+type Bytes string
+
 // A Funcode is the code of a compiled Starlark function.
 //
 // Funcodes are serialized by the gobFunc function,
@@ -300,6 +312,7 @@ type Funcode struct {
 	Prog                  *Program
 	Pos                   syntax.Position // position of def or lambda token
 	Name                  string          // name of this function
+	Doc                   string          // docstring of this function
 	Code                  []byte          // the byte code
 	pclinetab             []uint16        // mapping from pc to linenum
 	Locals                []Ident         // for error messages and tracing
@@ -307,6 +320,12 @@ type Funcode struct {
 	MaxStack              int
 	NumParams             int
 	HasVarargs, HasKwargs bool
+
+	// Type annotations, for optional dynamic checking.
+	// Each is a list of names of built-in types, any of which is
+	// acceptable, or nil if the type is not checked.
+	ParamTypes [][]string // nil if no parameter type is checked
+	ResultType []string
 }
 
 // An Ident is the name and position of an identifier.
@@ -405,15 +424,17 @@ func idents(ids []*syntax.Ident) []Ident {
 }
 
 // Expr compiles an expression to a program consisting of a single toplevel function.
-func Expr(expr syntax.Expr, locals []*syntax.Ident) *Funcode {
+func Expr(opts *syntax.FileOptions, expr syntax.Expr, locals []*syntax.Ident) *Funcode {
 	stmts := []syntax.Stmt{&syntax.ReturnStmt{Result: expr}}
-	return File(stmts, locals, nil).Toplevel
+	return File(opts, stmts, locals, nil).Toplevel
 }
 
 // File compiles the statements of a file into a program.
-func File(stmts []syntax.Stmt, locals, globals []*syntax.Ident) *Program {
+// The options record the dialect in which the file was resolved.
+func File(opts *syntax.FileOptions, stmts []syntax.Stmt, locals, globals []*syntax.Ident) *Program {
 	pcomp := &pcomp{
 		prog: &Program{
+			Options: opts,
 			Globals: idents(globals),
 		},
 		names:     make(map[string]uint32),
@@ -439,6 +460,7 @@ func (pcomp *pcomp) function(name string, pos syntax.Position, stmts []syntax.St
 			Prog:     pcomp.prog,
 			Pos:      pos,
 			Name:     name,
+			Doc:      docStringOf(stmts),
 			Locals:   idents(locals),
 			Freevars: idents(freevars),
 		},
@@ -596,6 +618,20 @@ func (pcomp *pcomp) function(name string, pos syntax.Position, stmts []syntax.St
 	return fn
 }
 
+// docStringOf returns the docstring of a function or file
+// whose body is stmts: the value of its first statement,
+// if that is a string literal.
+func docStringOf(stmts []syntax.Stmt) string {
+	if len(stmts) > 0 {
+		if expr, ok := stmts[0].(*syntax.ExprStmt); ok {
+			if lit, ok := expr.X.(*syntax.Literal); ok && lit.Token == syntax.STRING {
+				return lit.Value.(string)
+			}
+		}
+	}
+	return ""
+}
+
 func (insn *insn) stackeffect() int {
 	se := int(stackEffect[insn.op])
 	if se == variableStackEffect {
@@ -615,7 +651,7 @@ func (insn *insn) stackeffect() int {
 			//  0 for cjmp/true/exhausted
 			// Handled specially in caller.
 			se = 0
-		case MAKELIST, MAKETUPLE:
+		case MAKELIST, MAKETUPLE, CONCAT:
 			se = 1 - arg
 		case UNPACK:
 			se = arg - 1
@@ -750,6 +786,8 @@ func PrintOp(fn *Funcode, pc uint32, op Opcode, arg uint32) {
 		switch x := fn.Prog.Constants[arg].(type) {
 		case string:
 			comment = strconv.Quote(x)
+		case Bytes:
+			comment = "b" + strconv.Quote(string(x))
 		default:
 			comment = fmt.Sprint(x)
 		}
@@ -1062,6 +1100,10 @@ func (fcomp *fcomp) stmt(stmt syntax.Stmt) {
 		} else {
 			fcomp.emit(NONE)
 		}
+		if stmt.Return.IsValid() { // (not a lambda)
+			// RETURN may fail a dynamic type check.
+			fcomp.setPos(stmt.Return)
+		}
 		fcomp.emit(RETURN)
 		fcomp.block = fcomp.newBlock() // dead code
 
@@ -1146,7 +1188,44 @@ func (fcomp *fcomp) expr(e syntax.Expr) {
 
 	case *syntax.Literal:
 		// e.Value is int64, float64, *bigInt, or string.
-		fcomp.emit1(CONSTANT, fcomp.pcomp.constantIndex(e.Value))
+		v := e.Value
+		if e.Token == syntax.BYTES {
+			v = Bytes(v.(string))
+		}
+		fcomp.emit1(CONSTANT, fcomp.pcomp.constantIndex(v))
+
+	case *syntax.FStringExpr:
+		// Each field is formatted as a string, and the fields
+		// and non-empty literals are concatenated.
+		n := 0
+		for i, lit := range e.Literals {
+			if lit != "" {
+				fcomp.string(lit)
+				n++
+			}
+			if i < len(e.Fields) {
+				field := e.Fields[i]
+				fcomp.expr(field.X)
+				var suffix string
+				if field.Conv != "" {
+					suffix = "!" + field.Conv
+				}
+				if field.Spec != "" {
+					suffix += ":" + field.Spec
+				}
+				fcomp.setPos(field.Lbrace)
+				fcomp.emit1(FORMAT, fcomp.pcomp.constantIndex(suffix))
+				n++
+			}
+		}
+		switch n {
+		case 0:
+			fcomp.string("")
+		case 1:
+			// a single literal or field
+		default:
+			fcomp.emit1(CONCAT, uint32(n))
+		}
 
 	case *syntax.ListExpr:
 		for _, x := range e.List {
@@ -1677,9 +1756,41 @@ func (fcomp *fcomp) function(pos syntax.Position, name string, f *syntax.Functio
 	funcode.NumParams = len(f.Params)
 	funcode.HasVarargs = f.HasVarargs
 	funcode.HasKwargs = f.HasKwargs
+	for i, t := range f.ParamTypes {
+		if names := typeNames(t); names != nil {
+			if funcode.ParamTypes == nil {
+				funcode.ParamTypes = make([][]string, len(f.Params))
+			}
+			funcode.ParamTypes[i] = names
+		}
+	}
+	funcode.ResultType = typeNames(f.ResultType)
 	fcomp.emit1(MAKEFUNC, fcomp.pcomp.functionIndex(funcode))
 }
 
+// typeNames returns the names of the built-in types denoted by the
+// type annotation e, or nil if e is absent or is not a (union of)
+// universal names. The arguments of a generic type such as list[str]
+// are ignored.
+func typeNames(e syntax.Expr) []string {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		if resolve.Scope(e.Scope) == resolve.Universal {
+			return []string{e.Name}
+		}
+	case *syntax.IndexExpr:
+		return typeNames(e.X)
+	case *syntax.BinaryExpr:
+		if e.Op == syntax.PIPE {
+			x, y := typeNames(e.X), typeNames(e.Y)
+			if x != nil && y != nil {
+				return append(x, y...)
+			}
+		}
+	}
+	return nil
+}
+
 // ifelse emits a Boolean control flow decision.
 // On return, the current block is unset.
 func (fcomp *fcomp) ifelse(cond syntax.Expr, t, f *block) {
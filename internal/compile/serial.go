@@ -18,8 +18,14 @@ import (
 
 const magic = "!sky"
 
+func init() {
+	// Register the non-basic types that may appear in Program.Constants.
+	gob.Register(Bytes(""))
+}
+
 type gobProgram struct {
 	Version   int
+	Options   syntax.FileOptions
 	Filename  string
 	Loads     []gobIdent
 	Names     []string
@@ -31,6 +37,7 @@ type gobProgram struct {
 
 type gobFunction struct {
 	Id                    gobIdent // hack: name and pos
+	Doc                   string
 	Code                  []byte
 	Pclinetab             []uint16
 	Locals                []gobIdent
@@ -38,6 +45,8 @@ type gobFunction struct {
 	MaxStack              int
 	NumParams             int
 	HasVarargs, HasKwargs bool
+	ParamTypes            [][]string
+	ResultType            []string
 }
 
 type gobIdent struct {
@@ -66,6 +75,7 @@ func (prog *Program) Write(out io.Writer) error {
 				Line: fn.Pos.Line,
 				Col:  fn.Pos.Col,
 			},
+			Doc:        fn.Doc,
 			Code:       fn.Code,
 			Pclinetab:  fn.pclinetab,
 			Locals:     gobIdents(fn.Locals),
@@ -74,6 +84,8 @@ func (prog *Program) Write(out io.Writer) error {
 			NumParams:  fn.NumParams,
 			HasVarargs: fn.HasVarargs,
 			HasKwargs:  fn.HasKwargs,
+			ParamTypes: fn.ParamTypes,
+			ResultType: fn.ResultType,
 		}
 	}
 
@@ -87,6 +99,9 @@ func (prog *Program) Write(out io.Writer) error {
 		Globals:   gobIdents(prog.Globals),
 		Toplevel:  gobFunc(prog.Toplevel),
 	}
+	if prog.Options != nil {
+		gp.Options = *prog.Options
+	}
 	for i, f := range prog.Functions {
 		gp.Functions[i] = gobFunc(f)
 	}
@@ -131,7 +146,9 @@ func ReadProgram(in io.Reader) (*Program, error) {
 		return res
 	}
 
+	opts := gp.Options
 	prog := &Program{
+		Options:   &opts,
 		Loads:     ungobIdents(gp.Loads),
 		Names:     gp.Names,
 		Constants: gp.Constants,
@@ -145,6 +162,7 @@ func ReadProgram(in io.Reader) (*Program, error) {
 			Prog:       prog,
 			Pos:        pos,
 			Name:       gf.Id.Name,
+			Doc:        gf.Doc,
 			Code:       gf.Code,
 			pclinetab:  gf.Pclinetab,
 			Locals:     ungobIdents(gf.Locals),
@@ -153,6 +171,8 @@ func ReadProgram(in io.Reader) (*Program, error) {
 			NumParams:  gf.NumParams,
 			HasVarargs: gf.HasVarargs,
 			HasKwargs:  gf.HasKwargs,
+			ParamTypes: gf.ParamTypes,
+			ResultType: gf.ResultType,
 		}
 	}
 
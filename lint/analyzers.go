@@ -0,0 +1,338 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lint
+
+import (
+	"strings"
+
+	"go.starlark.net/refactor"
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+// Analyzers is the list of all analyzers defined by this package.
+var Analyzers = []*Analyzer{
+	MutableDefault,
+	NoneCompare,
+	ShadowedBuiltin,
+	Unreachable,
+	UnusedLoad,
+	UnusedLocal,
+}
+
+// UnusedLoad reports load bindings that are never used.
+var UnusedLoad = &Analyzer{
+	Name: "unusedload",
+	Doc: `report unused loads
+
+The unusedload analyzer reports each name bound by a load statement
+that is not used in the file. It suggests removing the binding.`,
+	Run: runUnusedLoad,
+}
+
+func runUnusedLoad(pass *Pass) {
+	f := pass.File
+	used := make([]bool, len(f.Globals))
+	syntax.Walk(f, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.LoadStmt:
+			return false // bindings, not uses
+		case *syntax.Ident:
+			if resolve.Scope(n.Scope) == resolve.Global {
+				used[n.Index] = true
+			}
+		}
+		return true
+	})
+	for _, stmt := range f.Stmts {
+		load, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+		for _, to := range load.To {
+			if resolve.Scope(to.Scope) != resolve.Global || used[to.Index] {
+				continue
+			}
+			d := Diagnostic{Pos: to.NamePos, Message: to.Name + " is loaded but not used"}
+			if f.Tokens != nil {
+				d.SuggestedFixes = []SuggestedFix{{
+					Message: "remove unused load of " + to.Name,
+					Edits:   refactor.RemoveLoad(f, to.Name),
+				}}
+			}
+			pass.Report(d)
+		}
+	}
+}
+
+// UnusedLocal reports local variables that are assigned but never used.
+var UnusedLocal = &Analyzer{
+	Name: "unusedlocal",
+	Doc: `report unused local variables
+
+The unusedlocal analyzer reports each local variable of a function,
+other than a parameter, that is assigned a value that is never used,
+and each unused variable of a comprehension. Variables whose names
+begin with an underscore, such as _, are not reported.`,
+	Run: runUnusedLocal,
+}
+
+func runUnusedLocal(pass *Pass) {
+	// Identify the binding occurrences of variables.
+	binding := make(map[*syntax.Ident]bool)
+	var bind func(e syntax.Expr)
+	bind = func(e syntax.Expr) {
+		switch e := e.(type) {
+		case *syntax.Ident:
+			binding[e] = true
+		case *syntax.ParenExpr:
+			bind(e.X)
+		case *syntax.TupleExpr:
+			for _, elem := range e.List {
+				bind(elem)
+			}
+		case *syntax.ListExpr:
+			for _, elem := range e.List {
+				bind(elem)
+			}
+		}
+	}
+	syntax.Walk(pass.File, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.AssignStmt:
+			if n.Op == syntax.EQ {
+				bind(n.LHS)
+			}
+		case *syntax.ForStmt:
+			bind(n.Vars)
+		case *syntax.ForClause:
+			bind(n.Vars)
+		}
+		return true
+	})
+
+	// check reports the unused locals of a function, or of the file,
+	// whose parameters, if any, are the first nparams locals.
+	var check func(locals []*syntax.Ident, nparams int, body []syntax.Stmt)
+	check = func(locals []*syntax.Ident, nparams int, body []syntax.Stmt) {
+		used := make([]bool, len(locals))
+
+		var visit func(n syntax.Node)
+		// function visits a nested def or lambda. Its defaults and
+		// annotations, and its uses of free variables, are uses of
+		// the locals of the enclosing function.
+		function := func(fn *syntax.Function) {
+			for i, param := range fn.Params {
+				if binary, ok := param.(*syntax.BinaryExpr); ok {
+					visit(binary.Y)
+				}
+				if fn.ParamTypes != nil && fn.ParamTypes[i] != nil {
+					visit(fn.ParamTypes[i])
+				}
+			}
+			if fn.ResultType != nil {
+				visit(fn.ResultType)
+			}
+			for _, fv := range fn.FreeVars {
+				if resolve.Scope(fv.Scope) == resolve.Local {
+					used[fv.Index] = true
+				}
+			}
+			check(fn.Locals, len(fn.Params), fn.Body)
+		}
+		visit = func(n syntax.Node) {
+			syntax.Walk(n, func(n syntax.Node) bool {
+				switch n := n.(type) {
+				case *syntax.DefStmt:
+					function(&n.Function)
+					return false
+				case *syntax.LambdaExpr:
+					function(&n.Function)
+					return false
+				case *syntax.Ident:
+					if resolve.Scope(n.Scope) == resolve.Local && !binding[n] {
+						used[n.Index] = true
+					}
+				}
+				return true
+			})
+		}
+		for _, stmt := range body {
+			visit(stmt)
+		}
+
+		for i := nparams; i < len(locals); i++ {
+			if id := locals[i]; !used[i] && !strings.HasPrefix(id.Name, "_") {
+				pass.Reportf(id.NamePos, "local variable %s is never used", id.Name)
+			}
+		}
+	}
+	check(pass.File.Locals, 0, pass.File.Stmts)
+}
+
+// ShadowedBuiltin reports variables that shadow universal built-ins.
+var ShadowedBuiltin = &Analyzer{
+	Name: "shadowedbuiltin",
+	Doc: `report variables that shadow built-ins
+
+The shadowedbuiltin analyzer reports each global variable, local
+variable, or parameter whose name is that of a universal built-in,
+such as len or str, making the built-in inaccessible within its scope.`,
+	Run: runShadowedBuiltin,
+}
+
+func runShadowedBuiltin(pass *Pass) {
+	if pass.IsUniversal == nil {
+		return
+	}
+	f := pass.File
+	check := func(bindings []*syntax.Ident) {
+		for _, id := range bindings {
+			if pass.IsUniversal(id.Name) {
+				pass.Reportf(id.NamePos, "%s shadows the built-in of the same name", id.Name)
+			}
+		}
+	}
+	check(f.Globals)
+	check(f.Locals)
+	syntax.Walk(f, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.DefStmt:
+			check(n.Function.Locals)
+		case *syntax.LambdaExpr:
+			check(n.Function.Locals)
+		}
+		return true
+	})
+}
+
+// Unreachable reports statements that can never be executed.
+var Unreachable = &Analyzer{
+	Name: "unreachable",
+	Doc: `report unreachable code
+
+The unreachable analyzer reports the first statement of each block
+that follows a return, break, or continue statement, or an if
+statement all of whose branches end in one.`,
+	Run: runUnreachable,
+}
+
+func runUnreachable(pass *Pass) {
+	check := func(stmts []syntax.Stmt) {
+		for i := 0; i+1 < len(stmts); i++ {
+			if terminates(stmts[i]) {
+				start, _ := stmts[i+1].Span()
+				pass.Reportf(start, "unreachable code")
+				return
+			}
+		}
+	}
+	check(pass.File.Stmts)
+	syntax.Walk(pass.File, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.DefStmt:
+			check(n.Function.Body)
+		case *syntax.LambdaExpr:
+			check(n.Function.Body)
+		case *syntax.ForStmt:
+			check(n.Body)
+		case *syntax.IfStmt:
+			check(n.True)
+			check(n.False)
+		}
+		return true
+	})
+}
+
+// terminates reports whether control never passes from stmt
+// to the statement after it.
+func terminates(stmt syntax.Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *syntax.ReturnStmt:
+		return true
+	case *syntax.BranchStmt:
+		return stmt.Token == syntax.BREAK || stmt.Token == syntax.CONTINUE
+	case *syntax.IfStmt:
+		return len(stmt.True) > 0 && terminates(stmt.True[len(stmt.True)-1]) &&
+			len(stmt.False) > 0 && terminates(stmt.False[len(stmt.False)-1])
+	}
+	return false
+}
+
+// MutableDefault reports parameters whose default values are mutable.
+var MutableDefault = &Analyzer{
+	Name: "mutabledefault",
+	Doc: `report mutable default parameter values
+
+The mutabledefault analyzer reports each parameter whose default value
+is a list, dict, or set. A default value is computed once, when the
+function is defined, and is shared by all calls; and once the module
+that defines the function is frozen, any attempt to update it fails.
+Use a default of None, and create the value in the function body.`,
+	Run: runMutableDefault,
+}
+
+func runMutableDefault(pass *Pass) {
+	check := func(fn *syntax.Function) {
+		for _, param := range fn.Params {
+			if binary, ok := param.(*syntax.BinaryExpr); ok && isMutable(binary.Y) {
+				id := binary.X.(*syntax.Ident)
+				pass.Reportf(id.NamePos, "parameter %s has a mutable default value", id.Name)
+			}
+		}
+	}
+	syntax.Walk(pass.File, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.DefStmt:
+			check(&n.Function)
+		case *syntax.LambdaExpr:
+			check(&n.Function)
+		}
+		return true
+	})
+}
+
+// isMutable reports whether e is a list, dict, or set display or
+// comprehension, or a call of the built-in list, dict, or set function.
+func isMutable(e syntax.Expr) bool {
+	switch e := e.(type) {
+	case *syntax.ParenExpr:
+		return isMutable(e.X)
+	case *syntax.ListExpr, *syntax.DictExpr, *syntax.Comprehension:
+		return true
+	case *syntax.CallExpr:
+		if id, ok := e.Fn.(*syntax.Ident); ok && resolve.Scope(id.Scope) == resolve.Universal {
+			return id.Name == "list" || id.Name == "dict" || id.Name == "set"
+		}
+	}
+	return false
+}
+
+// NoneCompare reports comparisons to None using == or !=.
+var NoneCompare = &Analyzer{
+	Name: "nonecompare",
+	Doc: `report comparisons to None using == or !=
+
+The nonecompare analyzer reports each comparison x == None or
+x != None. When x cannot be another false value, such as 0 or "",
+the truth tests "not x" and "x" are the more idiomatic forms.
+No fix is suggested, as the forms are not equivalent in general.`,
+	Run: runNoneCompare,
+}
+
+func runNoneCompare(pass *Pass) {
+	isNone := func(e syntax.Expr) bool {
+		id, ok := e.(*syntax.Ident)
+		return ok && id.Name == "None" && resolve.Scope(id.Scope) == resolve.Universal
+	}
+	syntax.Walk(pass.File, func(n syntax.Node) bool {
+		if binary, ok := n.(*syntax.BinaryExpr); ok &&
+			(binary.Op == syntax.EQL || binary.Op == syntax.NEQ) &&
+			(isNone(binary.X) || isNone(binary.Y)) {
+			pass.Reportf(binary.OpPos, "comparison to None using %s", binary.Op)
+		}
+		return true
+	})
+}
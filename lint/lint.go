@@ -0,0 +1,111 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lint defines a framework for static analyzers of Starlark
+// files, and a set of analyzers that report suspicious constructs:
+// mistakes that are not errors, such as an unused variable, and
+// constructs that are legal but likely to fail at run time.
+//
+// An Analyzer inspects a single parsed and resolved file and reports
+// Diagnostics, each of which may carry suggested fixes in the form of
+// textual edits. Fixes are suggested only for files parsed in
+// syntax.RetainTokens mode; see package go.starlark.net/refactor.
+package lint // import "go.starlark.net/lint"
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/refactor"
+	"go.starlark.net/syntax"
+)
+
+// An Analyzer describes an analysis function and its options.
+type Analyzer struct {
+	// Name is the name of the analyzer, a lowercase identifier
+	// used as the category of its diagnostics and to name it on
+	// the command line.
+	Name string
+
+	// Doc is the documentation for the analyzer.
+	// The first sentence is a summary.
+	Doc string
+
+	// Run applies the analyzer to the file of the Pass,
+	// reporting diagnostics through it.
+	Run func(pass *Pass)
+}
+
+func (a *Analyzer) String() string { return a.Name }
+
+// A Pass provides an analyzer with the file to be analyzed
+// and the means to report diagnostics about it.
+type Pass struct {
+	Analyzer *Analyzer
+
+	// File is the file under analysis. It has been successfully
+	// resolved, and its Tokens are present if it was parsed in
+	// syntax.RetainTokens mode.
+	File *syntax.File
+
+	// IsUniversal reports whether name is a universal built-in,
+	// such as len or None.
+	IsUniversal func(name string) bool
+
+	// Report reports a diagnostic.
+	Report func(Diagnostic)
+}
+
+// Reportf reports a diagnostic with a formatted message at pos.
+func (pass *Pass) Reportf(pos syntax.Position, format string, args ...interface{}) {
+	pass.Report(Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// A Diagnostic is a message about a problem at a particular position.
+type Diagnostic struct {
+	Pos      syntax.Position
+	Category string // name of the analyzer; set by Run
+	Message  string
+
+	// SuggestedFixes are alternative changes to the file
+	// that would fix the problem.
+	SuggestedFixes []SuggestedFix
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Category)
+}
+
+// A SuggestedFix is a change to a file that would fix a problem.
+type SuggestedFix struct {
+	Message string
+	Edits   []refactor.Edit
+}
+
+// Run applies the analyzers to the file f, which must have been
+// successfully resolved, and returns their diagnostics in order of
+// position. The isUniversal function must be the one used to resolve f.
+func Run(f *syntax.File, isUniversal func(name string) bool, analyzers []*Analyzer) []Diagnostic {
+	var diags []Diagnostic
+	for _, a := range analyzers {
+		pass := &Pass{
+			Analyzer:    a,
+			File:        f,
+			IsUniversal: isUniversal,
+			Report: func(d Diagnostic) {
+				d.Category = a.Name
+				diags = append(diags, d)
+			},
+		}
+		a.Run(pass)
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		p, q := diags[i].Pos, diags[j].Pos
+		if p.Line != q.Line {
+			return p.Line < q.Line
+		}
+		return p.Col < q.Col
+	})
+	return diags
+}
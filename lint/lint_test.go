@@ -0,0 +1,70 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lint_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/internal/chunkedfile"
+	"go.starlark.net/lint"
+	"go.starlark.net/refactor"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarktest"
+	"go.starlark.net/syntax"
+)
+
+func isPredeclared(name string) bool { return false }
+
+func TestLint(t *testing.T) {
+	filename := starlarktest.DataFile("lint", "testdata/lint.star")
+	for _, chunk := range chunkedfile.Read(filename, t) {
+		opts := &syntax.FileOptions{
+			NestedDef: strings.Contains(chunk.Source, "option:nesteddef"),
+			Lambda:    strings.Contains(chunk.Source, "option:lambda"),
+		}
+		f, err := opts.Parse(filename, chunk.Source, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if err := resolve.File(f, isPredeclared, starlark.Universe.Has); err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, d := range lint.Run(f, starlark.Universe.Has, lint.Analyzers) {
+			chunk.GotError(int(d.Pos.Line), d.Message)
+		}
+		chunk.Done()
+	}
+}
+
+func TestSuggestedFix(t *testing.T) {
+	const src = `load("m", "a", "b")
+print(b)
+`
+	f, err := syntax.Parse("a.star", src, syntax.RetainTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolve.File(f, isPredeclared, starlark.Universe.Has); err != nil {
+		t.Fatal(err)
+	}
+	diags := lint.Run(f, starlark.Universe.Has, []*lint.Analyzer{lint.UnusedLoad})
+	if len(diags) != 1 || len(diags[0].SuggestedFixes) != 1 {
+		t.Fatalf("got diagnostics %v, want one with a fix", diags)
+	}
+	if got, want := diags[0].String(), "a.star:1:12: a is loaded but not used (unusedload)"; got != want {
+		t.Errorf("got diagnostic %s, want %s", got, want)
+	}
+	out, err := refactor.Apply(f.Source(), diags[0].SuggestedFixes[0].Edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "load(\"m\", \"b\")\nprint(b)\n"; got != want {
+		t.Errorf("fixed file is %q, want %q", got, want)
+	}
+}
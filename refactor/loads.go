@@ -0,0 +1,256 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/syntax"
+)
+
+// AddLoad returns the edits that add to file f a load of the global
+// from of the specified module, bound to the name local.
+// The binding is added to an existing load statement for the module
+// if there is one, or else to a new load statement after the last
+// one, or at the start of the file.
+// It returns no edits if the binding is already present.
+func AddLoad(f *syntax.File, module, local, from string) ([]Edit, error) {
+	for _, load := range loads(f) {
+		for i, to := range load.To {
+			if to.Name == local {
+				if load.Module.Value == module && load.From[i].Name == from {
+					return nil, nil // already present
+				}
+				return nil, fmt.Errorf("%s: %s is already loaded", to.NamePos, local)
+			}
+		}
+	}
+	if !isIdent(local) {
+		return nil, fmt.Errorf("invalid identifier: %q", local)
+	}
+	for _, global := range f.Globals {
+		if global.Name == local {
+			return nil, fmt.Errorf("%s: %s is already defined", global.NamePos, local)
+		}
+	}
+	return []Edit{addLoad(f, module, []string{local}, []string{from})}, nil
+}
+
+// addLoad returns the edit that adds to f, without checks, the load
+// bindings of the globals from[i] of module as the names local[i].
+func addLoad(f *syntax.File, module string, local, from []string) Edit {
+	bindings := make([]string, len(local))
+	for i := range local {
+		bindings[i] = quote(from[i])
+		if local[i] != from[i] {
+			bindings[i] = local[i] + " = " + bindings[i]
+		}
+	}
+
+	// Add the binding to an existing load of the module?
+	for _, load := range loads(f) {
+		if load.Module.Value != module {
+			continue
+		}
+		r := tokenAt(f, load.Rparen)
+		prev := f.Tokens[r-1]
+		if prev.Token != syntax.COMMA {
+			return Edit{Start: prev.End, End: prev.End, New: ", " + strings.Join(bindings, ", ")}
+		}
+		if f.Tokens[r].Pos.Line == prev.Pos.Line {
+			return Edit{Start: prev.End, End: prev.End, New: " " + strings.Join(bindings, ", ") + ","}
+		}
+		// One binding per line: match the indentation of the last one.
+		last := tokenAt(f, load.Module.TokenPos)
+		if n := len(load.To); n > 0 {
+			start, _ := bindingRange(f, load, n-1)
+			last = tokenStartingAt(f, start)
+		}
+		leading := f.Tokens[last].Leading
+		indent := leading[strings.LastIndex(leading, "\n")+1:]
+		var text string
+		for _, binding := range bindings {
+			text += "\n" + indent + binding + ","
+		}
+		return Edit{Start: prev.End, End: prev.End, New: text}
+	}
+
+	// Add a new load statement.
+	stmt := fmt.Sprintf("load(%s, %s)\n", quote(module), strings.Join(bindings, ", "))
+	if all := loads(f); len(all) > 0 || len(f.Stmts) == 0 {
+		end := f.Tokens[len(f.Tokens)-1].End
+		if len(all) > 0 {
+			_, end = stmtRange(f, all[len(all)-1])
+		}
+		return Edit{Start: end, End: end, New: lineStart(f, end) + stmt}
+	}
+	if isDocString(f.Stmts[0]) {
+		_, end := stmtRange(f, f.Stmts[0])
+		return Edit{Start: end, End: end, New: "\n" + stmt}
+	}
+	i, _ := f.TokenRange(f.Stmts[0])
+	start := f.Tokens[i].Start
+	return Edit{Start: start, End: start, New: stmt + "\n"}
+}
+
+// RemoveLoad returns the edits that remove from file f the load
+// binding of the name local, or the entire load statement if it has
+// no other bindings. It returns no edits if local is not loaded.
+// RemoveLoad does not check whether local is still used.
+func RemoveLoad(f *syntax.File, local string) []Edit {
+	for _, load := range loads(f) {
+		for i, to := range load.To {
+			if to.Name == local {
+				return []Edit{removeBindings(f, load, map[int]bool{i: true})}
+			}
+		}
+	}
+	return nil
+}
+
+// removeBindings returns the edit that removes the bindings of load
+// whose indices are in remove, or the entire statement if none remain.
+func removeBindings(f *syntax.File, load *syntax.LoadStmt, remove map[int]bool) Edit {
+	if len(remove) == len(load.To) {
+		start, end := stmtRange(f, load)
+		return Edit{Start: start, End: end}
+	}
+
+	// Each run of adjacent bindings is removed up to the next binding,
+	// or, at the end, from the previous one. The text between the runs
+	// is kept.
+	src := f.Source()
+	edit := Edit{Start: -1}
+	for i := 0; i < len(load.To); i++ {
+		if !remove[i] {
+			continue
+		}
+		j := i
+		for j+1 < len(load.To) && remove[j+1] {
+			j++
+		}
+		var start, end int
+		if j+1 < len(load.To) {
+			start, _ = bindingRange(f, load, i)
+			end, _ = bindingRange(f, load, j+1)
+		} else {
+			_, start = bindingRange(f, load, i-1)
+			_, end = bindingRange(f, load, j)
+		}
+		if edit.Start < 0 {
+			edit.Start = start
+		} else {
+			edit.New += string(src[edit.End:start])
+		}
+		edit.End = end
+		i = j
+	}
+	return edit
+}
+
+// SortLoads returns the edits that sort the bindings of each load
+// statement of file f by local name. Layout and comments between the
+// bindings are preserved.
+func SortLoads(f *syntax.File) []Edit {
+	var edits []Edit
+	for _, load := range loads(f) {
+		order := make([]int, len(load.To))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return load.To[order[i]].Name < load.To[order[j]].Name
+		})
+		src := f.Source()
+		for i, j := range order {
+			if i != j {
+				start, end := bindingRange(f, load, i)
+				jstart, jend := bindingRange(f, load, j)
+				edits = append(edits, Edit{Start: start, End: end, New: string(src[jstart:jend])})
+			}
+		}
+	}
+	return edits
+}
+
+// loads returns the load statements of f.
+func loads(f *syntax.File) []*syntax.LoadStmt {
+	var loads []*syntax.LoadStmt
+	for _, stmt := range f.Stmts {
+		if load, ok := stmt.(*syntax.LoadStmt); ok {
+			loads = append(loads, load)
+		}
+	}
+	return loads
+}
+
+// bindingRange returns the byte range of the ith binding of load.
+func bindingRange(f *syntax.File, load *syntax.LoadStmt, i int) (start, end int) {
+	to, from := load.To[i], load.From[i]
+	lit := f.Tokens[tokenAt(f, from.NamePos)]
+	if to == from {
+		return lit.Start, lit.End // "name"
+	}
+	return offset(f, to.NamePos), lit.End // local="name"
+}
+
+// tokenStartingAt returns the index of the token of f that starts at offset.
+func tokenStartingAt(f *syntax.File, offset int) int {
+	return sort.Search(len(f.Tokens), func(i int) bool { return f.Tokens[i].Start >= offset })
+}
+
+// lineStart returns the text, either empty or a newline, to insert
+// before a new line of text at offset in f.
+func lineStart(f *syntax.File, offset int) string {
+	if src := f.Source(); offset > 0 && src[offset-1] != '\n' {
+		return "\n"
+	}
+	return ""
+}
+
+// stmtRange returns the byte range of the top-level statement stmt of
+// f, including any comment lines immediately before it, and the
+// newline that ends it.
+func stmtRange(f *syntax.File, stmt syntax.Stmt) (start, end int) {
+	i, j := f.TokenRange(stmt)
+	start, end = f.Tokens[i].Start, f.Tokens[j-1].End
+	if j < len(f.Tokens) && f.Tokens[j].Token == syntax.NEWLINE {
+		end = f.Tokens[j].End
+	}
+
+	// Find the trivia since the previous line, if any.
+	k := i - 1
+	for k >= 0 && f.Tokens[k].Text == "" {
+		k--
+	}
+	if k < 0 {
+		return // don't claim the comments at the start of the file
+	}
+	var trivia string
+	for _, tok := range f.Tokens[k+1 : i+1] {
+		trivia += tok.Leading
+	}
+
+	// Include the comment lines at the end of the trivia.
+	lines := strings.SplitAfter(trivia, "\n")
+	for n := len(lines) - 2; n >= 0; n-- {
+		if !strings.HasPrefix(strings.TrimLeft(lines[n], " \t"), "#") {
+			break
+		}
+		start -= len(lines[n])
+	}
+	return start, end
+}
+
+// isDocString reports whether stmt is a string literal.
+func isDocString(stmt syntax.Stmt) bool {
+	if expr, ok := stmt.(*syntax.ExprStmt); ok {
+		lit, ok := expr.X.(*syntax.Literal)
+		return ok && lit.Token == syntax.STRING
+	}
+	return false
+}
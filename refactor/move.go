@@ -0,0 +1,184 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactor
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+// Move returns the edits that move the top-level definition of the
+// global name, a def statement or assignment, from file src to the end
+// of file dst. The modules srcModule and dstModule are the names by
+// which the two files are loaded.
+//
+// Each dependent file that loads name from srcModule is updated to
+// load it from dstModule instead; the dependents may include src and
+// dst. If name is still used in src, src is made to load it from dst.
+// Any loads on which the definition depends are added to dst.
+// It is an error if the definition refers to another global of src.
+//
+// The result maps the Path of each file to its edits.
+func Move(name string, src *syntax.File, srcModule string, dst *syntax.File, dstModule string, dependents []*syntax.File) (map[string][]Edit, error) {
+	// Find the definition.
+	var def syntax.Stmt
+	for _, stmt := range src.Stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.DefStmt:
+			if stmt.Name.Name == name {
+				def = stmt
+			}
+		case *syntax.AssignStmt:
+			if id, ok := stmt.LHS.(*syntax.Ident); ok && id.Name == name && stmt.Op == syntax.EQ {
+				def = stmt
+			}
+		}
+		if def != nil {
+			break
+		}
+	}
+	if def == nil {
+		return nil, fmt.Errorf("%s: no top-level definition of %s", src.Path, name)
+	}
+	defStart, defEnd := def.Span()
+	within := func(pos syntax.Position) bool {
+		return !before(pos, defStart) && before(pos, defEnd)
+	}
+
+	// Find the loaded globals used by the definition,
+	// and whether name is used elsewhere in src.
+	loaded := make(map[*syntax.Ident]int) // binding of load.To[i] -> i
+	loadOf := make(map[*syntax.Ident]*syntax.LoadStmt)
+	for _, load := range loads(src) {
+		for i, to := range load.To {
+			loaded[to] = i
+			loadOf[to] = load
+		}
+	}
+	var needs []*syntax.Ident // bindings of loads needed by def, in order
+	seen := make(map[*syntax.Ident]bool)
+	var err error
+	usedInSrc := false
+	forEachIdent(src, func(id, b *syntax.Ident) {
+		if resolve.Scope(id.Scope) != resolve.Global {
+			return
+		}
+		if !within(id.NamePos) {
+			if b.Name == name {
+				usedInSrc = true
+			}
+			return
+		}
+		if b.Name == name {
+			return
+		}
+		if _, ok := loaded[b]; !ok {
+			if err == nil {
+				err = fmt.Errorf("%s: %s refers to %s, a global of %s", id.NamePos, name, b.Name, src.Path)
+			}
+			return
+		}
+		if !seen[b] {
+			seen[b] = true
+			needs = append(needs, b)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for a conflicting definition in dst.
+	for _, global := range dst.Globals {
+		if global.Name == name {
+			if load := loadBinding(dst, global); load == nil || load.Module.Value != srcModule {
+				return nil, fmt.Errorf("%s: %s is already defined", global.NamePos, name)
+			}
+		}
+	}
+
+	edits := make(map[string][]Edit)
+
+	// Update the dependents, including src and dst, which load the
+	// definition from srcModule.
+	for _, f := range dependents {
+		var local, from []string // bindings to load from dstModule
+		for _, load := range loads(f) {
+			if load.Module.Value != srcModule {
+				continue
+			}
+			remove := make(map[int]bool)
+			for i, id := range load.From {
+				if id.Name != name {
+					continue
+				}
+				if f == dst && load.To[i].Name != name {
+					return nil, fmt.Errorf("%s: %s loads %s as %s", load.To[i].NamePos, dst.Path, name, load.To[i].Name)
+				}
+				remove[i] = true
+				local = append(local, load.To[i].Name)
+				from = append(from, name)
+			}
+			if len(remove) > 0 {
+				edits[f.Path] = append(edits[f.Path], removeBindings(f, load, remove))
+			}
+		}
+		if local != nil && f != dst {
+			edits[f.Path] = append(edits[f.Path], addLoad(f, dstModule, local, from))
+		}
+	}
+
+	// Move the definition.
+	start, end := stmtRange(src, def)
+	text := string(src.Source()[start:end])
+	if rest := string(src.Source()[end:]); start == 0 || strings.HasSuffix(string(src.Source()[:start]), "\n\n") {
+		// Remove a blank line that would otherwise be doubled.
+		if trimmed := strings.TrimLeft(rest, " \t"); strings.HasPrefix(trimmed, "\n") {
+			end += len(rest) - len(trimmed) + 1
+		}
+	}
+	if text[len(text)-1] != '\n' {
+		text += "\n"
+	}
+	dstEnd := dst.Tokens[len(dst.Tokens)-1].End
+	sep := lineStart(dst, dstEnd)
+	if dstEnd > 0 {
+		sep += "\n" // blank line
+	}
+	edits[src.Path] = append(edits[src.Path], Edit{Start: start, End: end})
+	edits[dst.Path] = append(edits[dst.Path], Edit{Start: dstEnd, End: dstEnd, New: sep + text})
+
+	// Add the loads needed by the definition to dst.
+	for _, b := range needs {
+		load := loadOf[b]
+		from := load.From[loaded[b]].Name
+		more, err := AddLoad(dst, load.Module.Value.(string), b.Name, from)
+		if err != nil {
+			return nil, err
+		}
+		edits[dst.Path] = append(edits[dst.Path], more...)
+	}
+
+	// Load the definition into src, if still needed.
+	if usedInSrc {
+		edits[src.Path] = append(edits[src.Path], addLoad(src, dstModule, []string{name}, []string{name}))
+	}
+
+	return edits, nil
+}
+
+// loadBinding returns the load statement of f that binds id, if any.
+func loadBinding(f *syntax.File, id *syntax.Ident) *syntax.LoadStmt {
+	for _, load := range loads(f) {
+		for _, to := range load.To {
+			if to == id {
+				return load
+			}
+		}
+	}
+	return nil
+}
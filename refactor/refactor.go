@@ -0,0 +1,215 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package refactor provides automated refactorings of Starlark files,
+// such as renaming a variable, moving a definition to another module,
+// and editing load statements.
+//
+// Each refactoring computes a list of textual edits, which the client
+// may inspect or apply to the file using Apply.
+// Regions of a file not covered by an edit are left byte-identical.
+//
+// The refactorings operate on files parsed in syntax.RetainTokens mode
+// and successfully resolved by resolve.File.
+package refactor // import "go.starlark.net/refactor"
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+// An Edit replaces the bytes [Start:End) of a file by New.
+type Edit struct {
+	Start, End int
+	New        string
+}
+
+// Apply returns a copy of src with the edits applied.
+// The edits, which are offsets into src, must not overlap.
+func Apply(src []byte, edits []Edit) ([]byte, error) {
+	edits = append([]Edit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].Start != edits[j].Start {
+			return edits[i].Start < edits[j].Start
+		}
+		return edits[i].End < edits[j].End // insertions first
+	})
+
+	var out []byte
+	pos := 0
+	for _, edit := range edits {
+		if edit.Start < pos || edit.End < edit.Start || edit.End > len(src) {
+			return nil, fmt.Errorf("invalid or overlapping edit [%d:%d)", edit.Start, edit.End)
+		}
+		out = append(out, src[pos:edit.Start]...)
+		out = append(out, edit.New...)
+		pos = edit.End
+	}
+	out = append(out, src[pos:]...)
+	return out, nil
+}
+
+// before reports whether position p is before q.
+func before(p, q syntax.Position) bool {
+	if p.Line != q.Line {
+		return p.Line < q.Line
+	}
+	return p.Col < q.Col
+}
+
+// tokenAt returns the index of the token of f that contains pos.
+func tokenAt(f *syntax.File, pos syntax.Position) int {
+	i := sort.Search(len(f.Tokens), func(i int) bool {
+		return before(pos, f.Tokens[i].Pos)
+	})
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// offset returns the byte offset in f of pos,
+// which must lie within a token.
+func offset(f *syntax.File, pos syntax.Position) int {
+	if offset := pos.Offset(); offset >= 0 {
+		return offset
+	}
+	tok := f.Tokens[tokenAt(f, pos)]
+	offset := tok.Start
+	for col := tok.Pos.Col; col < pos.Col && offset < tok.End; col++ {
+		_, size := utf8.DecodeRuneInString(tok.Text[offset-tok.Start:])
+		offset += size
+	}
+	return offset
+}
+
+// identEdit returns the edit that replaces identifier id by name.
+func identEdit(f *syntax.File, id *syntax.Ident, name string) Edit {
+	start := offset(f, id.NamePos)
+	return Edit{Start: start, End: start + len(id.Name), New: name}
+}
+
+// isIdent reports whether name is a valid Starlark identifier.
+func isIdent(name string) bool {
+	expr, err := syntax.ParseExpr("", name, 0)
+	id, ok := expr.(*syntax.Ident)
+	return err == nil && ok && id.Name == name
+}
+
+// forEachIdent calls fn for each identifier in f that refers to a
+// global or local variable. The binding of the variable is the
+// identifier recorded for it by the resolver, such as the first
+// assignment to a global or the declaration of a parameter;
+// all identifiers that refer to the same variable have the same binding.
+//
+// The identifiers bound by a load statement are included. Those of the
+// form load("module", "name") lie within a string literal.
+func forEachIdent(f *syntax.File, fn func(id, binding *syntax.Ident)) {
+	var stack []*syntax.Function // enclosing functions
+
+	// lookup returns the binding denoted by (scope, index)
+	// in the function at the top of the stack.
+	var lookup func(stack []*syntax.Function, scope resolve.Scope, index int) *syntax.Ident
+	lookup = func(stack []*syntax.Function, scope resolve.Scope, index int) *syntax.Ident {
+		switch scope {
+		case resolve.Global:
+			return f.Globals[index]
+		case resolve.Local:
+			if len(stack) == 0 {
+				return f.Locals[index] // comprehension variable at top level
+			}
+			return stack[len(stack)-1].Locals[index]
+		case resolve.Free:
+			fv := stack[len(stack)-1].FreeVars[index]
+			return lookup(stack[:len(stack)-1], resolve.Scope(fv.Scope), fv.Index)
+		}
+		return nil // predeclared, universal, or not a variable
+	}
+
+	ident := func(id *syntax.Ident) {
+		if b := lookup(stack, resolve.Scope(id.Scope), id.Index); b != nil {
+			fn(id, b)
+		}
+	}
+
+	var visit func(n syntax.Node)
+
+	// function visits the parts of a def or lambda.
+	// Defaults and annotations belong to the enclosing function.
+	function := func(fn *syntax.Function) {
+		for i, param := range fn.Params {
+			if binary, ok := param.(*syntax.BinaryExpr); ok {
+				visit(binary.Y)
+			}
+			if fn.ParamTypes != nil && fn.ParamTypes[i] != nil {
+				visit(fn.ParamTypes[i])
+			}
+		}
+		if fn.ResultType != nil {
+			visit(fn.ResultType)
+		}
+
+		stack = append(stack, fn)
+		for _, param := range fn.Params {
+			switch param := param.(type) {
+			case *syntax.Ident:
+				ident(param)
+			case *syntax.BinaryExpr:
+				ident(param.X.(*syntax.Ident))
+			case *syntax.UnaryExpr:
+				ident(param.X.(*syntax.Ident))
+			}
+		}
+		for _, stmt := range fn.Body {
+			visit(stmt)
+		}
+		stack = stack[:len(stack)-1]
+	}
+
+	visit = func(n syntax.Node) {
+		syntax.Walk(n, func(n syntax.Node) bool {
+			switch n := n.(type) {
+			case *syntax.DefStmt:
+				ident(n.Name)
+				function(&n.Function)
+				return false
+			case *syntax.LambdaExpr:
+				function(&n.Function)
+				return false
+			case *syntax.LoadStmt:
+				for _, to := range n.To {
+					ident(to)
+				}
+				return false
+			case *syntax.DotExpr:
+				visit(n.X) // n.Name is not a variable
+				return false
+			case *syntax.Ident:
+				ident(n)
+			}
+			return true
+		})
+	}
+	for _, stmt := range f.Stmts {
+		visit(stmt)
+	}
+}
+
+// isUsed reports whether any variable, whether global, local,
+// predeclared, or universal, named name is defined or used in f.
+func isUsed(f *syntax.File, name string) bool {
+	used := false
+	syntax.Walk(f, func(n syntax.Node) bool {
+		// Attribute names and keyword arguments are not resolved.
+		if id, ok := n.(*syntax.Ident); ok && id.Name == name && resolve.Scope(id.Scope) != resolve.Undefined {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
@@ -0,0 +1,402 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactor_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/refactor"
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+func isPredeclared(name string) bool { return name == "M" }
+func isUniversal(name string) bool   { return name == "len" || name == "print" }
+
+// parse parses and resolves a test file.
+func parse(t *testing.T, filename, src string) *syntax.File {
+	t.Helper()
+	opts := &syntax.FileOptions{NestedDef: true, Lambda: true}
+	f, err := opts.Parse(filename, src, syntax.RetainTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolve.File(f, isPredeclared, isUniversal); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// apply returns the source of f with the edits applied.
+func apply(t *testing.T, f *syntax.File, edits []refactor.Edit) string {
+	t.Helper()
+	out, err := refactor.Apply(f.Source(), edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// at returns the position of the last byte of the first occurrence of
+// substr in f.
+func at(f *syntax.File, substr string) syntax.Position {
+	src := string(f.Source())
+	i := strings.Index(src, substr) + len(substr) - 1
+	line := strings.Count(src[:i], "\n") + 1
+	col := i - strings.LastIndex(src[:i], "\n")
+	return syntax.MakePosition(&f.Path, int32(line), int32(col))
+}
+
+func TestApply(t *testing.T) {
+	src := []byte("abcdef")
+	for _, test := range []struct {
+		edits []refactor.Edit
+		want  string
+	}{
+		{nil, "abcdef"},
+		{[]refactor.Edit{{4, 5, "E"}, {0, 1, "A"}}, "AbcdEf"},
+		{[]refactor.Edit{{2, 4, ""}, {2, 2, "x"}}, "abxef"},
+		{[]refactor.Edit{{6, 6, "g"}}, "abcdefg"},
+		{[]refactor.Edit{{1, 3, ""}, {2, 4, ""}}, "invalid or overlapping edit [2:4)"},
+	} {
+		got, err := refactor.Apply(src, test.edits)
+		if err != nil {
+			got = []byte(err.Error())
+		}
+		if string(got) != test.want {
+			t.Errorf("Apply(%v) = %q, want %q", test.edits, got, test.want)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	for _, test := range []struct {
+		src, at, name, want string
+	}{
+		// global
+		{
+			"x = 1\ndef f():\n    return x + len([x])\nprint(x.y, f(x=x))\n",
+			"x", "z",
+			"z = 1\ndef f():\n    return z + len([z])\nprint(z.y, f(x=z))\n",
+		},
+		// local; the global of the same name is unaffected
+		{
+			"x = 1\ndef f(a):\n    x = a\n    return x\n",
+			"return x", "b",
+			"x = 1\ndef f(a):\n    b = a\n    return b\n",
+		},
+		// parameter, with default and free references
+		{
+			"def f(a=1):\n    return lambda: a * 2\n",
+			"(a", "n",
+			"def f(n=1):\n    return lambda: n * 2\n",
+		},
+		// comprehension variable
+		{
+			"y = [x for x in M if x]\n",
+			" if x", "e",
+			"y = [e for e in M if e]\n",
+		},
+		// string-form load binding
+		{
+			"load(\"m\", \"a\", b = \"c\")\nprint(a)\n",
+			"(a", "z",
+			"load(\"m\", z = \"a\", b = \"c\")\nprint(z)\n",
+		},
+		// keyword-form load binding
+		{
+			"load(\"m\", \"a\", b = \"c\")\nprint(b)\n",
+			", b", "z",
+			"load(\"m\", \"a\", z = \"c\")\nprint(z)\n",
+		},
+		// errors
+		{"x = 1\ny = x\n", "y", "x", "name x is already used in a.star"},
+		{"x = 1\ny = M\n", "x", "M", "name M is already used in a.star"},
+		{"x = 1\n", "x", "def", `invalid identifier: "def"`},
+		{"x = 1\n", "1", "y", "a.star:1:5: no variable"},
+		{"x = len\n", "len", "y", "a.star:1:7: no variable"},
+	} {
+		f := parse(t, "a.star", test.src)
+		var got string
+		edits, err := refactor.Rename(f, at(f, test.at), test.name)
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = apply(t, f, edits)
+		}
+		if got != test.want {
+			t.Errorf("Rename(%q, %s) got\n%s\nwant\n%s", test.at, test.name, got, test.want)
+		}
+	}
+}
+
+func TestRenameLoaded(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{
+			"load(\"m\", \"a\")\nprint(a)\n",
+			"load(\"m\", \"z\")\nprint(z)\n",
+		},
+		{
+			"load(\"m\", x = \"a\")\nprint(x)\n",
+			"load(\"m\", x = \"z\")\nprint(x)\n",
+		},
+		{
+			"load(\"m\", a = \"a\")\nprint(a)\n",
+			"load(\"m\", \"z\")\nprint(z)\n",
+		},
+		{
+			"load(\"n\", \"a\")\nprint(a)\n",
+			"load(\"n\", \"a\")\nprint(a)\n",
+		},
+		{
+			"load(\"m\", \"a\")\nz = a\n",
+			"name z is already used in a.star",
+		},
+	} {
+		f := parse(t, "a.star", test.src)
+		var got string
+		edits, err := refactor.RenameLoaded(f, "m", "a", "z")
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = apply(t, f, edits)
+		}
+		if got != test.want {
+			t.Errorf("RenameLoaded(%q) got\n%s\nwant\n%s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestAddLoad(t *testing.T) {
+	for _, test := range []struct {
+		src, module, local, from, want string
+	}{
+		// existing load statement
+		{
+			"load(\"m\", \"a\")\nx = 1\n",
+			"m", "b", "b",
+			"load(\"m\", \"a\", \"b\")\nx = 1\n",
+		},
+		{
+			"load(\"m\", \"a\",)\n",
+			"m", "c", "b",
+			"load(\"m\", \"a\", c = \"b\",)\n",
+		},
+		{
+			"load(\n    \"m\",\n    \"a\",\n)\n",
+			"m", "b", "b",
+			"load(\n    \"m\",\n    \"a\",\n    \"b\",\n)\n",
+		},
+		// new load statement after the last one
+		{
+			"load(\"m\", \"a\")\n\nx = 1\n",
+			"n", "b", "b",
+			"load(\"m\", \"a\")\nload(\"n\", \"b\")\n\nx = 1\n",
+		},
+		// new load statement at the start of the file
+		{
+			"# comment\nx = 1\n",
+			"n", "b", "b",
+			"# comment\nload(\"n\", \"b\")\n\nx = 1\n",
+		},
+		{
+			"\"doc\"\nx = 1\n",
+			"n", "b", "b",
+			"\"doc\"\n\nload(\"n\", \"b\")\nx = 1\n",
+		},
+		{
+			"",
+			"n", "b", "b",
+			"load(\"n\", \"b\")\n",
+		},
+		// already present
+		{
+			"load(\"m\", \"a\")\n",
+			"m", "a", "a",
+			"load(\"m\", \"a\")\n",
+		},
+		// errors
+		{"load(\"m\", \"a\")\n", "n", "a", "a", "a.star:1:12: a is already loaded"},
+		{"a = 1\n", "n", "a", "a", "a.star:1:1: a is already defined"},
+	} {
+		f := parse(t, "a.star", test.src)
+		var got string
+		edits, err := refactor.AddLoad(f, test.module, test.local, test.from)
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = apply(t, f, edits)
+		}
+		if got != test.want {
+			t.Errorf("AddLoad(%q, %s, %s, %s) got\n%s\nwant\n%s", test.src, test.module, test.local, test.from, got, test.want)
+		}
+	}
+}
+
+func TestRemoveLoad(t *testing.T) {
+	for _, test := range []struct {
+		src, local, want string
+	}{
+		{
+			"load(\"m\", \"a\", \"b\", c = \"d\")\n",
+			"a",
+			"load(\"m\", \"b\", c = \"d\")\n",
+		},
+		{
+			"load(\"m\", \"a\", \"b\", c = \"d\")\n",
+			"c",
+			"load(\"m\", \"a\", \"b\")\n",
+		},
+		{
+			"load(\n    \"m\",\n    \"a\",\n    \"b\",\n)\n",
+			"b",
+			"load(\n    \"m\",\n    \"a\",\n)\n",
+		},
+		{
+			"load(\"m\", \"a\")\n\n# about n\nload(\"n\", \"b\")\nx = 1\n",
+			"b",
+			"load(\"m\", \"a\")\n\nx = 1\n",
+		},
+		{
+			"load(\"m\", \"a\")\n",
+			"z",
+			"load(\"m\", \"a\")\n",
+		},
+	} {
+		f := parse(t, "a.star", test.src)
+		got := apply(t, f, refactor.RemoveLoad(f, test.local))
+		if got != test.want {
+			t.Errorf("RemoveLoad(%q, %s) got\n%s\nwant\n%s", test.src, test.local, got, test.want)
+		}
+	}
+}
+
+func TestSortLoads(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{
+			"load(\"m\", \"c\", a = \"x\", \"b\")\n",
+			"load(\"m\", a = \"x\", \"b\", \"c\")\n",
+		},
+		{
+			"load(\n    \"m\",\n    \"b\",  # bee\n    \"a\",\n)\nload(\"n\", \"z\", \"y\")\n",
+			"load(\n    \"m\",\n    \"a\",  # bee\n    \"b\",\n)\nload(\"n\", \"y\", \"z\")\n",
+		},
+		{
+			"load(\"m\", \"a\", \"b\")\n",
+			"load(\"m\", \"a\", \"b\")\n",
+		},
+	} {
+		f := parse(t, "a.star", test.src)
+		got := apply(t, f, refactor.SortLoads(f))
+		if got != test.want {
+			t.Errorf("SortLoads(%q) got\n%s\nwant\n%s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	src := parse(t, "src.star", `load("util", "helper")
+
+# f does things.
+def f(x):
+    return helper(x)
+
+def g():
+    return f(1)
+`)
+	dst := parse(t, "dst.star", `load("src", "f")
+
+y = f(2)
+`)
+	user := parse(t, "user.star", `load("src", "g", ff = "f")
+
+z = ff(g())
+`)
+	edits, err := refactor.Move("f", src, "src", dst, "dst", []*syntax.File{src, dst, user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		f    *syntax.File
+		want string
+	}{
+		{src, `load("util", "helper")
+load("dst", "f")
+
+def g():
+    return f(1)
+`},
+		{dst, `load("util", "helper")
+
+y = f(2)
+
+# f does things.
+def f(x):
+    return helper(x)
+`},
+		{user, `load("src", "g")
+load("dst", ff = "f")
+
+z = ff(g())
+`},
+	} {
+		if got := apply(t, test.f, edits[test.f.Path]); got != test.want {
+			t.Errorf("Move: %s got\n%s\nwant\n%s", test.f.Path, got, test.want)
+		}
+	}
+
+	// Dependents that load f more than once.
+	for _, test := range []struct{ src, want string }{
+		{
+			"load(\"src\", \"f\", g = \"f\")\n\nx = f(g)\n",
+			"load(\"dst\", \"f\", g = \"f\")\n\nx = f(g)\n",
+		},
+		{
+			"load(\"src\", \"f\", \"h\", g = \"f\")\n",
+			"load(\"src\", \"h\")\nload(\"dst\", \"f\", g = \"f\")\n",
+		},
+		{
+			"load(\"src\", \"f\", \"h\")\nload(\"src\", g = \"f\")\n",
+			"load(\"src\", \"h\")\nload(\"dst\", \"f\", g = \"f\")\n",
+		},
+		{
+			"load(\"dst\", \"y\")\nload(\"src\", \"f\")\nload(\"src\", g = \"f\")\n",
+			"load(\"dst\", \"y\", \"f\", g = \"f\")\n",
+		},
+	} {
+		src := parse(t, "src.star", "def f(): pass\n")
+		dst := parse(t, "dst.star", "")
+		user := parse(t, "user.star", test.src)
+		edits, err := refactor.Move("f", src, "src", dst, "dst", []*syntax.File{user})
+		if err != nil {
+			t.Errorf("Move(%q): %v", test.src, err)
+			continue
+		}
+		if got := apply(t, user, edits[user.Path]); got != test.want {
+			t.Errorf("Move(%q) got\n%s\nwant\n%s", test.src, got, test.want)
+		}
+	}
+
+	// Errors.
+	for _, test := range []struct {
+		name, src, dst, want string
+	}{
+		{"h", "x = 1\n", "", "src.star: no top-level definition of h"},
+		{"f", "x = 1\ndef f(): return x\n", "", "src.star:2:17: f refers to x, a global of src.star"},
+		{"x", "x = 1\n", "x = 2\n", "dst.star:1:1: x is already defined"},
+	} {
+		src := parse(t, "src.star", test.src)
+		dst := parse(t, "dst.star", test.dst)
+		_, err := refactor.Move(test.name, src, "src", dst, "dst", nil)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Move(%s, %q, %q) = %v, want %s", test.name, test.src, test.dst, err, test.want)
+		}
+	}
+}
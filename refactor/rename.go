@@ -0,0 +1,121 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactor
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.starlark.net/syntax"
+)
+
+// Rename returns the edits to file f that rename the variable denoted
+// by the identifier at pos, which may be a global or local variable,
+// along with all other references to it, to name.
+//
+// It is an error if name is already used in f. Rename does not update
+// the keyword arguments of calls to a function whose parameter is
+// renamed, nor other files that load a renamed global; see RenameLoaded.
+func Rename(f *syntax.File, pos syntax.Position, name string) ([]Edit, error) {
+	var binding *syntax.Ident
+	forEachIdent(f, func(id, b *syntax.Ident) {
+		if id.NamePos.Line == pos.Line &&
+			id.NamePos.Col <= pos.Col && pos.Col < id.NamePos.Col+int32(len(id.Name)) {
+			binding = b
+		}
+	})
+	if binding == nil {
+		return nil, fmt.Errorf("%s: no variable", pos)
+	}
+	if binding.Name == name {
+		return nil, nil
+	}
+	if err := checkName(f, name); err != nil {
+		return nil, err
+	}
+	return rename(f, binding, name, nil), nil
+}
+
+// RenameLoaded returns the edits to file f that follow the renaming of
+// the global oldName of the specified module to newName. Each load of
+// oldName from module is updated to load newName. If the local name of
+// such a binding was also oldName, it too is renamed to newName, along
+// with all references to it.
+func RenameLoaded(f *syntax.File, module, oldName, newName string) ([]Edit, error) {
+	var edits []Edit
+	for _, load := range loads(f) {
+		if load.Module.Value != module {
+			continue
+		}
+		for i, from := range load.From {
+			if from.Name != oldName {
+				continue
+			}
+			to := load.To[i]
+			if to.Name != oldName {
+				// load("module", x="oldName")
+				lit := f.Tokens[tokenAt(f, from.NamePos)]
+				edits = append(edits, Edit{Start: lit.Start, End: lit.End, New: quote(newName)})
+				continue
+			}
+
+			// load("module", "oldName") or load("module", oldName="oldName")
+			if err := checkName(f, newName); err != nil {
+				return nil, err
+			}
+			start, end := bindingRange(f, load, i)
+			edits = append(edits, Edit{Start: start, End: end, New: quote(newName)})
+			edits = append(edits, rename(f, to, newName, to)...)
+		}
+	}
+	return edits, nil
+}
+
+// checkName returns an error if name is not a valid identifier,
+// or is already used in f.
+func checkName(f *syntax.File, name string) error {
+	if !isIdent(name) {
+		return fmt.Errorf("invalid identifier: %q", name)
+	}
+	if isUsed(f, name) {
+		return fmt.Errorf("name %s is already used in %s", name, f.Path)
+	}
+	return nil
+}
+
+// rename returns the edits that rename each reference to the variable
+// whose binding is given, except skip, to name.
+func rename(f *syntax.File, binding *syntax.Ident, name string, skip *syntax.Ident) []Edit {
+	// Identify the bindings of load("module", "name"),
+	// which lie within strings.
+	inString := make(map[*syntax.Ident]bool)
+	for _, load := range loads(f) {
+		for i, to := range load.To {
+			if to == load.From[i] {
+				inString[to] = true
+			}
+		}
+	}
+
+	var edits []Edit
+	forEachIdent(f, func(id, b *syntax.Ident) {
+		if b != binding || id == skip {
+			return
+		}
+		if inString[id] {
+			// load("module", "x") becomes load("module", y = "x").
+			lit := f.Tokens[tokenAt(f, id.NamePos)]
+			edits = append(edits, Edit{Start: lit.Start, End: lit.Start, New: name + " = "})
+		} else {
+			edits = append(edits, identEdit(f, id, name))
+		}
+	})
+	return edits
+}
+
+// quote returns a Starlark string literal for s.
+func quote(s string) string {
+	return strconv.Quote(s)
+}
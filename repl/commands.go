@@ -0,0 +1,102 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl
+
+// This file defines the meta-commands, such as :load.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// A command is a REPL meta-command.
+type command struct {
+	name, args, help string
+	files            bool // accesses the file system; see Config.AllowFileCommands
+	run              func(s *session, args string) error
+}
+
+// commands is the list of meta-commands, initialized by init
+// to avoid an initialization cycle through :help.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", "", "print this message", false, (*session).help},
+		{"load", "file", "execute a file in the current environment", true, (*session).load},
+		{"reset", "", "restore the initial environment", false, (*session).reset},
+		{"time", "input", "execute input and report the time taken", false, (*session).time},
+		{"type", "expr", "print the type of the value of an expression", false, (*session).typ},
+	}
+}
+
+// command executes the meta-command line, such as ":load x.star".
+func (s *session) command(line string) error {
+	name, args := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, args = name[:i], strings.TrimSpace(name[i:])
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if cmd.files && !s.fileCommands {
+				return fmt.Errorf("command :%s is not permitted in this session", cmd.name)
+			}
+			if cmd.args != "" && args == "" {
+				return fmt.Errorf("usage: :%s %s", cmd.name, cmd.args)
+			}
+			return cmd.run(s, args)
+		}
+	}
+	return fmt.Errorf("unknown command :%s; try :help", name)
+}
+
+func (s *session) help(string) error {
+	for _, cmd := range commands {
+		fmt.Fprintf(s.out, "  %-15s %s\n", strings.TrimSpace(":"+cmd.name+" "+cmd.args), cmd.help)
+	}
+	return nil
+}
+
+func (s *session) load(filename string) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return execFileNoFreeze(s.opts, s.thread, filename, src, s.globals)
+}
+
+func (s *session) reset(string) error {
+	for k := range s.globals {
+		delete(s.globals, k)
+	}
+	for k, v := range s.initial {
+		s.globals[k] = v
+	}
+	return nil
+}
+
+func (s *session) time(input string) error {
+	start := time.Now()
+	v, err := s.eval("<stdin>", []byte(input))
+	elapsed := time.Since(start)
+	if err == nil && v != nil && v != starlark.None {
+		fmt.Fprintln(s.out, v)
+	}
+	fmt.Fprintf(s.errOut, "time: %s\n", elapsed)
+	return err
+}
+
+func (s *session) typ(expr string) error {
+	v, err := starlark.EvalOptions(s.opts, s.thread, "<stdin>", expr, s.globals)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, v.Type())
+	return nil
+}
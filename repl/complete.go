@@ -0,0 +1,97 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl
+
+// This file defines tab completion.
+
+import (
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// keywords are the Starlark keywords offered as completions.
+var keywords = []string{
+	"and", "break", "continue", "def", "elif", "else", "for", "if",
+	"in", "lambda", "load", "not", "or", "pass", "return",
+}
+
+// completer implements readline.AutoCompleter for a session.
+type completer struct{ s *session }
+
+// Do returns the possible completions of the word before position pos
+// of line, as suffixes of the word, and the length of the word in runes.
+func (c completer) Do(line []rune, pos int) (suffixes [][]rune, length int) {
+	text := string(line[:pos])
+	var word string
+	var names []string
+	if strings.HasPrefix(text, ":") && !strings.ContainsAny(text, " \t") {
+		word = text
+		for _, cmd := range commands {
+			names = append(names, ":"+cmd.name)
+		}
+	} else {
+		i := len(text)
+		for i > 0 && (isIdentByte(text[i-1]) || text[i-1] == '.') {
+			i--
+		}
+		names, word = completions(c.s.globals, text[i:])
+	}
+
+	sort.Strings(names)
+	for i, name := range names {
+		if strings.HasPrefix(name, word) && (i == 0 || name != names[i-1]) {
+			suffixes = append(suffixes, []rune(name[len(word):]))
+		}
+	}
+	return suffixes, len([]rune(word))
+}
+
+// completions returns the candidate completions of expr, which is
+// either a name or a dotted sequence of names, such as "x.y.z". For a
+// name, the candidates are the global and universal names and the
+// keywords. Otherwise they are the attribute names of the value
+// denoted by all but the last name, if it can be found without
+// calling functions. The result word is the final name, the part of
+// expr to be completed.
+func completions(globals starlark.StringDict, expr string) (names []string, word string) {
+	parts := strings.Split(expr, ".")
+	word = parts[len(parts)-1]
+	if len(parts) == 1 {
+		for name := range globals {
+			names = append(names, name)
+		}
+		for name := range starlark.Universe {
+			names = append(names, name)
+		}
+		return append(names, keywords...), word
+	}
+
+	v, ok := globals[parts[0]]
+	if !ok {
+		v, ok = starlark.Universe[parts[0]]
+	}
+	if !ok {
+		return nil, word
+	}
+	for _, name := range parts[1 : len(parts)-1] {
+		x, ok := v.(starlark.HasAttrs)
+		if !ok {
+			return nil, word
+		}
+		if v, _ = x.Attr(name); v == nil {
+			return nil, word
+		}
+	}
+	if x, ok := v.(starlark.HasAttrs); ok {
+		names = x.AttrNames()
+	}
+	return names, word
+}
+
+func isIdentByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_'
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl_test
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/repl"
+	"go.starlark.net/starlark"
+)
+
+// ExampleConfig_ServeProtocol demonstrates the line protocol
+// used by programmatic clients of a REPL.
+func ExampleConfig_ServeProtocol() {
+	const requests = `{"id": 1, "input": "x = 6 * 7"}
+{"id": 2, "input": "print('hello')\nx"}
+{"id": 3, "input": "x"}
+{"id": 4, "input": "y = x.nosuch"}
+`
+	thread := new(starlark.Thread)
+	globals := make(starlark.StringDict)
+	cfg := new(repl.Config)
+	if err := cfg.ServeProtocol(thread, globals, strings.NewReader(requests), os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+
+	// Output:
+	// {"id":1}
+	// {"id":2,"output":"hello\n"}
+	// {"id":3,"value":"42","type":"int"}
+	// {"id":4,"error":{"message":"int has no .nosuch field or method","backtrace":"Traceback (most recent call last):\n  <input>:1: in <toplevel>\nError: int has no .nosuch field or method"}}
+}
+
+// ExampleConfig_Serve demonstrates a stand-alone server that provides
+// a separate REPL to each client of a local socket. A user may connect
+// to it using a command such as:
+//
+// 	nc -U /tmp/starlark.sock
+//
+// As the Config does not set AllowFileCommands, clients cannot use
+// :load to execute files on the server, and as the threads have no Load
+// function, neither can they use load statements.
+func ExampleConfig_Serve() {
+	ln, err := net.Listen("unix", filepath.Join(os.TempDir(), "starlark.sock"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ln.Close()
+
+	cfg := new(repl.Config)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer conn.Close()
+			thread := new(starlark.Thread)
+			globals := make(starlark.StringDict)
+			if err := cfg.Serve(thread, globals, conn, conn); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl
+
+// This file defines the test for a complete item of input.
+
+import "strings"
+
+// needMore reports whether the REPL should read another line to
+// complete the item whose text so far is text, and whose last line is
+// last.
+func needMore(text, last string) bool {
+	open, block := scanInput(text)
+	return open || block && strings.TrimSpace(last) != ""
+}
+
+// scanInput reports whether text ends within brackets, within a
+// triple-quoted string, or after a backslash, any of which means the
+// current line continues on the next; and whether text contains a
+// line ending with a colon, which introduces an indented block.
+//
+// Other errors, such as an unterminated single-quoted string, are left
+// for the parser to report.
+func scanInput(text string) (open, block bool) {
+	depth := 0    // nesting of brackets
+	var last byte // last significant byte of current line
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '#':
+			if j := strings.IndexByte(text[i:], '\n'); j >= 0 {
+				i += j - 1 // newline is next
+			} else {
+				i = len(text)
+			}
+
+		case '\'', '"':
+			quote := text[i : i+1]
+			if strings.HasPrefix(text[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			j := i + len(quote)
+			for {
+				if j >= len(text) {
+					return len(quote) == 3, block
+				}
+				if text[j] == '\\' {
+					j += 2
+					continue
+				}
+				if strings.HasPrefix(text[j:], quote) {
+					break
+				}
+				if text[j] == '\n' && len(quote) == 1 {
+					return false, block // unterminated string
+				}
+				j++
+			}
+			i = j + len(quote) - 1
+			last = c
+
+		case '(', '[', '{':
+			depth++
+			last = c
+
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+			last = c
+
+		case '\\':
+			if i+1 == len(text) {
+				return true, block // line continuation
+			}
+			if text[i+1] == '\n' {
+				i++ // line continuation
+			} else {
+				last = c
+			}
+
+		case '\n':
+			if depth == 0 && last == ':' {
+				block = true
+			}
+			last = 0
+
+		case ' ', '\t', '\r':
+			// skip
+
+		default:
+			last = c
+		}
+	}
+	if depth == 0 && last == ':' {
+		block = true
+	}
+	return depth > 0, block
+}
@@ -1,15 +1,24 @@
 // The repl package provides a read/eval/print loop for Starlark.
 //
-// It supports readline-style command editing,
-// and interrupts through Control-C.
+// It supports readline-style command editing, interrupts through
+// Control-C, tab completion of names and attributes, and, optionally,
+// an input history that persists across sessions.
 //
-// If an input line can be parsed as an expression,
-// the REPL parses and evaluates it and prints its result.
-// Otherwise the REPL reads lines until a blank line,
-// then tries again to parse the multi-line input as an
-// expression. If the input still cannot be parsed as an expression,
-// the REPL parses and executes it as a file (a list of statements),
-// for side effects.
+// The REPL reads lines of input until they form a complete item:
+// one that does not end within brackets or a triple-quoted string,
+// nor after a backslash. An item that contains a line ending with a
+// colon, which introduces an indented block, is complete only after a
+// blank line. If the item can be parsed as an expression, the REPL
+// evaluates it and prints its result. Otherwise the REPL parses and
+// executes it as a file (a list of statements), for side effects.
+//
+// Input lines beginning with a colon are meta-commands, such as
+// :load and :time. Type :help for a list.
+//
+// Config.Run reads from the terminal. Config.Serve runs the same loop
+// over arbitrary streams, such as a network connection, for remote
+// consoles, and Config.ServeProtocol provides a line protocol of JSON
+// requests and responses for programmatic clients.
 package repl // import "go.starlark.net/repl"
 
 // TODO(adonovan):
@@ -18,7 +27,6 @@ package repl // import "go.starlark.net/repl"
 //     >>> (1, 2)
 //     (1, 2)
 //     >>> 1, 2
-//     ...
 //     >>>
 //   This is not necessarily a bug.
 
@@ -26,6 +34,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
@@ -44,18 +53,63 @@ var interrupted = make(chan os.Signal, 1)
 // SIGINT (Control-C). Client-supplied global functions may use this
 // context to make long-running operations interruptable.
 //
+// Input is interpreted using the options returned by
+// syntax.LegacyFileOptions. New code should use REPLOptions.
+//
 func REPL(thread *starlark.Thread, globals starlark.StringDict) {
+	REPLOptions(syntax.LegacyFileOptions(), thread, globals)
+}
+
+// REPLOptions is a variant of REPL that interprets input
+// of the dialect specified by opts.
+func REPLOptions(opts *syntax.FileOptions, thread *starlark.Thread, globals starlark.StringDict) {
+	cfg := &Config{Options: opts}
+	cfg.Run(thread, globals)
+}
+
+// A Config specifies the optional features of a REPL.
+// The zero Config is ready to use.
+type Config struct {
+	// Options specifies the dialect of the input. If nil, the
+	// options returned by syntax.LegacyFileOptions are used.
+	Options *syntax.FileOptions
+
+	// HistoryFile is the name of the file in which the input
+	// history is saved, so that it persists across sessions.
+	// If empty, the history is not saved.
+	HistoryFile string
+
+	// AllowFileCommands enables, in Serve and ServeProtocol, the
+	// meta-commands that access the host's file system, such as
+	// :load. They are disabled by default because a remote client
+	// should not be able to execute arbitrary files on the server.
+	// They are always enabled in Run, whose user is local.
+	// Load statements are not affected: they are the responsibility
+	// of the Load function of the caller's thread.
+	AllowFileCommands bool
+}
+
+// Run executes a read, eval, print loop on the terminal,
+// as described at REPL.
+func (cfg *Config) Run(thread *starlark.Thread, globals starlark.StringDict) {
 	signal.Notify(interrupted, os.Interrupt)
 	defer signal.Stop(interrupted)
 
-	rl, err := readline.New(">>> ")
+	s := newSession(cfg, thread, globals, os.Stdout, os.Stderr)
+	s.interrupted = interrupted
+	s.fileCommands = true
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:       ">>> ",
+		HistoryFile:  cfg.HistoryFile,
+		AutoComplete: completer{s},
+	})
 	if err != nil {
 		PrintError(err)
 		return
 	}
 	defer rl.Close()
 	for {
-		if err := rep(rl, thread, globals); err != nil {
+		if err := s.rep(terminal{rl}); err != nil {
 			if err == readline.ErrInterrupt {
 				fmt.Println(err)
 				continue
@@ -66,11 +120,55 @@ func REPL(thread *starlark.Thread, globals starlark.StringDict) {
 	fmt.Println()
 }
 
+// A lineReader reads lines of input, prompting for each one.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// terminal is a lineReader for a readline terminal.
+type terminal struct{ rl *readline.Instance }
+
+func (t terminal) readLine(prompt string) (string, error) {
+	t.rl.SetPrompt(prompt)
+	return t.rl.Readline()
+}
+
+// A session holds the state of a running REPL.
+type session struct {
+	opts         *syntax.FileOptions
+	thread       *starlark.Thread
+	globals      starlark.StringDict
+	initial      starlark.StringDict // copy of globals at start, for :reset
+	out, errOut  io.Writer           // destinations of results and errors
+	interrupted  <-chan os.Signal    // cancels the current item (optional)
+	fileCommands bool                // enable meta-commands that access files
+}
+
+func newSession(cfg *Config, thread *starlark.Thread, globals starlark.StringDict, out, errOut io.Writer) *session {
+	opts := cfg.Options
+	if opts == nil {
+		opts = syntax.LegacyFileOptions()
+	}
+	initial := make(starlark.StringDict, len(globals))
+	for k, v := range globals {
+		initial[k] = v
+	}
+	return &session{
+		opts:         opts,
+		thread:       thread,
+		globals:      globals,
+		initial:      initial,
+		out:          out,
+		errOut:       errOut,
+		fileCommands: cfg.AllowFileCommands,
+	}
+}
+
 // rep reads, evaluates, and prints one item.
 //
 // It returns an error (possibly readline.ErrInterrupt)
-// only if readline failed. Starlark errors are printed.
-func rep(rl *readline.Instance, thread *starlark.Thread, globals starlark.StringDict) error {
+// only if reading failed. Starlark errors are printed.
+func (s *session) rep(in lineReader) error {
 	// Each item gets its own context,
 	// which is cancelled by a SIGINT.
 	//
@@ -80,90 +178,68 @@ func rep(rl *readline.Instance, thread *starlark.Thread, globals starlark.String
 	defer cancel()
 	go func() {
 		select {
-		case <-interrupted:
+		case <-s.interrupted:
 			cancel()
 		case <-ctx.Done():
 		}
 	}()
 
-	thread.SetLocal("context", ctx)
+	s.thread.SetLocal("context", ctx)
 
-	rl.SetPrompt(">>> ")
-	line, err := rl.Readline()
+	line, err := in.readLine(">>> ")
 	if err != nil {
 		return err // may be ErrInterrupt
 	}
 
 	if l := strings.TrimSpace(line); l == "" || l[0] == '#' {
 		return nil // blank or comment
-	}
-
-	// If the line contains a well-formed expression, evaluate it.
-	if _, err := syntax.ParseExpr("<stdin>", line, 0); err == nil {
-		if v, err := starlark.Eval(thread, "<stdin>", line, globals); err != nil {
-			PrintError(err)
-		} else if v != starlark.None {
-			fmt.Println(v)
+	} else if l[0] == ':' {
+		if err := s.command(l); err != nil {
+			fprintError(s.errOut, err)
 		}
 		return nil
 	}
 
-	// If the input so far is a single load or assignment statement,
-	// execute it without waiting for a blank line.
-	if f, err := syntax.Parse("<stdin>", line, 0); err == nil && len(f.Stmts) == 1 {
-		switch f.Stmts[0].(type) {
-		case *syntax.AssignStmt, *syntax.LoadStmt:
-			// Execute it as a file.
-			if err := execFileNoFreeze(thread, line, globals); err != nil {
-				PrintError(err)
-			}
-			return nil
-		}
-	}
-
-	// Otherwise assume it is the first of several
-	// comprising a file, followed by a blank line.
+	// Read more lines until the item is complete.
 	var buf bytes.Buffer
-	fmt.Fprintln(&buf, line)
-	for {
-		rl.SetPrompt("... ")
-		line, err := rl.Readline()
+	buf.WriteString(line)
+	for needMore(buf.String(), line) {
+		line, err = in.readLine("... ")
 		if err != nil {
 			return err // may be ErrInterrupt
 		}
-		if l := strings.TrimSpace(line); l == "" {
-			break // blank
-		}
-		fmt.Fprintln(&buf, line)
+		buf.WriteByte('\n')
+		buf.WriteString(line)
 	}
-	text := buf.Bytes()
 
-	// Try parsing it once more as an expression,
-	// such as a call spread over several lines:
+	if v, err := s.eval("<stdin>", buf.Bytes()); err != nil {
+		fprintError(s.errOut, err)
+	} else if v != nil && v != starlark.None {
+		fmt.Fprintln(s.out, v)
+	}
+	return nil
+}
+
+// eval evaluates the input text and returns its value if it is an
+// expression, or executes it as a file and returns nil.
+func (s *session) eval(filename string, text []byte) (starlark.Value, error) {
+	// If the text is a well-formed expression, evaluate it.
+	// This includes a call spread over several lines:
 	//   f(
 	//     1,
 	//     2
 	//   )
-	if _, err := syntax.ParseExpr("<stdin>", text, 0); err == nil {
-		if v, err := starlark.Eval(thread, "<stdin>", text, globals); err != nil {
-			PrintError(err)
-		} else if v != starlark.None {
-			fmt.Println(v)
-		}
-		return nil
+	if _, err := syntax.ParseExpr(filename, text, 0); err == nil {
+		return starlark.EvalOptions(s.opts, s.thread, filename, text, s.globals)
 	}
 
 	// Execute it as a file.
-	if err := execFileNoFreeze(thread, text, globals); err != nil {
-		PrintError(err)
-	}
-
-	return nil
+	return nil, execFileNoFreeze(s.opts, s.thread, filename, text, s.globals)
 }
 
 // execFileNoFreeze is starlark.ExecFile without globals.Freeze().
-func execFileNoFreeze(thread *starlark.Thread, src interface{}, globals starlark.StringDict) error {
-	_, prog, err := starlark.SourceProgram("<stdin>", src, globals.Has)
+func execFileNoFreeze(opts *syntax.FileOptions, thread *starlark.Thread, filename string, src interface{}, globals starlark.StringDict) error {
+	_, prog, err := starlark.SourceProgramOptions(opts, filename, src, globals.Has)
 	if err != nil {
 		return err
 	}
@@ -184,18 +260,30 @@ func execFileNoFreeze(thread *starlark.Thread, src interface{}, globals starlark
 
 // PrintError prints the error to stderr,
 // or its backtrace if it is a Starlark evaluation error.
-func PrintError(err error) {
+func PrintError(err error) { fprintError(os.Stderr, err) }
+
+// fprintError prints the error to w,
+// or its backtrace if it is a Starlark evaluation error.
+func fprintError(w io.Writer, err error) {
 	if evalErr, ok := err.(*starlark.EvalError); ok {
-		fmt.Fprintln(os.Stderr, evalErr.Backtrace())
+		fmt.Fprintln(w, evalErr.Backtrace())
 	} else {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(w, err)
 	}
 }
 
 // MakeLoad returns a simple sequential implementation of module loading
 // suitable for use in the REPL.
 // Each function returned by MakeLoad accesses a distinct private cache.
+// Modules are loaded using the options returned by
+// syntax.LegacyFileOptions. New code should use MakeLoadOptions.
 func MakeLoad() func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	return MakeLoadOptions(syntax.LegacyFileOptions())
+}
+
+// MakeLoadOptions is a variant of MakeLoad that loads modules
+// of the dialect specified by opts.
+func MakeLoadOptions(opts *syntax.FileOptions) func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
 	type entry struct {
 		globals starlark.StringDict
 		err     error
@@ -216,7 +304,7 @@ func MakeLoad() func(thread *starlark.Thread, module string) (starlark.StringDic
 
 			// Load it.
 			thread := &starlark.Thread{Load: thread.Load}
-			globals, err := starlark.ExecFile(thread, module, nil, nil)
+			globals, err := starlark.ExecFileOptions(opts, thread, module, nil, nil)
 			e = &entry{globals, err}
 
 			// Update the cache.
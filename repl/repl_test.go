@@ -0,0 +1,89 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestNeedMore(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  bool
+	}{
+		{"x = 1", false},
+		{"f(1,", true},
+		{"f(1,\n  2)", false},
+		{"x = [1, # ]\n", true},
+		{`x = """abc`, true},
+		{`x = """abc""" + "(["`, false},
+		{`x = "unterminated`, false},
+		{`x = "a\"b" + '''`, true},
+		{"x = 1 + \\", true},
+		{"x = 1 + \\\n  2", false},
+		{"if x:", true},
+		{"if x: print(x)", false},
+		{"def f():\n  return 1", true},
+		{"def f():\n  return 1\n", false},
+		{"def f():  # comment", true},
+		{"d = {1: 2}", false},
+		{"f = lambda x: x", false},
+		{"for x in y:\n  if x:\n    pass\n  ", false},
+	} {
+		lines := strings.Split(test.input, "\n")
+		if got := needMore(test.input, lines[len(lines)-1]); got != test.want {
+			t.Errorf("needMore(%q) = %t, want %t", test.input, got, test.want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := newSession(new(Config), new(starlark.Thread), starlark.StringDict{
+		"greeting": starlark.String("hello"),
+		"green":    starlark.MakeInt(1),
+	}, ioutil.Discard, ioutil.Discard)
+	for _, test := range []struct {
+		line, want string
+	}{
+		{"gre", "en eting"},
+		{"x = le", "n"},
+		{"gree", "n ting"},
+		{"greeting.spl", "it itlines"},
+		{"greeting.", "capitalize"}, // first of many
+		{"green.", ""},
+		{"nosuch.x", ""},
+		{"lam", "bda"},
+		{":re", "set"},
+		{":load fi", ""},
+	} {
+		suffixes, _ := completer{s}.Do([]rune(test.line), len([]rune(test.line)))
+		var got []string
+		for _, suffix := range suffixes {
+			got = append(got, string(suffix))
+		}
+		if !strings.HasPrefix(strings.Join(got, " "), test.want) {
+			t.Errorf("completions of %q = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	globals := starlark.StringDict{"x": starlark.MakeInt(1)}
+	s := newSession(new(Config), new(starlark.Thread), globals, ioutil.Discard, ioutil.Discard)
+	if _, err := s.eval("<test>", []byte("x = 2\ny = 3")); err != nil {
+		t.Fatal(err)
+	}
+	if got := globals.String(); !strings.Contains(got, "y") {
+		t.Fatalf("after assignment, globals = %s", got)
+	}
+	s.reset("")
+	if len(globals) != 1 || globals["x"].String() != "1" {
+		t.Errorf("after :reset, globals = %s", globals)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl
+
+// This file defines the REPL over arbitrary streams, such as a network
+// connection, and the line protocol for programmatic clients.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// maxLine is the maximum length of a line of input to a server.
+const maxLine = 1 << 20
+
+// Serve executes a read, eval, print loop, as described at REPL,
+// reading from in and writing to out. Unlike Run, it does not use the
+// terminal, so it is suitable for a remote console served over a
+// network connection. Prompts, results, errors, and the output of the
+// Starlark print function are all written to out. Meta-commands that
+// access the file system, such as :load, are disabled unless
+// cfg.AllowFileCommands is set. That setting does not affect load
+// statements, which call thread.Load: a caller that serves untrusted
+// clients must set it to nil, or to a function that loads only
+// permitted modules.
+//
+// Serve returns nil at the end of the input, or the first error from
+// reading or writing.
+func (cfg *Config) Serve(thread *starlark.Thread, globals starlark.StringDict, in io.Reader, out io.Writer) error {
+	defer redirectPrint(thread, out)()
+	s := newSession(cfg, thread, globals, out, out)
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, maxLine)
+	r := &streamReader{sc, out}
+	for {
+		if err := s.rep(r); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// streamReader is a lineReader for a pair of streams.
+type streamReader struct {
+	sc  *bufio.Scanner
+	out io.Writer
+}
+
+func (r *streamReader) readLine(prompt string) (string, error) {
+	if _, err := io.WriteString(r.out, prompt); err != nil {
+		return "", err
+	}
+	if !r.sc.Scan() {
+		if err := r.sc.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.sc.Text(), nil
+}
+
+// redirectPrint causes the Starlark print function of thread to write
+// to w, and returns a function that restores the previous behavior.
+func redirectPrint(thread *starlark.Thread, w io.Writer) (restore func()) {
+	prev := thread.Print
+	thread.Print = func(_ *starlark.Thread, msg string) { fmt.Fprintln(w, msg) }
+	return func() { thread.Print = prev }
+}
+
+// A Request is a line of input to ServeProtocol, encoded as JSON.
+type Request struct {
+	// ID, if present, is copied to the response, so that the client
+	// may match responses to requests. It may be any JSON value.
+	ID json.RawMessage `json:"id,omitempty"`
+
+	// Input is a complete item, such as an expression, a sequence of
+	// statements, or a meta-command such as ":type x".
+	// Unlike in the interactive REPL, it is not read line by line,
+	// so an indented block need not be followed by a blank line.
+	Input string `json:"input"`
+}
+
+// A Response is a line of output from ServeProtocol, encoded as JSON.
+type Response struct {
+	ID json.RawMessage `json:"id,omitempty"`
+
+	// Value and Type are the string form and type of the value of
+	// the input, if it was an expression that was evaluated without
+	// error. They are empty for statements and meta-commands.
+	Value string `json:"value,omitempty"`
+	Type  string `json:"type,omitempty"`
+
+	// Output is the text printed while handling the request,
+	// by the Starlark print function or by a meta-command.
+	Output string `json:"output,omitempty"`
+
+	// Error, if non-nil, describes why the request failed.
+	Error *ResponseError `json:"error,omitempty"`
+}
+
+// A ResponseError describes a failed request.
+type ResponseError struct {
+	Message string `json:"message"`
+
+	// Backtrace is the Starlark call stack of an evaluation error.
+	Backtrace string `json:"backtrace,omitempty"`
+}
+
+// ServeProtocol is a variant of Serve for programmatic clients. Each
+// line of input is a Request, and for each it writes one line of
+// output, a Response. Blank lines are ignored. A line that is not a
+// valid request causes an error response, not the end of the session.
+//
+// Before handling each request, ServeProtocol sets the Starlark thread
+// local variable named "context" to a context.Context that is
+// cancelled when the request is complete.
+//
+// ServeProtocol returns nil at the end of the input, or the first
+// error from reading or writing.
+func (cfg *Config) ServeProtocol(thread *starlark.Thread, globals starlark.StringDict, in io.Reader, out io.Writer) error {
+	var output bytes.Buffer
+	defer redirectPrint(thread, &output)()
+	s := newSession(cfg, thread, globals, &output, &output)
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, maxLine)
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue // blank
+		}
+		output.Reset()
+		resp := s.handle(sc.Bytes())
+		resp.Output = output.String()
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// handle executes the request encoded in line and returns the response.
+func (s *session) handle(line []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &Response{Error: &ResponseError{Message: fmt.Sprintf("invalid request: %v", err)}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.thread.SetLocal("context", ctx)
+
+	resp := &Response{ID: req.ID}
+	var err error
+	if input := strings.TrimSpace(req.Input); strings.HasPrefix(input, ":") {
+		err = s.command(input)
+	} else {
+		var v starlark.Value
+		if v, err = s.eval("<input>", []byte(req.Input)); v != nil {
+			resp.Value = v.String()
+			resp.Type = v.Type()
+		}
+	}
+	if err != nil {
+		resp.Error = &ResponseError{Message: err.Error()}
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			resp.Error.Backtrace = evalErr.Backtrace()
+		}
+	}
+	return resp
+}
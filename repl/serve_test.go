@@ -0,0 +1,146 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestServe(t *testing.T) {
+	input := `x = 1
+def f(y):
+  print("f", y)
+  return x + y
+
+f(2)
+y = 1 // 0
+:type f
+:nosuch
+`
+	var out bytes.Buffer
+	thread := new(starlark.Thread)
+	if err := new(Config).Serve(thread, starlark.StringDict{}, strings.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	if thread.Print != nil {
+		t.Error("Serve did not restore thread.Print")
+	}
+	want := `>>> >>> ... ... ... >>> f 2
+3
+>>> Traceback (most recent call last):
+  <stdin>:1: in <toplevel>
+Error: floored division by zero
+>>> function
+>>> unknown command :nosuch; try :help
+>>> `
+	if got := out.String(); got != want {
+		t.Errorf("Serve output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestServeProtocol(t *testing.T) {
+	input := `{"id": 1, "input": "x = [1, 2]"}
+{"id": "two", "input": "print(len(x))\nx"}
+
+{"input": "y = x + 1"}
+not json
+{"id": 5, "input": ":type x"}
+`
+	var out bytes.Buffer
+	if err := new(Config).ServeProtocol(new(starlark.Thread), starlark.StringDict{}, strings.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	var got []Response
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		var resp Response
+		if err := json.Unmarshal(sc.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", sc.Text(), err)
+		}
+		got = append(got, resp)
+	}
+	if len(got) != 5 {
+		t.Fatalf("got %d responses, want 5:\n%s", len(got), out.String())
+	}
+
+	if r := got[0]; string(r.ID) != "1" || r.Value != "" || r.Error != nil {
+		t.Errorf("statement: got %s", mustMarshal(r))
+	}
+	// The second input is executed as statements, not evaluated.
+	if r := got[1]; string(r.ID) != `"two"` || r.Output != "2\n" || r.Value != "" || r.Error != nil {
+		t.Errorf("print: got %s", mustMarshal(r))
+	}
+	if r := got[2]; r.ID != nil || r.Error == nil ||
+		r.Error.Message != "unknown binary op: list + int" ||
+		!strings.Contains(r.Error.Backtrace, "<input>:1: in <toplevel>") {
+		t.Errorf("error: got %s", mustMarshal(r))
+	}
+	if r := got[3]; r.Error == nil || !strings.HasPrefix(r.Error.Message, "invalid request: ") {
+		t.Errorf("invalid request: got %s", mustMarshal(r))
+	}
+	if r := got[4]; string(r.ID) != "5" || r.Output != "list\n" || r.Error != nil {
+		t.Errorf(":type: got %s", mustMarshal(r))
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// TestServeFileCommands tests that :load is refused by Serve and
+// ServeProtocol unless enabled by the Config.
+func TestServeFileCommands(t *testing.T) {
+	f, err := ioutil.TempFile("", "repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("loaded = True\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	const refused = "command :load is not permitted in this session"
+	for _, allow := range []bool{false, true} {
+		cfg := &Config{AllowFileCommands: allow}
+
+		var out bytes.Buffer
+		globals := starlark.StringDict{}
+		if err := cfg.Serve(new(starlark.Thread), globals, strings.NewReader(":load "+f.Name()+"\n"), &out); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(out.String(), refused); got == allow {
+			t.Errorf("Serve with AllowFileCommands=%t: output %q", allow, out.String())
+		}
+		if _, ok := globals["loaded"]; ok != allow {
+			t.Errorf("Serve with AllowFileCommands=%t: file loaded = %t", allow, ok)
+		}
+
+		out.Reset()
+		globals = starlark.StringDict{}
+		req := string(mustMarshal(Request{Input: ":load " + f.Name()})) + "\n"
+		if err := cfg.ServeProtocol(new(starlark.Thread), globals, strings.NewReader(req), &out); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(out.String(), refused); got == allow {
+			t.Errorf("ServeProtocol with AllowFileCommands=%t: output %q", allow, out.String())
+		}
+		if _, ok := globals["loaded"]; ok != allow {
+			t.Errorf("ServeProtocol with AllowFileCommands=%t: file loaded = %t", allow, ok)
+		}
+	}
+}
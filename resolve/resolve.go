@@ -88,6 +88,10 @@ const doesnt = "this Starlark dialect does not "
 // global options
 // These features are either not standard Starlark (yet), or deprecated
 // features of the BUILD language, so we put them behind flags.
+//
+// Deprecated: these variables affect only files parsed by the legacy
+// functions that do not accept a syntax.FileOptions, such as
+// syntax.Parse and starlark.ExecFile. Use FileOptions instead.
 var (
 	AllowNestedDef      = false // allow def statements within function bodies
 	AllowLambda         = false // allow lambda expressions
@@ -95,8 +99,25 @@ var (
 	AllowSet            = false // allow the 'set' built-in
 	AllowGlobalReassign = false // allow reassignment to globals declared in same file (deprecated)
 	AllowBitwise        = false // allow bitwise operations (&, |, ^, ~, <<, and >>)
+	AllowFString        = false // allow f-string literals
+	AllowTypes          = false // allow type annotations on def parameters and results
 )
 
+func init() {
+	syntax.LegacyFileOptions = func() *syntax.FileOptions {
+		return &syntax.FileOptions{
+			NestedDef:      AllowNestedDef,
+			Lambda:         AllowLambda,
+			Float:          AllowFloat,
+			Set:            AllowSet,
+			GlobalReassign: AllowGlobalReassign,
+			Bitwise:        AllowBitwise,
+			FString:        AllowFString,
+			Types:          AllowTypes,
+		}
+	}
+}
+
 // File resolves the specified file.
 //
 // The isPredeclared and isUniversal predicates report whether a name is
@@ -109,8 +130,19 @@ var (
 // The isUniverse predicate is supplied a parameter to avoid a cyclic
 // dependency upon starlark.Universe, not because users should ever need
 // to redefine it.
+//
+// The dialect is specified by file.Options, or by
+// syntax.LegacyFileOptions if file.Options is nil, plus any features
+// enabled by the file's pragmas, if permitted by the options.
+// On return, file.Options reflects the effective dialect.
 func File(file *syntax.File, isPredeclared, isUniversal func(name string) bool) error {
-	r := newResolver(isPredeclared, isUniversal)
+	opts := file.Options
+	if opts == nil {
+		opts = syntax.LegacyFileOptions()
+	}
+	r := newResolver(opts, isPredeclared, isUniversal)
+	r.pragmas(file.Pragmas)
+	file.Options = r.options
 	r.stmts(file.Stmts)
 
 	r.env.resolveLocalUses()
@@ -133,8 +165,17 @@ func File(file *syntax.File, isPredeclared, isUniversal func(name string) bool)
 // It returns the local variables bound within the expression.
 //
 // The isPredeclared and isUniversal predicates behave as for the File function.
+//
+// The dialect is specified by syntax.LegacyFileOptions.
+// New code should use ExprOptions.
 func Expr(expr syntax.Expr, isPredeclared, isUniversal func(name string) bool) ([]*syntax.Ident, error) {
-	r := newResolver(isPredeclared, isUniversal)
+	return ExprOptions(syntax.LegacyFileOptions(), expr, isPredeclared, isUniversal)
+}
+
+// ExprOptions resolves the specified expression using the dialect
+// specified by opts. It is otherwise equivalent to Expr.
+func ExprOptions(opts *syntax.FileOptions, expr syntax.Expr, isPredeclared, isUniversal func(name string) bool) ([]*syntax.Ident, error) {
+	r := newResolver(opts, isPredeclared, isUniversal)
 	r.expr(expr)
 	r.env.resolveLocalUses()
 	r.resolveNonLocalUses(r.env) // globals & universals
@@ -180,8 +221,9 @@ var scopeNames = [...]string{
 
 func (scope Scope) String() string { return scopeNames[scope] }
 
-func newResolver(isPredeclared, isUniversal func(name string) bool) *resolver {
+func newResolver(options *syntax.FileOptions, isPredeclared, isUniversal func(name string) bool) *resolver {
 	return &resolver{
+		options:       options,
 		env:           new(block), // module block
 		isPredeclared: isPredeclared,
 		isUniversal:   isUniversal,
@@ -190,6 +232,8 @@ func newResolver(isPredeclared, isUniversal func(name string) bool) *resolver {
 }
 
 type resolver struct {
+	options *syntax.FileOptions // dialect
+
 	// env is the current local environment:
 	// a linked list of blocks, innermost first.
 	// The tail of the list is the module block.
@@ -225,6 +269,27 @@ func (r *resolver) container() *block {
 	}
 }
 
+// pragmas enables the dialect features requested by a file's pragmas,
+// so far as they are permitted.
+func (r *resolver) pragmas(pragmas []syntax.Pragma) {
+	permitted := r.options.Permitted
+	if permitted == nil || len(pragmas) == 0 {
+		return // pragmas are ignored
+	}
+	opts := *r.options // copy
+	for _, pragma := range pragmas {
+		enable := opts.Feature(pragma.Name)
+		if enable == nil {
+			r.errorf(pragma.Pos, "unknown dialect feature %q", pragma.Name)
+		} else if !*permitted.Feature(pragma.Name) {
+			r.errorf(pragma.Pos, "dialect feature %s may not be enabled by this file", pragma.Name)
+		} else {
+			*enable = true
+		}
+	}
+	r.options = &opts
+}
+
 func (r *resolver) push(b *block) {
 	r.env.children = append(r.env.children, b)
 	b.parent = r.env
@@ -304,7 +369,7 @@ func (r *resolver) bind(id *syntax.Ident, allowRebind bool) bool {
 			// they are of the form x += y.  We can't tell
 			// statically whether it's a reassignment
 			// (e.g. int += int) or a mutation (list += list).
-			if !allowRebind && !AllowGlobalReassign {
+			if !allowRebind && !r.options.GlobalReassign {
 				r.errorf(id.NamePos, "cannot reassign global %s declared at %s", id.Name, prev.NamePos)
 			}
 			id.Index = prev.Index
@@ -349,10 +414,10 @@ func (r *resolver) useGlobal(id *syntax.Ident) binding {
 		scope = Predeclared // use of pre-declared
 	} else if r.isUniversal(id.Name) {
 		scope = Universal // use of universal name
-		if !AllowFloat && id.Name == "float" {
+		if !r.options.Float && id.Name == "float" {
 			r.errorf(id.NamePos, doesnt+"support floating point")
 		}
-		if !AllowSet && id.Name == "set" {
+		if !r.options.Set && id.Name == "set" {
 			r.errorf(id.NamePos, doesnt+"support sets")
 		}
 	} else {
@@ -389,6 +454,9 @@ func (r *resolver) stmt(stmt syntax.Stmt) {
 	case *syntax.ExprStmt:
 		r.expr(stmt.X)
 
+	case *syntax.BadStmt:
+		// already reported by the parser
+
 	case *syntax.BranchStmt:
 		if r.loops == 0 && (stmt.Token == syntax.BREAK || stmt.Token == syntax.CONTINUE) {
 			r.errorf(stmt.TokenPos, "%s not in a loop", stmt.Token)
@@ -403,7 +471,7 @@ func (r *resolver) stmt(stmt syntax.Stmt) {
 		r.stmts(stmt.False)
 
 	case *syntax.AssignStmt:
-		if !AllowBitwise {
+		if !r.options.Bitwise {
 			switch stmt.Op {
 			case syntax.AMP_EQ, syntax.PIPE_EQ, syntax.CIRCUMFLEX_EQ, syntax.LTLT_EQ, syntax.GTGT_EQ:
 				r.errorf(stmt.OpPos, doesnt+"support bitwise operations")
@@ -419,7 +487,7 @@ func (r *resolver) stmt(stmt syntax.Stmt) {
 		r.assign(stmt.LHS, isAugmented)
 
 	case *syntax.DefStmt:
-		if !AllowNestedDef && r.container().function != nil {
+		if !r.options.NestedDef && r.container().function != nil {
 			r.errorf(stmt.Def, doesnt+"support nested def")
 		}
 		const allowRebind = false
@@ -521,11 +589,22 @@ func (r *resolver) expr(e syntax.Expr) {
 	case *syntax.Ident:
 		r.use(e)
 
+	case *syntax.BadExpr:
+		// already reported by the parser
+
 	case *syntax.Literal:
-		if !AllowFloat && e.Token == syntax.FLOAT {
+		if !r.options.Float && e.Token == syntax.FLOAT {
 			r.errorf(e.TokenPos, doesnt+"support floating point")
 		}
 
+	case *syntax.FStringExpr:
+		if !r.options.FString {
+			r.errorf(e.TokenPos, doesnt+"support f-strings")
+		}
+		for _, field := range e.Fields {
+			r.expr(field.X)
+		}
+
 	case *syntax.ListExpr:
 		for _, x := range e.List {
 			r.expr(x)
@@ -596,16 +675,16 @@ func (r *resolver) expr(e syntax.Expr) {
 		}
 
 	case *syntax.UnaryExpr:
-		if !AllowBitwise && e.Op == syntax.TILDE {
+		if !r.options.Bitwise && e.Op == syntax.TILDE {
 			r.errorf(e.OpPos, doesnt+"support bitwise operations")
 		}
 		r.expr(e.X)
 
 	case *syntax.BinaryExpr:
-		if !AllowFloat && e.Op == syntax.SLASH {
+		if !r.options.Float && e.Op == syntax.SLASH {
 			r.errorf(e.OpPos, doesnt+"support floating point (use //)")
 		}
-		if !AllowBitwise {
+		if !r.options.Bitwise {
 			switch e.Op {
 			case syntax.AMP, syntax.PIPE, syntax.CIRCUMFLEX, syntax.LTLT, syntax.GTGT:
 				r.errorf(e.OpPos, doesnt+"support bitwise operations")
@@ -661,7 +740,7 @@ func (r *resolver) expr(e syntax.Expr) {
 		}
 
 	case *syntax.LambdaExpr:
-		if !AllowLambda {
+		if !r.options.Lambda {
 			r.errorf(e.Lambda, doesnt+"support lambda")
 		}
 		r.function(e.Lambda, "lambda", &e.Function)
@@ -682,6 +761,21 @@ func (r *resolver) function(pos syntax.Position, name string, function *syntax.F
 		}
 	}
 
+	// Resolve type annotations in enclosing environment.
+	if function.ParamTypes != nil || function.ResultType != nil {
+		if !r.options.Types {
+			r.errorf(pos, doesnt+"support type annotations")
+		}
+		for _, t := range function.ParamTypes {
+			if t != nil {
+				r.annotation(t)
+			}
+		}
+		if function.ResultType != nil {
+			r.annotation(function.ResultType)
+		}
+	}
+
 	// Enter function block.
 	b := &block{function: function}
 	r.push(b)
@@ -750,6 +844,51 @@ func (r *resolver) function(pos syntax.Position, name string, function *syntax.F
 	// resolved until the end of the module.
 }
 
+// annotation resolves a type annotation.
+// An annotation is a name (int), a qualified name (mod.T),
+// a generic type (list[str], dict[str, int]), a union of
+// annotations (int | None), or a string literal, which is not checked.
+func (r *resolver) annotation(e syntax.Expr) {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		r.use(e)
+
+	case *syntax.DotExpr:
+		if _, ok := e.X.(*syntax.Ident); !ok {
+			r.errorf(e.Dot, "invalid type annotation")
+			return
+		}
+		r.annotation(e.X)
+
+	case *syntax.IndexExpr:
+		r.annotation(e.X)
+		if tuple, ok := e.Y.(*syntax.TupleExpr); ok {
+			for _, elem := range tuple.List {
+				r.annotation(elem)
+			}
+		} else {
+			r.annotation(e.Y)
+		}
+
+	case *syntax.BinaryExpr:
+		if e.Op != syntax.PIPE {
+			r.errorf(e.OpPos, "invalid type annotation")
+			return
+		}
+		r.annotation(e.X)
+		r.annotation(e.Y)
+
+	case *syntax.Literal:
+		if e.Token != syntax.STRING {
+			r.errorf(e.TokenPos, "invalid type annotation")
+		}
+
+	default:
+		start, _ := e.Span()
+		r.errorf(start, "invalid type annotation")
+	}
+}
+
 func (r *resolver) resolveNonLocalUses(b *block) {
 	// First resolve inner blocks.
 	for _, child := range b.children {
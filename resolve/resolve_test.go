@@ -17,19 +17,23 @@ import (
 func TestResolve(t *testing.T) {
 	filename := starlarktest.DataFile("resolve", "testdata/resolve.star")
 	for _, chunk := range chunkedfile.Read(filename, t) {
-		f, err := syntax.Parse(filename, chunk.Source, 0)
+		// A chunk may set options by containing e.g. "option:float".
+		opts := &syntax.FileOptions{
+			NestedDef:      option(chunk.Source, "nesteddef"),
+			Lambda:         option(chunk.Source, "lambda"),
+			Float:          option(chunk.Source, "float"),
+			Set:            option(chunk.Source, "set"),
+			GlobalReassign: option(chunk.Source, "global_reassign"),
+			FString:        option(chunk.Source, "fstring"),
+			Types:          option(chunk.Source, "types"),
+		}
+
+		f, err := opts.Parse(filename, chunk.Source, 0)
 		if err != nil {
 			t.Error(err)
 			continue
 		}
 
-		// A chunk may set options by containing e.g. "option:float".
-		resolve.AllowNestedDef = option(chunk.Source, "nesteddef")
-		resolve.AllowLambda = option(chunk.Source, "lambda")
-		resolve.AllowFloat = option(chunk.Source, "float")
-		resolve.AllowSet = option(chunk.Source, "set")
-		resolve.AllowGlobalReassign = option(chunk.Source, "global_reassign")
-
 		if err := resolve.File(f, isPredeclared, isUniversal); err != nil {
 			for _, err := range err.(resolve.ErrorList) {
 				chunk.GotError(int(err.Pos.Line), err.Msg)
@@ -80,6 +84,37 @@ func TestLambdaVarargsAndKwargsSet(t *testing.T) {
 	}
 }
 
+func TestPragmas(t *testing.T) {
+	const lambda = "# starlark: lambda\nf = lambda: 0\n"
+	for _, test := range []struct {
+		src       string
+		permitted *syntax.FileOptions
+		want      string // error, or "" for success
+	}{
+		{lambda, nil, "dialect does not support lambda"}, // pragmas ignored
+		{lambda, &syntax.FileOptions{Lambda: true}, ""},
+		{lambda, syntax.AllFeatures(), ""},
+		{lambda, &syntax.FileOptions{Float: true}, "dialect feature lambda may not be enabled by this file"},
+		{"# starlark: lambada\n", &syntax.FileOptions{}, `unknown dialect feature "lambada"`},
+	} {
+		opts := &syntax.FileOptions{Permitted: test.permitted}
+		f, err := opts.Parse("foo.star", test.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resolve.File(f, isPredeclared, isUniversal)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.src, err)
+			} else if !f.Options.Lambda || opts.Lambda {
+				t.Errorf("%q: pragma did not enable lambda in File.Options only", test.src)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
 func isPredeclared(name string) bool { return name == "M" }
 
 func isUniversal(name string) bool { return name == "U" || name == "float" }
@@ -43,6 +43,13 @@ type Thread struct {
 	// See example_test.go for some example implementations of Load.
 	Load func(thread *Thread, module string) (StringDict, error)
 
+	// CheckTypes enables dynamic checking of type annotations.
+	// If set, a call to a function whose parameters or result are
+	// annotated with the names of built-in types, such as int, str,
+	// or list, fails if an argument or the result has another type.
+	// Annotations that do not name built-in types are not checked.
+	CheckTypes bool
+
 	// locals holds arbitrary "thread-local" Go values belonging to the client.
 	// They are accessible to the client but not to any Starlark program.
 	locals map[string]interface{}
@@ -208,6 +215,10 @@ func (prog *Program) Load(i int) (string, syntax.Position) {
 	return id.Name, id.Pos
 }
 
+// Options returns the dialect with which the program was compiled.
+// The result must not be modified.
+func (prog *Program) Options() *syntax.FileOptions { return prog.compiled.Options }
+
 // WriteTo writes the compiled module to the specified output stream.
 func (prog *Program) Write(out io.Writer) error { return prog.compiled.Write(out) }
 
@@ -228,9 +239,18 @@ func (prog *Program) Write(out io.Writer) error { return prog.compiled.Write(out
 //
 // If ExecFile fails during evaluation, it returns an *EvalError
 // containing a backtrace.
+//
+// The file is executed using the options returned by
+// syntax.LegacyFileOptions. New code should use ExecFileOptions.
 func ExecFile(thread *Thread, filename string, src interface{}, predeclared StringDict) (StringDict, error) {
+	return ExecFileOptions(syntax.LegacyFileOptions(), thread, filename, src, predeclared)
+}
+
+// ExecFileOptions is a variant of ExecFile that executes a file
+// of the dialect specified by opts.
+func ExecFileOptions(opts *syntax.FileOptions, thread *Thread, filename string, src interface{}, predeclared StringDict) (StringDict, error) {
 	// Parse, resolve, and compile a Starlark source file.
-	_, mod, err := SourceProgram(filename, src, predeclared.Has)
+	_, mod, err := SourceProgramOptions(opts, filename, src, predeclared.Has)
 	if err != nil {
 		return nil, err
 	}
@@ -249,8 +269,19 @@ func ExecFile(thread *Thread, filename string, src interface{}, predeclared Stri
 // a pre-declared identifier of the current module.
 // Its typical value is predeclared.Has,
 // where predeclared is a StringDict of pre-declared values.
+//
+// The file is compiled using the options returned by
+// syntax.LegacyFileOptions. New code should use SourceProgramOptions.
 func SourceProgram(filename string, src interface{}, isPredeclared func(string) bool) (*syntax.File, *Program, error) {
-	f, err := syntax.Parse(filename, src, 0)
+	return SourceProgramOptions(syntax.LegacyFileOptions(), filename, src, isPredeclared)
+}
+
+// SourceProgramOptions is a variant of SourceProgram that compiles a
+// file of the dialect specified by opts.
+// The effective options, including any features enabled by the file's
+// pragmas, are recorded in the compiled program.
+func SourceProgramOptions(opts *syntax.FileOptions, filename string, src interface{}, isPredeclared func(string) bool) (*syntax.File, *Program, error) {
+	f, err := opts.Parse(filename, src, 0)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -259,7 +290,7 @@ func SourceProgram(filename string, src interface{}, isPredeclared func(string)
 		return f, nil, err
 	}
 
-	compiled := compile.File(f.Stmts, f.Locals, f.Globals)
+	compiled := compile.File(f.Options, f.Stmts, f.Locals, f.Globals)
 
 	return f, &Program{compiled}, nil
 }
@@ -299,6 +330,8 @@ func makeToplevelFunction(funcode *compile.Funcode, predeclared StringDict) *Fun
 			v = Int{c}
 		case string:
 			v = String(c)
+		case compile.Bytes:
+			v = Bytes(c)
 		case float64:
 			v = Float(c)
 		default:
@@ -325,18 +358,27 @@ func makeToplevelFunction(funcode *compile.Funcode, predeclared StringDict) *Fun
 //
 // If Eval fails during evaluation, it returns an *EvalError
 // containing a backtrace.
+//
+// The expression is evaluated using the options returned by
+// syntax.LegacyFileOptions. New code should use EvalOptions.
 func Eval(thread *Thread, filename string, src interface{}, env StringDict) (Value, error) {
+	return EvalOptions(syntax.LegacyFileOptions(), thread, filename, src, env)
+}
+
+// EvalOptions is a variant of Eval that evaluates an expression
+// of the dialect specified by opts.
+func EvalOptions(opts *syntax.FileOptions, thread *Thread, filename string, src interface{}, env StringDict) (Value, error) {
 	expr, err := syntax.ParseExpr(filename, src, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	locals, err := resolve.Expr(expr, env.Has, Universe.Has)
+	locals, err := resolve.ExprOptions(opts, expr, env.Has, Universe.Has)
 	if err != nil {
 		return nil, err
 	}
 
-	fn := makeToplevelFunction(compile.Expr(expr, locals), env)
+	fn := makeToplevelFunction(compile.Expr(opts, expr, locals), env)
 
 	return Call(thread, fn, nil, nil)
 }
@@ -472,6 +514,10 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 			if y, ok := y.(String); ok {
 				return x + y, nil
 			}
+		case Bytes:
+			if y, ok := y.(Bytes); ok {
+				return x + y, nil
+			}
 		case Int:
 			switch y := y.(type) {
 			case Int:
@@ -533,6 +579,10 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 			case Int:
 				return x - y.Float(), nil
 			}
+		case *Set: // difference
+			if y, ok := y.(*Set); ok {
+				return x.difference(y), nil
+			}
 		}
 
 	case syntax.STAR:
@@ -550,6 +600,13 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 					}
 					return String(strings.Repeat(string(y), i)), nil
 				}
+			case Bytes:
+				if i, err := AsInt32(x); err == nil {
+					if i < 1 {
+						return Bytes(""), nil
+					}
+					return Bytes(strings.Repeat(string(y), i)), nil
+				}
 			case *List:
 				if i, err := AsInt32(x); err == nil {
 					return NewList(repeat(y.elems, i)), nil
@@ -575,6 +632,15 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 					return String(strings.Repeat(string(x), i)), nil
 				}
 			}
+		case Bytes:
+			if y, ok := y.(Int); ok {
+				if i, err := AsInt32(y); err == nil {
+					if i < 1 {
+						return Bytes(""), nil
+					}
+					return Bytes(strings.Repeat(string(x), i)), nil
+				}
+			}
 		case *List:
 			if y, ok := y.(Int); ok {
 				if i, err := AsInt32(y); err == nil {
@@ -726,6 +792,18 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 				return nil, fmt.Errorf("'in <string>' requires string as left operand, not %s", x.Type())
 			}
 			return Bool(strings.Contains(string(y), string(needle))), nil
+		case Bytes:
+			switch needle := x.(type) {
+			case Bytes:
+				return Bool(strings.Contains(string(y), string(needle))), nil
+			case Int:
+				b, err := AsInt32(needle)
+				if err != nil || b < 0 || b > 0xff {
+					return nil, fmt.Errorf("'in <bytes>' requires an int in range [0, 255] as left operand, not %s", needle)
+				}
+				return Bool(strings.IndexByte(string(y), byte(b)) >= 0), nil
+			}
+			return nil, fmt.Errorf("'in <bytes>' requires bytes or int as left operand, not %s", x.Type())
 		case rangeValue:
 			i, err := NumberToInt(x)
 			if err != nil {
@@ -756,17 +834,7 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 			}
 		case *Set: // intersection
 			if y, ok := y.(*Set); ok {
-				set := new(Set)
-				if x.Len() > y.Len() {
-					x, y = y, x // opt: range over smaller set
-				}
-				for _, xelem := range x.elems() {
-					// Has, Insert cannot fail here.
-					if found, _ := y.Has(xelem); found {
-						set.Insert(xelem)
-					}
-				}
-				return set, nil
+				return x.intersection(y), nil
 			}
 		}
 
@@ -778,18 +846,7 @@ func Binary(op syntax.Token, x, y Value) (Value, error) {
 			}
 		case *Set: // symmetric difference
 			if y, ok := y.(*Set); ok {
-				set := new(Set)
-				for _, xelem := range x.elems() {
-					if found, _ := y.Has(xelem); !found {
-						set.Insert(xelem)
-					}
-				}
-				for _, yelem := range y.elems() {
-					if found, _ := x.Has(yelem); !found {
-						set.Insert(yelem)
-					}
-				}
-				return set, nil
+				return x.symmetricDifference(y), nil
 			}
 		}
 
@@ -981,7 +1038,8 @@ func asIndex(v Value, len int, result *int) error {
 
 // setArgs sets the values of the formal parameters of function fn in
 // based on the actual parameter values in args and kwargs.
-func setArgs(locals []Value, fn *Function, args Tuple, kwargs []Tuple) error {
+// If checkTypes, it also checks them against the parameter annotations.
+func setArgs(locals []Value, fn *Function, args Tuple, kwargs []Tuple, checkTypes bool) error {
 	cond := func(x bool, y, z interface{}) interface{} {
 		if x {
 			return y
@@ -1087,9 +1145,87 @@ func setArgs(locals []Value, fn *Function, args Tuple, kwargs []Tuple) error {
 	} else if nactual := len(args) + len(kwargs); nactual > 0 {
 		return fmt.Errorf("function %s takes no arguments (%d given)", fn.Name(), nactual)
 	}
+
+	if checkTypes && fn.funcode.ParamTypes != nil {
+		return checkArgTypes(locals, fn)
+	}
+	return nil
+}
+
+// checkArgTypes checks the values of the formal parameters of function
+// fn against their type annotations. The annotation of *args or
+// **kwargs applies to each of its elements.
+func checkArgTypes(locals []Value, fn *Function) error {
+	varargs, kwargs := -1, -1
+	if fn.HasKwargs() {
+		kwargs = fn.NumParams() - 1
+	}
+	if fn.HasVarargs() {
+		varargs = fn.NumParams() - 1
+		if fn.HasKwargs() {
+			varargs--
+		}
+	}
+
+	for i, want := range fn.funcode.ParamTypes {
+		if len(want) == 0 {
+			continue
+		}
+		name := fn.funcode.Locals[i].Name
+		switch i {
+		case varargs:
+			for j, x := range locals[i].(Tuple) {
+				if !hasType(x, want) {
+					return typeError(fn, fmt.Sprintf("%s[%d]", name, j), x, want)
+				}
+			}
+		case kwargs:
+			for _, item := range locals[i].(*Dict).Items() {
+				if !hasType(item[1], want) {
+					return typeError(fn, fmt.Sprintf("%s[%s]", name, item[0]), item[1], want)
+				}
+			}
+		default:
+			if !hasType(locals[i], want) {
+				return typeError(fn, name, locals[i], want)
+			}
+		}
+	}
 	return nil
 }
 
+func typeError(fn *Function, param string, x Value, want []string) error {
+	return fmt.Errorf("function %s: parameter %s has type %s, want %s",
+		fn.Name(), param, x.Type(), strings.Join(want, " | "))
+}
+
+// builtinTypes maps the name of each built-in type, as used in a type
+// annotation, to the Type of its values.
+var builtinTypes = map[string]string{
+	"None":  "NoneType",
+	"bool":  "bool",
+	"bytes": "bytes",
+	"dict":  "dict",
+	"float": "float",
+	"int":   "int",
+	"list":  "list",
+	"set":   "set",
+	"str":   "string",
+	"tuple": "tuple",
+}
+
+// hasType reports whether x has one of the built-in types named by
+// want. A name that does not denote a built-in type, such as len,
+// matches any value.
+func hasType(x Value, want []string) bool {
+	for _, name := range want {
+		if t, ok := builtinTypes[name]; !ok || x.Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
 func findParam(params []compile.Ident, name string) int {
 	for i, param := range params {
 		if param.Name == name {
@@ -1147,6 +1283,43 @@ func interpolate(format string, x Value) (Value, error) {
 	var buf bytes.Buffer
 	path := make([]Value, 0, 4)
 	index := 0
+
+	// next returns the next positional argument.
+	next := func() (Value, error) {
+		if tuple, ok := x.(Tuple); ok {
+			if index >= len(tuple) {
+				return nil, fmt.Errorf("not enough arguments for format string")
+			}
+			index++
+			return tuple[index-1], nil
+		} else if index > 0 {
+			return nil, fmt.Errorf("not enough arguments for format string")
+		}
+		index++
+		return x, nil
+	}
+
+	// nextInt returns the next positional argument, which must be an int,
+	// for the width or precision of a conversion.
+	nextInt := func(what string) (int, error) {
+		if _, ok := x.(Mapping); ok {
+			return 0, fmt.Errorf("format requires a tuple for %s, not a mapping", what)
+		}
+		v, err := next()
+		if err != nil {
+			return 0, err
+		}
+		i, ok := v.(Int)
+		if !ok {
+			return 0, fmt.Errorf("%s wants int, not %s", what, v.Type())
+		}
+		n, err := AsInt32(i)
+		if err != nil || n > maxFormatWidth || n < -maxFormatWidth {
+			return 0, fmt.Errorf("%s argument out of range", what)
+		}
+		return n, nil
+	}
+
 	for {
 		i := strings.IndexByte(format, '%')
 		if i < 0 {
@@ -1179,88 +1352,139 @@ func interpolate(format string, x Value) (Value, error) {
 				return nil, fmt.Errorf("key not found: %s", key)
 			}
 			format = format[j+1:]
+		}
+
+		// flags: [#0- +]
+		spec := &formatSpec{fill: ' ', prec: -1, printf: true}
+		for ; format != "" && strings.IndexByte("#0- +", format[0]) >= 0; format = format[1:] {
+			switch c := format[0]; c {
+			case '#':
+				spec.alt = true
+			case '0':
+				spec.zero = true
+			case '-':
+				spec.align = '<'
+			case '+':
+				spec.sign = '+'
+			case ' ':
+				if spec.sign == 0 {
+					spec.sign = ' '
+				}
+			}
+		}
+		if spec.align == '<' {
+			spec.zero = false // '-' overrides '0'
+		}
+
+		// minimum field width: a number, or * to take it from the arguments.
+		if format != "" && format[0] == '*' {
+			w, err := nextInt("*")
+			if err != nil {
+				return nil, err
+			}
+			if w < 0 {
+				spec.align, spec.zero, w = '<', false, -w
+			}
+			spec.width = w
+			format = format[1:]
 		} else {
-			// positional argument: %s.
-			if tuple, ok := x.(Tuple); ok {
-				if index >= len(tuple) {
-					return nil, fmt.Errorf("not enough arguments for format string")
+			var err error
+			if spec.width, format, err = parseFormatNumber(format); err != nil {
+				return nil, err
+			}
+		}
+
+		// precision: .number, or .* to take it from the arguments.
+		if format != "" && format[0] == '.' {
+			format = format[1:]
+			if format != "" && format[0] == '*' {
+				p, err := nextInt(".*")
+				if err != nil {
+					return nil, err
 				}
-				arg = tuple[index]
-			} else if index > 0 {
-				return nil, fmt.Errorf("not enough arguments for format string")
+				spec.prec = p
+				if p < 0 {
+					spec.prec = 0
+				}
+				format = format[1:]
 			} else {
-				arg = x
+				var err error
+				if spec.prec, format, err = parseFormatNumber(format); err != nil {
+					return nil, err
+				}
 			}
 		}
 
-		// NOTE: Starlark does not support any of these optional Python features:
-		// - optional conversion flags: [#0- +], etc.
-		// - optional minimum field width (number or *).
-		// - optional precision (.123 or *)
-		// - optional length modifier
+		// optional length modifier, ignored as in Python.
+		if format != "" && strings.IndexByte("hlL", format[0]) >= 0 {
+			format = format[1:]
+		}
 
 		// conversion type
 		if format == "" {
 			return nil, fmt.Errorf("incomplete format")
 		}
+		if arg == nil && format[0] != '%' {
+			var err error
+			if arg, err = next(); err != nil {
+				return nil, err
+			}
+		}
 		switch c := format[0]; c {
-		case 's', 'r':
-			if str, ok := AsString(arg); ok && c == 's' {
-				buf.WriteString(str)
+		case 's', 'r', 'c':
+			// Strings are right-aligned by default, and ignore sign, '#', and '0'.
+			spec = &formatSpec{fill: ' ', align: spec.align, width: spec.width, prec: spec.prec}
+			if spec.align == 0 {
+				spec.align = '>'
+			}
+			var str string
+			if c == 'c' {
+				switch arg := arg.(type) {
+				case Int:
+					// chr(int)
+					r, err := AsInt32(arg)
+					if err != nil || r < 0 || r > unicode.MaxRune {
+						return nil, fmt.Errorf("%%c format requires a valid Unicode code point, got %s", arg)
+					}
+					str = string(rune(r))
+				case String:
+					r, size := utf8.DecodeRuneInString(string(arg))
+					if size != len(arg) {
+						return nil, fmt.Errorf("%%c format requires a single-character string")
+					}
+					str = string(r)
+				default:
+					return nil, fmt.Errorf("%%c format requires int or single-character string, not %s", arg.Type())
+				}
+				spec.prec = -1
+			} else if s, ok := AsString(arg); ok && c == 's' {
+				str = s
 			} else {
-				writeValue(&buf, arg, path)
+				var repr bytes.Buffer
+				writeValue(&repr, arg, path)
+				str = repr.String()
+			}
+			if err := spec.formatString(&buf, str); err != nil {
+				return nil, err
 			}
 		case 'd', 'i', 'o', 'x', 'X':
 			i, err := NumberToInt(arg)
 			if err != nil {
 				return nil, fmt.Errorf("%%%c format requires integer: %v", c, err)
 			}
-			switch c {
-			case 'd', 'i':
-				buf.WriteString(i.bigint.Text(10))
-			case 'o':
-				buf.WriteString(i.bigint.Text(8))
-			case 'x':
-				buf.WriteString(i.bigint.Text(16))
-			case 'X':
-				buf.WriteString(strings.ToUpper(i.bigint.Text(16)))
+			if c == 'i' {
+				c = 'd'
+			}
+			if err := spec.formatInt(&buf, i, c); err != nil {
+				return nil, err
 			}
 		case 'e', 'f', 'g', 'E', 'F', 'G':
 			f, ok := AsFloat(arg)
 			if !ok {
 				return nil, fmt.Errorf("%%%c format requires float, not %s", c, arg.Type())
 			}
-			switch c {
-			case 'e':
-				fmt.Fprintf(&buf, "%e", f)
-			case 'f':
-				fmt.Fprintf(&buf, "%f", f)
-			case 'g':
-				fmt.Fprintf(&buf, "%g", f)
-			case 'E':
-				fmt.Fprintf(&buf, "%E", f)
-			case 'F':
-				fmt.Fprintf(&buf, "%F", f)
-			case 'G':
-				fmt.Fprintf(&buf, "%G", f)
-			}
-		case 'c':
-			switch arg := arg.(type) {
-			case Int:
-				// chr(int)
-				r, err := AsInt32(arg)
-				if err != nil || r < 0 || r > unicode.MaxRune {
-					return nil, fmt.Errorf("%%c format requires a valid Unicode code point, got %s", arg)
-				}
-				buf.WriteRune(rune(r))
-			case String:
-				r, size := utf8.DecodeRuneInString(string(arg))
-				if size != len(arg) {
-					return nil, fmt.Errorf("%%c format requires a single-character string")
-				}
-				buf.WriteRune(r)
-			default:
-				return nil, fmt.Errorf("%%c format requires int or single-character string, not %s", arg.Type())
+			if err := spec.formatFloat(&buf, f, c); err != nil {
+				return nil, err
 			}
 		case '%':
 			buf.WriteByte('%')
@@ -1268,7 +1492,6 @@ func interpolate(format string, x Value) (Value, error) {
 			return nil, fmt.Errorf("unknown conversion %%%c", c)
 		}
 		format = format[1:]
-		index++
 	}
 
 	if tuple, ok := x.(Tuple); ok && index < len(tuple) {
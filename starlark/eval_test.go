@@ -26,6 +26,8 @@ func init() {
 	resolve.AllowFloat = true
 	resolve.AllowSet = true
 	resolve.AllowBitwise = true
+	resolve.AllowFString = true
+	resolve.AllowTypes = true
 }
 
 func TestEvalExpr(t *testing.T) {
@@ -100,9 +102,11 @@ func TestExecFile(t *testing.T) {
 		"testdata/assign.star",
 		"testdata/bool.star",
 		"testdata/builtins.star",
+		"testdata/bytes.star",
 		"testdata/control.star",
 		"testdata/dict.star",
 		"testdata/float.star",
+		"testdata/fstring.star",
 		"testdata/function.star",
 		"testdata/int.star",
 		"testdata/list.star",
@@ -313,6 +317,67 @@ def f(a, b=42, *args, **kwargs):
 	}
 }
 
+// TestCheckTypes exercises the dynamic checking of type annotations.
+func TestCheckTypes(t *testing.T) {
+	const filename = "types.go"
+	const src = `
+def a(x: int, y: str = "", *args: int | float, **kwargs: list) -> str:
+	return y * x
+def b(x: list[int], y: "unchecked", z: len) -> int | None:
+	return x[0] if x else None
+def c(x) -> bool:
+	if x:
+		return x
+def d(x: Foo) -> Foo:
+	return x
+Foo = list
+`
+
+	thread := &starlark.Thread{CheckTypes: true}
+	globals, err := starlark.ExecFile(thread, filename, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		src, want string
+		unchecked string // result if !CheckTypes, if different
+	}{
+		{`a(2, "ab")`, `"abab"`, ""},
+		{`a("2", "ab")`, `function a: parameter x has type string, want int`, `unknown binary op: string * string`},
+		{`a(2, y=None)`, `function a: parameter y has type NoneType, want str`, `unknown binary op: NoneType * int`},
+		{`a(1, "", 1, 2.0)`, `""`, ""},
+		{`a(1, "", 1, "2")`, `function a: parameter args[1] has type string, want int | float`, `""`},
+		{`a(1, k=[])`, `""`, ""},
+		{`a(1, k={})`, `function a: parameter kwargs["k"] has type dict, want list`, `""`},
+		{`b([1], 1, 2)`, `1`, ""},
+		{`b([], None, None)`, `None`, ""},
+		{`b(["x"], 1, 2)`, `function b returned string, want int | None`, `"x"`},
+		{`b((1,), 1, 2)`, `function b: parameter x has type tuple, want list`, `1`},
+		{`c(True)`, `True`, ""},
+		{`c(1)`, `function c returned int, want bool`, `1`},
+		{`c(0)`, `function c returned NoneType, want bool`, `None`},
+		{`d(1)`, `1`, ""}, // annotations that are not built-in names are not checked
+	} {
+		for _, check := range []bool{true, false} {
+			want := test.want
+			if !check && test.unchecked != "" {
+				want = test.unchecked
+			}
+			thread.CheckTypes = check
+			var got string
+			if v, err := starlark.Eval(thread, "<expr>", test.src, globals); err != nil {
+				got = err.Error()
+			} else {
+				got = v.String()
+			}
+			if got != want {
+				t.Errorf("eval %s (CheckTypes=%t) = %s, want %s", test.src, check, got, want)
+			}
+		}
+	}
+}
+
 // TestPrint ensures that the Starlark print function calls
 // Thread.Print, if provided.
 func TestPrint(t *testing.T) {
@@ -474,6 +539,89 @@ func TestRepeatedExec(t *testing.T) {
 	}
 }
 
+// TestFileOptions tests that files of different dialects may be
+// executed side by side, and that a compiled program records its dialect.
+func TestFileOptions(t *testing.T) {
+	const src = "f = lambda x: x + 1\ny = f(1)\n"
+	thread := new(starlark.Thread)
+
+	// The standard dialect rejects lambda, regardless of the globals.
+	std := new(syntax.FileOptions)
+	if _, err := starlark.ExecFileOptions(std, thread, "std.star", src, nil); err == nil {
+		t.Errorf("standard dialect accepted lambda")
+	} else if want := "dialect does not support lambda"; !strings.Contains(err.Error(), want) {
+		t.Errorf("standard dialect: got error %v, want %q", err, want)
+	}
+
+	ext := &syntax.FileOptions{Lambda: true}
+	_, prog, err := starlark.SourceProgramOptions(ext, "ext.star", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prog.Options(); *got != *ext {
+		t.Errorf("Options() = %+v, want %+v", *got, *ext)
+	}
+
+	// The options survive serialization.
+	var buf bytes.Buffer
+	if err := prog.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	prog2, err := starlark.CompiledProgram(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prog2.Options(); *got != *ext {
+		t.Errorf("after serialization, Options() = %+v, want %+v", *got, *ext)
+	}
+	globals, err := prog2.Init(thread, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := globals["y"].String(); got != "2" {
+		t.Errorf("y = %s, want 2", got)
+	}
+}
+
+// TestFunctionDoc tests that a function's docstring is available
+// at run time, including after serialization of the program.
+func TestFunctionDoc(t *testing.T) {
+	const src = `
+def f():
+    """Returns one.
+
+    Really."""
+    return 1
+
+def g():
+    return "not a docstring"
+`
+	_, prog, err := starlark.SourceProgram("doc.star", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := prog.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	prog2, err := starlark.CompiledProgram(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prog := range []*starlark.Program{prog, prog2} {
+		globals, err := prog.Init(new(starlark.Thread), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := globals["f"].(*starlark.Function).Doc(), "Returns one.\n\n    Really."; got != want {
+			t.Errorf("f.Doc() = %q, want %q", got, want)
+		}
+		if got := globals["g"].(*starlark.Function).Doc(); got != "" {
+			t.Errorf("g.Doc() = %q, want empty", got)
+		}
+	}
+}
+
 // TestUnpackUserDefined tests that user-defined
 // implementations of starlark.Value may be unpacked.
 func TestUnpackUserDefined(t *testing.T) {
@@ -0,0 +1,438 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlark
+
+// This file defines the format specification mini-language shared by
+// str.format and the % operator.
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// formatField appends to buf the value x formatted according to the
+// conversion conv ("s", "r", or "" if absent) and format specification
+// spec of a str.format replacement field or f-string field.
+func formatField(buf *bytes.Buffer, x Value, conv, spec string, path []Value) error {
+	if spec == "" {
+		if str, ok := AsString(x); ok && conv != "r" {
+			buf.WriteString(str)
+		} else {
+			writeValue(buf, x, path)
+		}
+		return nil
+	}
+	s, err := parseFormatSpec(spec)
+	if err != nil {
+		return err
+	}
+	// An explicit conversion yields a string, to which the spec applies.
+	if _, ok := AsString(x); conv == "r" || conv == "s" && !ok {
+		var str bytes.Buffer
+		writeValue(&str, x, path)
+		x = String(str.String())
+	}
+	return s.format(buf, x, path)
+}
+
+// A formatSpec is a parsed format specification, which controls how a
+// single value is converted to text by str.format ("{:spec}") or by
+// string interpolation ("%spec").
+//
+// The syntax accepted by parseFormatSpec is that of Python's
+// format_spec:
+//
+// 	[[fill]align][sign][#][0][width][grouping][.precision][type]
+//
+type formatSpec struct {
+	fill     rune // padding character
+	fillSet  bool // fill was specified explicitly
+	align    byte // one of "<>=^", or 0 for the default
+	sign     byte // one of "+- ", or 0 for the default
+	alt      bool // '#': alternate form
+	zero     bool // '0': pad numbers with zeros after the sign
+	width    int  // minimum field width, in runes
+	grouping byte // thousands separator, ',' or '_', or 0 for none
+	prec     int  // precision, or -1 for the default
+	verb     byte // presentation type, or 0 for the default
+
+	// printf reports that the specification came from a % conversion,
+	// in which the precision of an integer is its minimum number of digits.
+	printf bool
+}
+
+// parseFormatSpec parses the format specification of a str.format field.
+func parseFormatSpec(spec string) (*formatSpec, error) {
+	s := &formatSpec{fill: ' ', prec: -1}
+	orig := spec
+
+	// [[fill]align]
+	if r, size := utf8.DecodeRuneInString(spec); size < len(spec) && isAlign(spec[size]) {
+		s.fill, s.fillSet, s.align = r, true, spec[size]
+		spec = spec[size+1:]
+	} else if spec != "" && isAlign(spec[0]) {
+		s.align = spec[0]
+		spec = spec[1:]
+	}
+
+	// [sign][#][0]
+	if spec != "" && strings.IndexByte("+- ", spec[0]) >= 0 {
+		s.sign = spec[0]
+		spec = spec[1:]
+	}
+	if spec != "" && spec[0] == '#' {
+		s.alt = true
+		spec = spec[1:]
+	}
+	if spec != "" && spec[0] == '0' {
+		s.zero = true
+		spec = spec[1:]
+	}
+
+	// [width]
+	var err error
+	if s.width, spec, err = parseFormatNumber(spec); err != nil {
+		return nil, fmt.Errorf("invalid format specifier %q: %v", orig, err)
+	}
+
+	// [grouping]
+	if spec != "" && (spec[0] == ',' || spec[0] == '_') {
+		s.grouping = spec[0]
+		spec = spec[1:]
+	}
+
+	// [.precision]
+	if spec != "" && spec[0] == '.' {
+		if len(spec) == 1 || !isdigit(spec[1]) {
+			return nil, fmt.Errorf("format specifier missing precision")
+		}
+		if s.prec, spec, err = parseFormatNumber(spec[1:]); err != nil {
+			return nil, fmt.Errorf("invalid format specifier %q: %v", orig, err)
+		}
+	}
+
+	// [type]
+	switch len(spec) {
+	case 0:
+	case 1:
+		s.verb = spec[0]
+	default:
+		return nil, fmt.Errorf("invalid format specifier %q", orig)
+	}
+	return s, nil
+}
+
+// maxFormatWidth bounds field widths and precisions,
+// so that a small format string cannot allocate a huge result.
+const maxFormatWidth = 1 << 20
+
+// parseFormatNumber parses the optional decimal number at the start of
+// spec, returning it and the remainder of spec.
+func parseFormatNumber(spec string) (int, string, error) {
+	i := 0
+	for i < len(spec) && isdigit(spec[i]) {
+		i++
+	}
+	if i == 0 {
+		return 0, spec, nil
+	}
+	n, err := strconv.Atoi(spec[:i])
+	if err != nil || n > maxFormatWidth {
+		return 0, "", fmt.Errorf("too many decimal digits in format string")
+	}
+	return n, spec[i:], nil
+}
+
+func isAlign(c byte) bool { return c == '<' || c == '>' || c == '=' || c == '^' }
+
+func isdigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// format appends to buf the text of x formatted according to s.
+func (s *formatSpec) format(buf *bytes.Buffer, x Value, path []Value) error {
+	if s.grouping != 0 && s.verb == 'n' {
+		return fmt.Errorf("cannot specify '%c' with 'n'", s.grouping)
+	}
+	switch s.verb {
+	case 0:
+		switch x := x.(type) {
+		case Int:
+			return s.formatInt(buf, x, 'd')
+		case Float:
+			return s.formatFloat(buf, float64(x), 'g')
+		case String:
+			return s.formatString(buf, string(x))
+		}
+		var str bytes.Buffer
+		writeValue(&str, x, path)
+		return s.formatString(buf, str.String())
+
+	case 's':
+		if str, ok := x.(String); ok {
+			return s.formatString(buf, string(str))
+		}
+
+	case 'b', 'c', 'd', 'o', 'x', 'X', 'n':
+		if i, ok := x.(Int); ok {
+			return s.formatInt(buf, i, s.verb)
+		}
+
+	case 'e', 'E', 'f', 'F', 'g', 'G', '%':
+		switch x := x.(type) {
+		case Int:
+			f, ok := AsFloat(x)
+			if !ok {
+				return fmt.Errorf("int too large to convert to float")
+			}
+			return s.formatFloat(buf, f, s.verb)
+		case Float:
+			return s.formatFloat(buf, float64(x), s.verb)
+		}
+	}
+	return fmt.Errorf("unknown format code %q for %s", s.verb, x.Type())
+}
+
+// formatString appends a string formatted according to s.
+func (s *formatSpec) formatString(buf *bytes.Buffer, str string) error {
+	switch {
+	case s.sign != 0:
+		return fmt.Errorf("sign not allowed in string format specifier")
+	case s.alt:
+		return fmt.Errorf("alternate form (#) not allowed in string format specifier")
+	case s.grouping != 0:
+		return fmt.Errorf("cannot specify '%c' with 's'", s.grouping)
+	case s.align == '=':
+		return fmt.Errorf("'=' alignment not allowed in string format specifier")
+	}
+	if s.prec >= 0 {
+		// Truncate to prec code points.
+		n := s.prec
+		for i := range str {
+			if n == 0 {
+				str = str[:i]
+				break
+			}
+			n--
+		}
+	}
+	fill := s.fill
+	if s.zero && !s.fillSet {
+		fill = '0'
+	}
+	s.pad(buf, "", str, fill, s.align, '<')
+	return nil
+}
+
+// formatInt appends an integer formatted according to s and verb.
+func (s *formatSpec) formatInt(buf *bytes.Buffer, x Int, verb byte) error {
+	if verb == 'c' {
+		if s.sign != 0 || s.alt {
+			return fmt.Errorf("sign not allowed with integer format specifier 'c'")
+		}
+		r, err := AsInt32(x)
+		if err != nil || r < 0 || r > unicode.MaxRune {
+			return fmt.Errorf("%%c arg not in range(0x110000)")
+		}
+		fill, align := s.numberFill()
+		s.pad(buf, "", string(rune(r)), fill, align, '>')
+		return nil
+	}
+	if s.prec >= 0 && !s.printf {
+		return fmt.Errorf("precision not allowed in integer format specifier")
+	}
+
+	base, prefix, group := 10, "", 3
+	switch verb {
+	case 'b':
+		base, prefix, group = 2, "0b", 4
+	case 'o':
+		base, prefix, group = 8, "0o", 4
+	case 'x':
+		base, prefix, group = 16, "0x", 4
+	case 'X':
+		base, prefix, group = 16, "0X", 4
+	}
+	if !s.alt {
+		prefix = ""
+	}
+	if s.grouping == ',' && base != 10 {
+		return fmt.Errorf("cannot specify ',' with '%c'", verb)
+	}
+
+	digits := new(big.Int).Abs(x.bigint).Text(base)
+	if verb == 'X' {
+		digits = strings.ToUpper(digits)
+	}
+	if s.printf && s.prec > len(digits) {
+		digits = strings.Repeat("0", s.prec-len(digits)) + digits
+	}
+	s.writeNumber(buf, x.Sign() < 0, prefix, digits, "", group)
+	return nil
+}
+
+// formatFloat appends a floating-point number formatted according to s and verb.
+func (s *formatSpec) formatFloat(buf *bytes.Buffer, f float64, verb byte) error {
+	neg := math.Signbit(f) && !math.IsNaN(f)
+	f = math.Abs(f)
+
+	prec := s.prec
+	var text, suffix string
+	switch {
+	case math.IsInf(f, 0):
+		text = "inf"
+	case math.IsNaN(f):
+		text = "nan"
+	default:
+		switch verb {
+		case 'e', 'E':
+			if prec < 0 {
+				prec = 6
+			}
+			text = strconv.FormatFloat(f, 'e', prec, 64)
+		case 'f', 'F':
+			if prec < 0 {
+				prec = 6
+			}
+			text = strconv.FormatFloat(f, 'f', prec, 64)
+		case '%':
+			if prec < 0 {
+				prec = 6
+			}
+			text = strconv.FormatFloat(f*100, 'f', prec, 64)
+		case 'g', 'G', 'n':
+			if prec < 0 {
+				prec = 6
+			} else if prec == 0 {
+				prec = 1
+			}
+			if s.alt {
+				text = fmt.Sprintf("%#.*g", prec, f) // retains trailing zeros
+			} else {
+				text = strconv.FormatFloat(f, 'g', prec, 64)
+			}
+		}
+		if s.alt && !strings.Contains(text, ".") {
+			// The alternate form always has a decimal point.
+			if i := strings.IndexByte(text, 'e'); i >= 0 {
+				text = text[:i] + "." + text[i:]
+			} else {
+				text += "."
+			}
+		}
+	}
+	if verb == '%' {
+		suffix = "%"
+	}
+	if verb == 'E' || verb == 'F' || verb == 'G' {
+		text = strings.ToUpper(text)
+	}
+
+	// Only the digits before the point or exponent are grouped.
+	i := 0
+	for i < len(text) && isdigit(text[i]) {
+		i++
+	}
+	s.writeNumber(buf, neg, "", text[:i], text[i:]+suffix, 3)
+	return nil
+}
+
+// writeNumber appends a number with the specified sign, base prefix,
+// integer digits, and remaining text, such as a fraction or exponent.
+// It inserts separators every group digits if s requests grouping,
+// and pads the result to the field width.
+func (s *formatSpec) writeNumber(buf *bytes.Buffer, neg bool, prefix, digits, rest string, group int) {
+	var head string
+	switch {
+	case neg:
+		head = "-"
+	case s.sign == '+' || s.sign == ' ':
+		head = string(s.sign)
+	}
+	head += prefix
+
+	fill, align := s.numberFill()
+	if s.grouping != 0 {
+		if fill == '0' && align == '=' && digits != "" {
+			// Zero padding is part of the number, and is grouped too.
+			n := s.width - utf8.RuneCountInString(head) - utf8.RuneCountInString(rest)
+			for len(digits)+(len(digits)-1)/group < n {
+				digits = "0" + digits
+			}
+		}
+		digits = groupDigits(digits, s.grouping, group)
+	}
+	s.pad(buf, head, digits+rest, fill, align, '>')
+}
+
+// numberFill returns the fill and alignment for a number,
+// which the '0' flag may imply.
+func (s *formatSpec) numberFill() (rune, byte) {
+	if s.zero && !s.fillSet {
+		if s.align == 0 {
+			return '0', '='
+		}
+		return '0', s.align
+	}
+	return s.fill, s.align
+}
+
+// groupDigits inserts sep between each group of n digits, counting from the right.
+func groupDigits(digits string, sep byte, n int) string {
+	if len(digits) <= n {
+		return digits
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(digits); i++ {
+		if i > 0 && (len(digits)-i)%n == 0 {
+			buf.WriteByte(sep)
+		}
+		buf.WriteByte(digits[i])
+	}
+	return buf.String()
+}
+
+// pad appends head and body to buf, padded with fill to the field width
+// according to align, or dflt if align is unspecified. The padding
+// for '=' alignment goes between the head (sign and prefix) and body.
+func (s *formatSpec) pad(buf *bytes.Buffer, head, body string, fill rune, align, dflt byte) {
+	n := s.width - utf8.RuneCountInString(head) - utf8.RuneCountInString(body)
+	if n <= 0 {
+		buf.WriteString(head)
+		buf.WriteString(body)
+		return
+	}
+	padding := func(n int) {
+		for i := 0; i < n; i++ {
+			buf.WriteRune(fill)
+		}
+	}
+	if align == 0 {
+		align = dflt
+	}
+	switch align {
+	case '<':
+		buf.WriteString(head)
+		buf.WriteString(body)
+		padding(n)
+	case '>':
+		padding(n)
+		buf.WriteString(head)
+		buf.WriteString(body)
+	case '^':
+		padding(n / 2)
+		buf.WriteString(head)
+		buf.WriteString(body)
+		padding(n - n/2)
+	case '=':
+		buf.WriteString(head)
+		padding(n)
+		buf.WriteString(body)
+	}
+}
@@ -3,8 +3,10 @@ package starlark
 // This file defines the bytecode interpreter.
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 
 	"go.starlark.net/internal/compile"
 	"go.starlark.net/syntax"
@@ -45,7 +47,7 @@ func call(thread *Thread, args Tuple, kwargs []Tuple) (Value, error) {
 	locals := stack[:nlocals:nlocals] // local variables, starting with parameters
 	stack = stack[nlocals:]
 
-	err := setArgs(locals, fn, args, kwargs)
+	err := setArgs(locals, fn, args, kwargs, thread.CheckTypes)
 	if err != nil {
 		return nil, fr.errorf(fr.Position(), "%v", err)
 	}
@@ -322,6 +324,10 @@ loop:
 
 		case compile.RETURN:
 			result = stack[sp-1]
+			if thread.CheckTypes && len(f.ResultType) > 0 && !hasType(result, f.ResultType) {
+				err = fmt.Errorf("function %s returned %s, want %s",
+					fn.Name(), result.Type(), strings.Join(f.ResultType, " | "))
+			}
 			break loop
 
 		case compile.SETINDEX:
@@ -457,6 +463,37 @@ loop:
 			stack[sp] = NewList(elems)
 			sp++
 
+		case compile.FORMAT:
+			// The operand is the conversion and spec of an f-string field.
+			suffix := string(fn.constants[arg].(String))
+			var conv, spec string
+			if strings.HasPrefix(suffix, "!") {
+				conv, suffix = suffix[1:2], suffix[2:]
+			}
+			if strings.HasPrefix(suffix, ":") {
+				spec = suffix[1:]
+			}
+			x := stack[sp-1]
+			if _, ok := x.(String); ok && conv == "" && spec == "" {
+				break // common case: already a string
+			}
+			var buf bytes.Buffer
+			if err2 := formatField(&buf, x, conv, spec, nil); err2 != nil {
+				err = err2
+				break loop
+			}
+			stack[sp-1] = String(buf.String())
+
+		case compile.CONCAT:
+			n := int(arg)
+			sp -= n
+			var buf bytes.Buffer
+			for _, x := range stack[sp : sp+n] {
+				buf.WriteString(string(x.(String)))
+			}
+			stack[sp] = String(buf.String())
+			sp++
+
 		case compile.MAKEFUNC:
 			funcode := f.Prog.Functions[arg]
 			freevars := stack[sp-1].(Tuple)
@@ -42,11 +42,12 @@ func init() {
 		"any":       NewBuiltin("any", any),
 		"all":       NewBuiltin("all", all),
 		"bool":      NewBuiltin("bool", bool_),
+		"bytes":     NewBuiltin("bytes", bytes_),
 		"chr":       NewBuiltin("chr", chr),
 		"dict":      NewBuiltin("dict", dict),
 		"dir":       NewBuiltin("dir", dir),
 		"enumerate": NewBuiltin("enumerate", enumerate),
-		"float":     NewBuiltin("float", float), // requires resolve.AllowFloat
+		"float":     NewBuiltin("float", float), // requires FileOptions.Float
 		"getattr":   NewBuiltin("getattr", getattr),
 		"hasattr":   NewBuiltin("hasattr", hasattr),
 		"hash":      NewBuiltin("hash", hash),
@@ -60,7 +61,7 @@ func init() {
 		"range":     NewBuiltin("range", range_),
 		"repr":      NewBuiltin("repr", repr),
 		"reversed":  NewBuiltin("reversed", reversed),
-		"set":       NewBuiltin("set", set), // requires resolve.AllowSet
+		"set":       NewBuiltin("set", set), // requires FileOptions.Set
 		"sorted":    NewBuiltin("sorted", sorted),
 		"str":       NewBuiltin("str", str),
 		"tuple":     NewBuiltin("tuple", tuple),
@@ -74,6 +75,11 @@ type builtinMethod func(fnname string, recv Value, args Tuple, kwargs []Tuple) (
 // methods of built-in types
 // https://github.com/google/starlark-go/blob/master/doc/spec.md#built-in-methods
 var (
+	bytesMethods = map[string]builtinMethod{
+		"decode": bytes_decode,
+		"elems":  bytes_elems,
+	}
+
 	dictMethods = map[string]builtinMethod{
 		"clear":      dict_clear,
 		"get":        dict_get,
@@ -102,7 +108,8 @@ var (
 		"codepoints":     string_iterable, // sic
 		"count":          string_count,
 		"elem_ords":      string_iterable,
-		"elems":          string_iterable,   // sic
+		"elems":          string_iterable, // sic
+		"encode":         string_encode,
 		"endswith":       string_startswith, // sic
 		"find":           string_find,
 		"format":         string_format,
@@ -133,7 +140,22 @@ var (
 	}
 
 	setMethods = map[string]builtinMethod{
-		"union": set_union,
+		"add":                         set_add,
+		"clear":                       set_clear,
+		"difference":                  set_difference,
+		"difference_update":           set_difference_update,
+		"discard":                     set_discard,
+		"intersection":                set_intersection,
+		"intersection_update":         set_intersection_update,
+		"isdisjoint":                  set_isdisjoint,
+		"issubset":                    set_issubset,
+		"issuperset":                  set_issuperset,
+		"pop":                         set_pop,
+		"remove":                      set_remove,
+		"symmetric_difference":        set_symmetric_difference,
+		"symmetric_difference_update": set_symmetric_difference_update,
+		"union":                       set_union,
+		"update":                      set_update,
 	}
 )
 
@@ -141,6 +163,8 @@ func builtinMethodOf(recv Value, name string) builtinMethod {
 	switch recv.(type) {
 	case String:
 		return stringMethods[name]
+	case Bytes:
+		return bytesMethods[name]
 	case *List:
 		return listMethods[name]
 	case *Dict:
@@ -385,6 +409,38 @@ func bool_(thread *Thread, _ *Builtin, args Tuple, kwargs []Tuple) (Value, error
 	return x.Truth(), nil
 }
 
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#bytes
+func bytes_(thread *Thread, _ *Builtin, args Tuple, kwargs []Tuple) (Value, error) {
+	var x Value = Bytes("")
+	if err := UnpackPositionalArgs("bytes", args, kwargs, 0, &x); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case Bytes:
+		return x, nil
+	case String:
+		return Bytes(x), nil
+	case Iterable:
+		// iterable of numeric byte values
+		var buf bytes.Buffer
+		iter := x.Iterate()
+		defer iter.Done()
+		var elem Value
+		for i := 0; iter.Next(&elem); i++ {
+			b, err := AsInt32(elem)
+			if err != nil {
+				return nil, fmt.Errorf("bytes: at index %d, got %s, want int", i, elem.Type())
+			}
+			if b < 0 || b > 0xff {
+				return nil, fmt.Errorf("bytes: at index %d, %d out of range [0, 255]", i, b)
+			}
+			buf.WriteByte(byte(b))
+		}
+		return Bytes(buf.String()), nil
+	}
+	return nil, fmt.Errorf("bytes: got %s, want string, bytes, or iterable of ints", x.Type())
+}
+
 // https://github.com/google/starlark-go/blob/master/doc/spec.md#chr
 func chr(thread *Thread, _ *Builtin, args Tuple, kwargs []Tuple) (Value, error) {
 	if len(kwargs) > 0 {
@@ -1477,6 +1533,14 @@ func string_iterable(fnname string, recv Value, args Tuple, kwargs []Tuple) (Val
 	}, nil
 }
 
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#string·encode
+func string_encode(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return Bytes(recv.(String)), nil
+}
+
 // https://github.com/google/starlark-go/blob/master/doc/spec.md#string·count
 func string_count(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Value, error) {
 	recv := string(recv_.(String))
@@ -1673,8 +1737,7 @@ func string_format(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Valu
 		}
 
 		var arg Value
-		conv := "s"
-		var spec string
+		var conv, spec string
 
 		field := format[:i]
 		format = format[i+1:]
@@ -1699,6 +1762,9 @@ func string_format(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Valu
 				conv = field[:i]
 				spec = field[i+1:]
 			}
+			if conv != "s" && conv != "r" {
+				return nil, fmt.Errorf("unknown conversion %q", conv)
+			}
 		}
 
 		if name == "" {
@@ -1747,22 +1813,11 @@ func string_format(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Valu
 			}
 		}
 
-		if spec != "" {
-			// Starlark does not support Python's format_spec features.
-			return nil, fmt.Errorf("format spec features not supported in replacement fields: %s", spec)
+		if strings.Contains(spec, "{") {
+			return nil, fmt.Errorf("nested replacement fields not supported")
 		}
-
-		switch conv {
-		case "s":
-			if str, ok := AsString(arg); ok {
-				buf.WriteString(str)
-			} else {
-				writeValue(&buf, arg, path)
-			}
-		case "r":
-			writeValue(&buf, arg, path)
-		default:
-			return nil, fmt.Errorf("unknown conversion %q", conv)
+		if err := formatField(&buf, arg, conv, spec, path); err != nil {
+			return nil, err
 		}
 	}
 	return String(buf.String()), nil
@@ -2125,6 +2180,290 @@ func set_union(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, er
 	return union, nil
 }
 
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#bytes·decode
+func bytes_decode(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	s, err := recv.(Bytes).DecodeUTF8()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return s, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#bytes·elems
+func bytes_elems(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return bytesIterable{recv.(Bytes)}, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·add
+func set_add(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var elem Value
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &elem); err != nil {
+		return nil, err
+	}
+	if err := recv.(*Set).Insert(elem); err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·clear
+func set_clear(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	if err := recv.(*Set).Clear(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·difference
+func set_difference(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	others, err := unpackSetOperands(fnname, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	diff := recv.(*Set)
+	for _, other := range others {
+		diff = diff.difference(other)
+	}
+	if len(others) == 0 {
+		diff = diff.difference(new(Set)) // copy
+	}
+	return diff, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·difference_update
+func set_difference_update(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Value, error) {
+	recv := recv_.(*Set)
+	others, err := unpackSetOperands(fnname, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		for _, elem := range other.elems() {
+			if _, err := recv.Delete(elem); err != nil {
+				return nil, fmt.Errorf("%s: %v", fnname, err)
+			}
+		}
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·discard
+func set_discard(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var elem Value
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &elem); err != nil {
+		return nil, err
+	}
+	if _, err := recv.(*Set).Delete(elem); err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·intersection
+func set_intersection(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	others, err := unpackSetOperands(fnname, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	inter := recv.(*Set)
+	for _, other := range others {
+		inter = inter.intersection(other)
+	}
+	if len(others) == 0 {
+		inter = inter.difference(new(Set)) // copy
+	}
+	return inter, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·intersection_update
+func set_intersection_update(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Value, error) {
+	recv := recv_.(*Set)
+	others, err := unpackSetOperands(fnname, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if len(others) == 0 {
+		return None, nil
+	}
+	inter := recv
+	for _, other := range others {
+		inter = inter.intersection(other)
+	}
+	if err := replaceSetElems(recv, inter); err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·isdisjoint
+func set_isdisjoint(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var iterable Iterable
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &iterable); err != nil {
+		return nil, err
+	}
+	iter := iterable.Iterate()
+	defer iter.Done()
+	ok, err := recv.(*Set).IsDisjoint(iter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return Bool(ok), nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·issubset
+func set_issubset(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var iterable Iterable
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &iterable); err != nil {
+		return nil, err
+	}
+	iter := iterable.Iterate()
+	defer iter.Done()
+	ok, err := recv.(*Set).IsSubset(iter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return Bool(ok), nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·issuperset
+func set_issuperset(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var iterable Iterable
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &iterable); err != nil {
+		return nil, err
+	}
+	iter := iterable.Iterate()
+	defer iter.Done()
+	ok, err := recv.(*Set).IsSuperset(iter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return Bool(ok), nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·pop
+func set_pop(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Value, error) {
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	recv := recv_.(*Set)
+	k, ok := recv.ht.first()
+	if !ok {
+		return nil, fmt.Errorf("pop: empty set")
+	}
+	if _, err := recv.Delete(k); err != nil {
+		return nil, fmt.Errorf("pop: %v", err) // set is frozen
+	}
+	return k, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·remove
+func set_remove(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var elem Value
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &elem); err != nil {
+		return nil, err
+	}
+	if found, err := recv.(*Set).Delete(elem); err != nil {
+		return nil, fmt.Errorf("remove: %v", err)
+	} else if !found {
+		return nil, fmt.Errorf("remove: element not found")
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·symmetric_difference
+func set_symmetric_difference(fnname string, recv Value, args Tuple, kwargs []Tuple) (Value, error) {
+	var iterable Iterable
+	if err := UnpackPositionalArgs(fnname, args, kwargs, 1, &iterable); err != nil {
+		return nil, err
+	}
+	iter := iterable.Iterate()
+	defer iter.Done()
+	diff, err := recv.(*Set).SymmetricDifference(iter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return diff, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·symmetric_difference_update
+func set_symmetric_difference_update(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Value, error) {
+	recv := recv_.(*Set)
+	others, err := unpackSetOperands(fnname, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if len(others) != 1 {
+		return nil, fmt.Errorf("%s: got %d arguments, want 1", fnname, len(others))
+	}
+	if err := replaceSetElems(recv, recv.symmetricDifference(others[0])); err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	return None, nil
+}
+
+// https://github.com/google/starlark-go/blob/master/doc/spec.md#set·update
+func set_update(fnname string, recv_ Value, args Tuple, kwargs []Tuple) (Value, error) {
+	recv := recv_.(*Set)
+	others, err := unpackSetOperands(fnname, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		for _, elem := range other.elems() {
+			if err := recv.Insert(elem); err != nil {
+				return nil, fmt.Errorf("%s: %v", fnname, err)
+			}
+		}
+	}
+	return None, nil
+}
+
+// unpackSetOperands converts each of the positional arguments of the
+// set method fnname, which must be iterable, to a new set.
+// Materializing each operand before modifying the receiver allows
+// s.update(s) and similar calls to behave as expected.
+func unpackSetOperands(fnname string, args Tuple, kwargs []Tuple) ([]*Set, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fnname)
+	}
+	sets := make([]*Set, len(args))
+	for i, arg := range args {
+		iter := Iterate(arg)
+		if iter == nil {
+			return nil, fmt.Errorf("%s: for parameter %d: got %s, want iterable", fnname, i+1, arg.Type())
+		}
+		set, err := setOf(iter)
+		iter.Done()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fnname, err)
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// replaceSetElems replaces the contents of set s by those of t.
+func replaceSetElems(s, t *Set) error {
+	if err := s.Clear(); err != nil {
+		return err
+	}
+	for _, elem := range t.elems() {
+		if err := s.Insert(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Common implementation of string_{r}{find,index}.
 func string_find_impl(fnname string, s string, args Tuple, kwargs []Tuple, allowError, last bool) (Value, error) {
 	var sub string
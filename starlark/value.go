@@ -12,6 +12,7 @@
 //      Int             -- int
 //      Float           -- float
 //      String          -- string
+//      Bytes           -- bytes
 //      *List           -- list
 //      Tuple           -- tuple
 //      *Dict           -- dict
@@ -135,6 +136,7 @@ var (
 	_ Comparable = False
 	_ Comparable = Float(0)
 	_ Comparable = String("")
+	_ Comparable = Bytes("")
 	_ Comparable = (*Dict)(nil)
 	_ Comparable = (*List)(nil)
 	_ Comparable = Tuple(nil)
@@ -208,8 +210,10 @@ var (
 	_ HasSetIndex = (*List)(nil)
 	_ Indexable   = Tuple(nil)
 	_ Indexable   = String("")
+	_ Indexable   = Bytes("")
 	_ Sliceable   = Tuple(nil)
 	_ Sliceable   = String("")
+	_ Sliceable   = Bytes("")
 	_ Sliceable   = (*List)(nil)
 )
 
@@ -289,6 +293,7 @@ type HasAttrs interface {
 
 var (
 	_ HasAttrs = String("")
+	_ HasAttrs = Bytes("")
 	_ HasAttrs = new(List)
 	_ HasAttrs = new(Dict)
 	_ HasAttrs = new(Set)
@@ -513,6 +518,121 @@ func (it *stringIterator) Next(p *Value) bool {
 
 func (*stringIterator) Done() {}
 
+// Bytes is the type of a Starlark bytes value,
+// an immutable sequence of bytes used to represent binary data.
+//
+// Unlike a String, indexing a Bytes value yields an int, the numeric
+// value of the byte. Bytes are not directly iterable; use the elems
+// method to obtain an iterable sequence of ints.
+//
+// Use b.decode() in Starlark, or DecodeUTF8 in Go, to convert Bytes to a
+// String, and s.encode() or the bytes builtin to convert a String to Bytes.
+type Bytes string
+
+func (b Bytes) String() string        { return quoteBytes(string(b)) }
+func (b Bytes) Type() string          { return "bytes" }
+func (b Bytes) Freeze()               {} // immutable
+func (b Bytes) Truth() Bool           { return len(b) > 0 }
+func (b Bytes) Hash() (uint32, error) { return hashString(string(b)), nil }
+func (b Bytes) Len() int              { return len(b) }
+func (b Bytes) Index(i int) Value     { return MakeInt(int(b[i])) }
+
+func (b Bytes) Slice(start, end, step int) Value {
+	if step == 1 {
+		return b[start:end]
+	}
+
+	sign := signum(step)
+	var str []byte
+	for i := start; signum(end-i) == sign; i += step {
+		str = append(str, b[i])
+	}
+	return Bytes(str)
+}
+
+func (b Bytes) Attr(name string) (Value, error) { return builtinAttr(b, name, bytesMethods) }
+func (b Bytes) AttrNames() []string             { return builtinAttrNames(bytesMethods) }
+
+func (x Bytes) CompareSameType(op syntax.Token, y_ Value, depth int) (bool, error) {
+	y := y_.(Bytes)
+	return threeway(op, strings.Compare(string(x), string(y))), nil
+}
+
+// DecodeUTF8 returns the String whose contents are the bytes of b.
+// It fails if b is not a valid UTF-8 encoding.
+func (b Bytes) DecodeUTF8() (String, error) {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRuneInString(string(b[i:]))
+		if r == utf8.RuneError && size == 1 {
+			return "", fmt.Errorf("invalid UTF-8 byte 0x%02x at index %d", b[i], i)
+		}
+		i += size
+	}
+	return String(b), nil
+}
+
+// quoteBytes returns the Starlark notation for a bytes literal
+// with contents s. Non-ASCII bytes are always escaped.
+func quoteBytes(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString(`b"`)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&buf, `\x%02x`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// A bytesIterable is an iterable whose iterator yields
+// the numeric values of successive bytes.
+type bytesIterable struct{ b Bytes }
+
+var _ Iterable = (*bytesIterable)(nil)
+
+func (bi bytesIterable) String() string        { return bi.b.String() + ".elems()" }
+func (bi bytesIterable) Type() string          { return "bytes.elems" }
+func (bi bytesIterable) Freeze()               {} // immutable
+func (bi bytesIterable) Truth() Bool           { return True }
+func (bi bytesIterable) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable: %s", bi.Type()) }
+func (bi bytesIterable) Iterate() Iterator     { return &bytesIterator{bi.b} }
+
+type bytesIterator struct{ b Bytes }
+
+func (it *bytesIterator) Next(p *Value) bool {
+	if it.b == "" {
+		return false
+	}
+	*p = MakeInt(int(it.b[0]))
+	it.b = it.b[1:]
+	return true
+}
+
+func (*bytesIterator) Done() {}
+
 // A Function is a function defined by a Starlark def statement or lambda expression.
 // The initialization behavior of a Starlark module is also represented by a Function.
 type Function struct {
@@ -527,6 +647,7 @@ type Function struct {
 }
 
 func (fn *Function) Name() string          { return fn.funcode.Name } // "lambda" for anonymous functions
+func (fn *Function) Doc() string           { return fn.funcode.Doc }  // docstring, or "" if none
 func (fn *Function) Hash() (uint32, error) { return hashString(fn.funcode.Name), nil }
 func (fn *Function) Freeze()               { fn.defaults.Freeze(); fn.freevars.Freeze() }
 func (fn *Function) String() string        { return toString(fn) }
@@ -895,6 +1016,14 @@ func (x *Set) CompareSameType(op syntax.Token, y_ Value, depth int) (bool, error
 	case syntax.NEQ:
 		ok, err := setsEqual(x, y, depth)
 		return !ok, err
+	case syntax.GE: // superset
+		return y.isSubset(x), nil
+	case syntax.LE: // subset
+		return x.isSubset(y), nil
+	case syntax.GT: // proper superset
+		return x.Len() > y.Len() && y.isSubset(x), nil
+	case syntax.LT: // proper subset
+		return x.Len() < y.Len() && x.isSubset(y), nil
 	default:
 		return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
 	}
@@ -912,6 +1041,67 @@ func setsEqual(x, y *Set, depth int) (bool, error) {
 	return true, nil
 }
 
+// isSubset reports whether every element of x is an element of y.
+func (x *Set) isSubset(y *Set) bool {
+	if x.Len() > y.Len() {
+		return false
+	}
+	for _, elem := range x.elems() {
+		if found, _ := y.Has(elem); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// intersection returns a new set containing the elements common to x and y.
+func (x *Set) intersection(y *Set) *Set {
+	set := new(Set)
+	for _, elem := range x.elems() {
+		// Has, Insert cannot fail here.
+		if found, _ := y.Has(elem); found {
+			set.Insert(elem)
+		}
+	}
+	return set
+}
+
+// difference returns a new set containing the elements of x not in y.
+func (x *Set) difference(y *Set) *Set {
+	set := new(Set)
+	for _, elem := range x.elems() {
+		if found, _ := y.Has(elem); !found {
+			set.Insert(elem)
+		}
+	}
+	return set
+}
+
+// symmetricDifference returns a new set containing the elements
+// of x not in y, followed by the elements of y not in x.
+func (x *Set) symmetricDifference(y *Set) *Set {
+	set := x.difference(y)
+	for _, elem := range y.elems() {
+		if found, _ := x.Has(elem); !found {
+			set.Insert(elem)
+		}
+	}
+	return set
+}
+
+// setOf returns a new set containing the elements of the sequence.
+// It fails if any element is unhashable.
+func setOf(iter Iterator) (*Set, error) {
+	set := new(Set)
+	var x Value
+	for iter.Next(&x) {
+		if err := set.Insert(x); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
 func (s *Set) Union(iter Iterator) (Value, error) {
 	set := new(Set)
 	for _, elem := range s.elems() {
@@ -926,6 +1116,71 @@ func (s *Set) Union(iter Iterator) (Value, error) {
 	return set, nil
 }
 
+// Intersection returns a new set containing the elements of s
+// that are also elements of the sequence.
+func (s *Set) Intersection(iter Iterator) (Value, error) {
+	other, err := setOf(iter)
+	if err != nil {
+		return nil, err
+	}
+	return s.intersection(other), nil
+}
+
+// Difference returns a new set containing the elements of s
+// that are not elements of the sequence.
+func (s *Set) Difference(iter Iterator) (Value, error) {
+	other, err := setOf(iter)
+	if err != nil {
+		return nil, err
+	}
+	return s.difference(other), nil
+}
+
+// SymmetricDifference returns a new set containing the elements that
+// are in either s or the sequence, but not both.
+func (s *Set) SymmetricDifference(iter Iterator) (Value, error) {
+	other, err := setOf(iter)
+	if err != nil {
+		return nil, err
+	}
+	return s.symmetricDifference(other), nil
+}
+
+// IsSubset reports whether every element of s is an element of the sequence.
+func (s *Set) IsSubset(iter Iterator) (bool, error) {
+	other, err := setOf(iter)
+	if err != nil {
+		return false, err
+	}
+	return s.isSubset(other), nil
+}
+
+// IsSuperset reports whether every element of the sequence is an element of s.
+func (s *Set) IsSuperset(iter Iterator) (bool, error) {
+	var x Value
+	for iter.Next(&x) {
+		if found, err := s.Has(x); err != nil {
+			return false, err
+		} else if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// IsDisjoint reports whether s has no elements in common with the sequence.
+func (s *Set) IsDisjoint(iter Iterator) (bool, error) {
+	var x Value
+	for iter.Next(&x) {
+		if found, err := s.Has(x); err != nil {
+			return false, err
+		} else if found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // toString returns the string form of value v.
 // It may be more efficient than v.String() for larger values.
 func toString(v Value) string {
@@ -958,6 +1213,9 @@ func writeValue(out *bytes.Buffer, x Value, path []Value) {
 	case String:
 		fmt.Fprintf(out, "%q", string(x))
 
+	case Bytes:
+		out.WriteString(quoteBytes(string(x)))
+
 	case *List:
 		out.WriteByte('[')
 		if pathContains(path, x) {
@@ -1178,6 +1436,8 @@ func Len(x Value) int {
 	switch x := x.(type) {
 	case String:
 		return x.Len()
+	case Bytes:
+		return x.Len()
 	case Sequence:
 		return x.Len()
 	}
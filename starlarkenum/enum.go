@@ -0,0 +1,257 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarkenum defines the Starlark 'enum' type constructor,
+// an optional language extension.
+//
+// The expression enum("Color", "RED", "GREEN", "BLUE") yields a new
+// enumerated type, Color, whose members Color.RED, Color.GREEN, and
+// Color.BLUE are distinct singleton values. Members are hashable and
+// are ordered by their position in the declaration.
+package starlarkenum // import "go.starlark.net/starlarkenum"
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Make is the implementation of a built-in function that creates a
+// new enumerated type from its name and the names of its members.
+//
+// An application can add 'enum' to the Starlark environment like so:
+//
+// 	globals := starlark.StringDict{
+// 		"enum": starlark.NewBuiltin("enum", starlarkenum.Make),
+// 	}
+//
+func Make(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("enum does not accept keyword arguments")
+	}
+	if len(args) < 1 {
+		return nil, fmt.Errorf("enum: missing name")
+	}
+	names := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := starlark.AsString(arg)
+		if !ok {
+			return nil, fmt.Errorf("enum: for parameter %d: got %s, want string", i+1, arg.Type())
+		}
+		names[i] = s
+	}
+	return New(names[0], names[1:]...)
+}
+
+// New returns a new enumerated type with the specified name and members.
+// It fails if any name is empty, or if a member name is repeated.
+func New(name string, members ...string) (*Type, error) {
+	if name == "" {
+		return nil, fmt.Errorf("enum: empty name")
+	}
+	t := &Type{
+		name:    name,
+		members: make([]*Member, len(members)),
+		index:   make(map[string]*Member, len(members)),
+	}
+	for i, m := range members {
+		if m == "" {
+			return nil, fmt.Errorf("enum %s: empty member name", name)
+		}
+		if _, dup := t.index[m]; dup {
+			return nil, fmt.Errorf("enum %s: duplicate member %s", name, m)
+		}
+		member := &Member{enum: t, name: m, index: i}
+		t.members[i] = member
+		t.index[m] = member
+	}
+	return t, nil
+}
+
+// Type is an enumerated type.
+// It is an immutable Starlark value whose attributes are its members.
+//
+// A Type is iterable, yielding its members in declaration order,
+// and indexable by position.  Calling a Type with the name or index
+// of a member returns that member.
+type Type struct {
+	name    string
+	members []*Member
+	index   map[string]*Member // maps name to member
+}
+
+var (
+	_ starlark.HasAttrs  = (*Type)(nil)
+	_ starlark.Callable  = (*Type)(nil)
+	_ starlark.Indexable = (*Type)(nil)
+	_ starlark.Sequence  = (*Type)(nil)
+)
+
+func (t *Type) String() string             { return fmt.Sprintf("<enum %s>", t.name) }
+func (t *Type) Type() string               { return "enum_type" }
+func (t *Type) Freeze()                    {} // immutable
+func (t *Type) Truth() starlark.Bool       { return true }
+func (t *Type) Hash() (uint32, error)      { return starlark.String(t.name).Hash() }
+func (t *Type) Len() int                   { return len(t.members) }
+func (t *Type) Index(i int) starlark.Value { return t.members[i] }
+func (t *Type) Iterate() starlark.Iterator { return &memberIterator{members: t.members} }
+
+// Name returns the name of the enumerated type.
+func (t *Type) Name() string { return t.name }
+
+// Members returns the members of the type in declaration order.
+// The caller must not modify the result.
+func (t *Type) Members() []*Member { return t.members }
+
+// Member returns the member of the type with the specified name,
+// or nil if there is none.
+func (t *Type) Member(name string) *Member { return t.index[name] }
+
+// Unpack returns the member of t denoted by v, which may be a member
+// of t, the name of a member as a string, or its index as an int.
+// It is a convenience for Go functions that accept an enum parameter.
+func (t *Type) Unpack(v starlark.Value) (*Member, error) {
+	switch v := v.(type) {
+	case *Member:
+		if v.enum == t {
+			return v, nil
+		}
+	case starlark.String:
+		if m := t.index[string(v)]; m != nil {
+			return m, nil
+		}
+		return nil, fmt.Errorf("%s has no member %s", t.name, v)
+	case starlark.Int:
+		i, err := starlark.AsInt32(v)
+		if err != nil || i < 0 || i >= len(t.members) {
+			return nil, fmt.Errorf("%s has no member with index %s", t.name, v)
+		}
+		return t.members[i], nil
+	}
+	return nil, fmt.Errorf("got %s, want %s", v.Type(), t.name)
+}
+
+func (t *Type) Attr(name string) (starlark.Value, error) {
+	if m := t.index[name]; m != nil {
+		return m, nil
+	}
+	return nil, fmt.Errorf("enum %s has no member %s", t.name, name)
+}
+
+// AttrNames returns the names of the members in declaration order.
+func (t *Type) AttrNames() []string {
+	names := make([]string, len(t.members))
+	for i, m := range t.members {
+		names[i] = m.name
+	}
+	return names
+}
+
+func (t *Type) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(t.name, args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	m, err := t.Unpack(x)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", t.name, err)
+	}
+	return m, nil
+}
+
+type memberIterator struct {
+	members []*Member
+}
+
+func (it *memberIterator) Next(p *starlark.Value) bool {
+	if len(it.members) == 0 {
+		return false
+	}
+	*p = it.members[0]
+	it.members = it.members[1:]
+	return true
+}
+
+func (it *memberIterator) Done() {}
+
+// A Member is a member of an enumerated type.
+// Each member is a distinct singleton value.
+// Its type, as reported by the Starlark 'type' function, is the name
+// of its enumerated type.
+type Member struct {
+	enum  *Type
+	name  string
+	index int
+}
+
+var (
+	_ starlark.HasAttrs   = (*Member)(nil)
+	_ starlark.Comparable = (*Member)(nil)
+)
+
+func (m *Member) String() string { return m.enum.name + "." + m.name }
+
+func (m *Member) Type() string {
+	if m == nil {
+		return "enum" // for UnpackArgs' error message
+	}
+	return m.enum.name
+}
+
+func (m *Member) Freeze()              {} // immutable
+func (m *Member) Truth() starlark.Bool { return true }
+func (m *Member) Hash() (uint32, error) {
+	h, _ := starlark.String(m.enum.name).Hash()
+	return h ^ uint32(m.index+1)*9839, nil
+}
+
+// Enum returns the enumerated type of which m is a member.
+func (m *Member) Enum() *Type { return m.enum }
+
+// Name returns the name of the member.
+func (m *Member) Name() string { return m.name }
+
+// Index returns the position of the member within the declaration of its type.
+func (m *Member) Index() int { return m.index }
+
+func (m *Member) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(m.name), nil
+	case "index":
+		return starlark.MakeInt(m.index), nil
+	}
+	return nil, nil
+}
+
+func (m *Member) AttrNames() []string { return []string{"index", "name"} }
+
+func (x *Member) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*Member)
+	if x.enum != y.enum {
+		switch op {
+		case syntax.EQL:
+			return false, nil
+		case syntax.NEQ:
+			return true, nil
+		}
+		return false, fmt.Errorf("cannot compare members of distinct enums %s and %s", x.enum, y.enum)
+	}
+	switch op {
+	case syntax.EQL:
+		return x == y, nil
+	case syntax.NEQ:
+		return x != y, nil
+	case syntax.LT:
+		return x.index < y.index, nil
+	case syntax.LE:
+		return x.index <= y.index, nil
+	case syntax.GT:
+		return x.index > y.index, nil
+	case syntax.GE:
+		return x.index >= y.index, nil
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
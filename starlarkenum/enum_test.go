@@ -0,0 +1,90 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkenum_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkenum"
+	"go.starlark.net/starlarktest"
+)
+
+func init() {
+	// The tests make extensive use of these not-yet-standard features.
+	resolve.AllowLambda = true
+	resolve.AllowSet = true
+}
+
+func Test(t *testing.T) {
+	testdata := starlarktest.DataFile("starlarkenum", ".")
+	thread := &starlark.Thread{Load: load}
+	starlarktest.SetReporter(thread, t)
+	filename := filepath.Join(testdata, "testdata/enum.star")
+	predeclared := starlark.StringDict{
+		"enum": starlark.NewBuiltin("enum", starlarkenum.Make),
+	}
+	if _, err := starlark.ExecFile(thread, filename, nil, predeclared); err != nil {
+		if err, ok := err.(*starlark.EvalError); ok {
+			t.Fatal(err.Backtrace())
+		}
+		t.Fatal(err)
+	}
+}
+
+// load implements the 'load' operation as used in the evaluator tests.
+func load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	if module == "assert.star" {
+		return starlarktest.LoadAssertModule()
+	}
+	return nil, fmt.Errorf("load not implemented")
+}
+
+func TestUnpack(t *testing.T) {
+	color, err := starlarkenum.New("Color", "RED", "GREEN", "BLUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	thread := new(starlark.Thread)
+	globals, err := starlark.ExecFile(thread, "unpack.star", `
+a = Color.GREEN
+b = Color("BLUE")
+`, starlark.StringDict{"Color": color})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		v    starlark.Value
+		want string
+	}{
+		{globals["a"], "GREEN"},
+		{globals["b"], "BLUE"},
+		{starlark.String("RED"), "RED"},
+		{starlark.MakeInt(1), "GREEN"},
+		{starlark.String("PURPLE"), `Color has no member "PURPLE"`},
+		{starlark.MakeInt(3), "Color has no member with index 3"},
+		{starlark.None, "got NoneType, want Color"},
+	} {
+		var got string
+		if m, err := color.Unpack(test.v); err != nil {
+			got = err.Error()
+		} else {
+			got = m.Name()
+		}
+		if got != test.want {
+			t.Errorf("Unpack(%v) = %s, want %s", test.v, got, test.want)
+		}
+	}
+
+	if m := color.Member("BLUE"); m == nil || m.Index() != 2 || m.Enum() != color {
+		t.Errorf("Member(BLUE) = %v", m)
+	}
+	if _, err := starlarkenum.New("E", "A", "A"); err == nil || err.Error() != "enum E: duplicate member A" {
+		t.Errorf("New with duplicate: got %v", err)
+	}
+}
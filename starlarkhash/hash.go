@@ -0,0 +1,329 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarkhash defines the Starlark 'hash' module of message
+// digests and binary-to-text encodings, an optional language extension.
+//
+// The digest functions resemble those of Python's hashlib. Each returns
+// a hasher, a mutable value that accumulates data through its update
+// method, so that a digest of a large input may be computed piecewise
+// without first concatenating it:
+//
+// 	h = hash.sha256()
+// 	for src in srcs:
+// 		h.update(src)
+// 	print(h.hexdigest())
+//
+// Functions that accept data accept either a string or bytes.
+// Decoding functions return bytes.
+//
+// The module defines the following constants and functions:
+//
+// 	algorithms                                   # tuple of supported algorithm names
+// 	md5 sha1 sha224 sha256 sha384 sha512         # (data="") -> hasher
+// 	new(name, data="")                           # hasher for the named algorithm
+// 	base64_encode(data, urlsafe=False, padding=True)
+// 	base64_decode(s, urlsafe=False, padding=True)
+// 	hex_encode(data)
+// 	hex_decode(s)
+package starlarkhash // import "go.starlark.net/starlarkhash"
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	gohash "hash"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module is the Starlark 'hash' module.
+//
+// An application can make it available to load statements like so:
+//
+// 	thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+// 		if module == "hash.star" {
+// 			return starlark.StringDict{"hash": starlarkhash.Module}, nil
+// 		}
+// 		...
+// 	}
+//
+var Module = starlarkstruct.FromStringDict(starlark.String("hash"), starlark.StringDict{
+	"algorithms": algorithmNames(),
+
+	"md5":    newHashBuiltin("md5"),
+	"sha1":   newHashBuiltin("sha1"),
+	"sha224": newHashBuiltin("sha224"),
+	"sha256": newHashBuiltin("sha256"),
+	"sha384": newHashBuiltin("sha384"),
+	"sha512": newHashBuiltin("sha512"),
+	"new":    starlark.NewBuiltin("hash.new", hash_new),
+
+	"base64_decode": starlark.NewBuiltin("hash.base64_decode", base64_decode),
+	"base64_encode": starlark.NewBuiltin("hash.base64_encode", base64_encode),
+	"hex_decode":    starlark.NewBuiltin("hash.hex_decode", hex_decode),
+	"hex_encode":    starlark.NewBuiltin("hash.hex_encode", hex_encode),
+})
+
+// algorithms maps each supported algorithm name to its constructor.
+var algorithms = map[string]func() gohash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func algorithmNames() starlark.Tuple {
+	var names []string
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tuple := make(starlark.Tuple, len(names))
+	for i, name := range names {
+		tuple[i] = starlark.String(name)
+	}
+	return tuple
+}
+
+// dataOf returns the contents of x, which must be a string or bytes.
+func dataOf(fn *starlark.Builtin, param string, x starlark.Value) (string, error) {
+	switch x := x.(type) {
+	case starlark.String:
+		return string(x), nil
+	case starlark.Bytes:
+		return string(x), nil
+	}
+	return "", fmt.Errorf("%s: for parameter %s: got %s, want string or bytes", fn.Name(), param, x.Type())
+}
+
+// NewHasher returns a new hasher for the named algorithm,
+// or nil if the algorithm is not supported.
+func NewHasher(name string) *Hasher {
+	newHash, ok := algorithms[name]
+	if !ok {
+		return nil
+	}
+	return &Hasher{name: name, h: newHash()}
+}
+
+// newHashBuiltin returns the constructor function for the named algorithm.
+func newHashBuiltin(name string) *starlark.Builtin {
+	return starlark.NewBuiltin("hash."+name, func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var data starlark.Value = starlark.String("")
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data?", &data); err != nil {
+			return nil, err
+		}
+		return newHasher(fn, name, data)
+	})
+}
+
+// new(name, data="") returns a hasher for the named algorithm.
+func hash_new(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var data starlark.Value = starlark.String("")
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "data?", &data); err != nil {
+		return nil, err
+	}
+	return newHasher(fn, name, data)
+}
+
+func newHasher(fn *starlark.Builtin, name string, data starlark.Value) (starlark.Value, error) {
+	h := NewHasher(name)
+	if h == nil {
+		return nil, fmt.Errorf("%s: unsupported hash algorithm %q", fn.Name(), name)
+	}
+	s, err := dataOf(fn, "data", data)
+	if err != nil {
+		return nil, err
+	}
+	h.h.Write([]byte(s))
+	return h, nil
+}
+
+// A Hasher is a Starlark value that computes a message digest
+// of the data supplied to its update method.
+// A frozen hasher can report its digest but not be updated.
+type Hasher struct {
+	name   string
+	h      gohash.Hash
+	frozen bool
+}
+
+var _ starlark.HasAttrs = (*Hasher)(nil)
+
+func (h *Hasher) String() string        { return fmt.Sprintf("<hash.hasher %s>", h.name) }
+func (h *Hasher) Type() string          { return "hash.hasher" }
+func (h *Hasher) Freeze()               { h.frozen = true }
+func (h *Hasher) Truth() starlark.Bool  { return true }
+func (h *Hasher) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: hash.hasher") }
+
+// Sum returns the digest of the data written so far.
+func (h *Hasher) Sum() []byte { return h.h.Sum(nil) }
+
+func (h *Hasher) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(h.name), nil
+	case "digest_size":
+		return starlark.MakeInt(h.h.Size()), nil
+	case "block_size":
+		return starlark.MakeInt(h.h.BlockSize()), nil
+	}
+	if method, ok := hasherMethods[name]; ok {
+		return starlark.NewBuiltin(name, method).BindReceiver(h), nil
+	}
+	return nil, nil
+}
+
+func (h *Hasher) AttrNames() []string {
+	return []string{"block_size", "copy", "digest", "digest_size", "hexdigest", "name", "update"}
+}
+
+var hasherMethods = map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+	"copy":      hasher_copy,
+	"digest":    hasher_digest,
+	"hexdigest": hasher_hexdigest,
+	"update":    hasher_update,
+}
+
+// update(data) adds data to the input of the hasher.
+func hasher_update(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &data); err != nil {
+		return nil, err
+	}
+	h := fn.Receiver().(*Hasher)
+	if h.frozen {
+		return nil, fmt.Errorf("%s: cannot update frozen hasher", fn.Name())
+	}
+	s, err := dataOf(fn, "data", data)
+	if err != nil {
+		return nil, err
+	}
+	h.h.Write([]byte(s))
+	return starlark.None, nil
+}
+
+// digest() returns the digest of the input so far, as bytes.
+func hasher_digest(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.Bytes(fn.Receiver().(*Hasher).Sum()), nil
+}
+
+// hexdigest() returns the digest of the input so far, as a string of hex digits.
+func hasher_hexdigest(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.String(hex.EncodeToString(fn.Receiver().(*Hasher).Sum())), nil
+}
+
+// copy() returns a new, unfrozen hasher with the same state.
+func hasher_copy(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	h := fn.Receiver().(*Hasher)
+	// All the standard hash implementations support marshaling their state.
+	state, err := h.h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	c := NewHasher(h.name)
+	if err := c.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return c, nil
+}
+
+// base64Encoding returns the encoding selected by the urlsafe and padding options.
+func base64Encoding(urlsafe, padding bool) *base64.Encoding {
+	switch {
+	case urlsafe && padding:
+		return base64.URLEncoding
+	case urlsafe:
+		return base64.RawURLEncoding
+	case padding:
+		return base64.StdEncoding
+	default:
+		return base64.RawStdEncoding
+	}
+}
+
+// base64_encode(data, urlsafe=False, padding=True) returns the base64
+// encoding of data, using the URL-safe alphabet if urlsafe is true.
+func base64_encode(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data starlark.Value
+	urlsafe, padding := false, true
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data, "urlsafe?", &urlsafe, "padding?", &padding); err != nil {
+		return nil, err
+	}
+	s, err := dataOf(fn, "data", data)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(base64Encoding(urlsafe, padding).EncodeToString([]byte(s))), nil
+}
+
+// base64_decode(s, urlsafe=False, padding=True) returns the bytes
+// whose base64 encoding is s.
+func base64_decode(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	urlsafe, padding := false, true
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "s", &x, "urlsafe?", &urlsafe, "padding?", &padding); err != nil {
+		return nil, err
+	}
+	s, err := dataOf(fn, "s", x)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64Encoding(urlsafe, padding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bytes(b), nil
+}
+
+// hex_encode(data) returns the lowercase hexadecimal encoding of data.
+func hex_encode(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &data); err != nil {
+		return nil, err
+	}
+	s, err := dataOf(fn, "data", data)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(hex.EncodeToString([]byte(s))), nil
+}
+
+// hex_decode(s) returns the bytes whose hexadecimal encoding is s.
+// Both upper- and lowercase digits are accepted.
+func hex_decode(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	s, err := dataOf(fn, "s", x)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bytes(b), nil
+}
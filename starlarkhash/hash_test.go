@@ -0,0 +1,69 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkhash"
+	"go.starlark.net/starlarktest"
+)
+
+func init() {
+	// The tests make extensive use of these not-yet-standard features.
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+	resolve.AllowFloat = true
+}
+
+func Test(t *testing.T) {
+	filename := starlarktest.DataFile("starlarkhash", "testdata/hash.star")
+	thread := &starlark.Thread{Load: load}
+	starlarktest.SetReporter(thread, t)
+	if _, err := starlark.ExecFile(thread, filename, nil, nil); err != nil {
+		if err, ok := err.(*starlark.EvalError); ok {
+			t.Fatal(err.Backtrace())
+		}
+		t.Fatal(err)
+	}
+}
+
+// load implements the 'load' operation as used in the evaluator tests.
+func load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	switch module {
+	case "assert.star":
+		return starlarktest.LoadAssertModule()
+	case "hash.star":
+		return starlark.StringDict{"hash": starlarkhash.Module}, nil
+	}
+	return nil, nil
+}
+
+// TestFrozen tests that a frozen hasher cannot be updated,
+// but that its copies can.
+func TestFrozen(t *testing.T) {
+	h := starlarkhash.NewHasher("sha1")
+	h.Freeze()
+	thread := new(starlark.Thread)
+	predeclared := starlark.StringDict{"h": h}
+	_, err := starlark.ExecFile(thread, "frozen.star", `h.update("abc")`, predeclared)
+	if err == nil || !strings.Contains(err.Error(), "cannot update frozen hasher") {
+		t.Errorf("update of frozen hasher: got error %v", err)
+	}
+	globals, err := starlark.ExecFile(thread, "copy.star", `
+c = h.copy()
+c.update("abc")
+x = c.hexdigest()
+`, predeclared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := globals["x"], starlark.String("a9993e364706816aba3e25717850c26c9cd0d89d"); got != want {
+		t.Errorf("digest of copy = %s, want %s", got, want)
+	}
+}
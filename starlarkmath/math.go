@@ -0,0 +1,318 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarkmath defines the Starlark 'math' module of
+// mathematical functions, an optional language extension.
+//
+// Functions accept both ints and floats as arguments. Those that
+// return integral results (floor, ceil, trunc, gcd, lcm) return an
+// int, and are exact for int arguments of any size; the rest return
+// a float. A function called with an argument outside its domain,
+// such as sqrt(-1), fails with an error rather than returning NaN.
+//
+// The module defines the following constants and functions:
+//
+// 	e, inf, nan, pi, tau
+// 	acos asin atan atan2 ceil copysign cos cosh degrees exp fabs floor
+// 	gcd hypot isfinite isinf isnan lcm log log10 log2 pow radians sin
+// 	sinh sqrt tan tanh trunc
+package starlarkmath // import "go.starlark.net/starlarkmath"
+
+import (
+	"fmt"
+	"math"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module is the Starlark 'math' module.
+//
+// An application can make it available to load statements like so:
+//
+// 	thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+// 		if module == "math.star" {
+// 			return starlark.StringDict{"math": starlarkmath.Module}, nil
+// 		}
+// 		...
+// 	}
+//
+var Module = starlarkstruct.FromStringDict(starlark.String("math"), starlark.StringDict{
+	"e":   starlark.Float(math.E),
+	"inf": starlark.Float(math.Inf(+1)),
+	"nan": starlark.Float(math.NaN()),
+	"pi":  starlark.Float(math.Pi),
+	"tau": starlark.Float(2 * math.Pi),
+
+	"acos":     newUnaryBuiltin("acos", math.Acos),
+	"asin":     newUnaryBuiltin("asin", math.Asin),
+	"atan":     newUnaryBuiltin("atan", math.Atan),
+	"atan2":    newBinaryBuiltin("atan2", math.Atan2),
+	"ceil":     starlark.NewBuiltin("math.ceil", ceil),
+	"copysign": newBinaryBuiltin("copysign", math.Copysign),
+	"cos":      newUnaryBuiltin("cos", math.Cos),
+	"cosh":     newUnaryBuiltin("cosh", math.Cosh),
+	"degrees":  newUnaryBuiltin("degrees", func(x float64) float64 { return x * 180 / math.Pi }),
+	"exp":      newUnaryBuiltin("exp", math.Exp),
+	"fabs":     newUnaryBuiltin("fabs", math.Abs),
+	"floor":    starlark.NewBuiltin("math.floor", floor),
+	"gcd":      starlark.NewBuiltin("math.gcd", gcd),
+	"hypot":    newBinaryBuiltin("hypot", math.Hypot),
+	"isfinite": newPredicate("isfinite", func(x float64) bool { return !math.IsInf(x, 0) && !math.IsNaN(x) }),
+	"isinf":    newPredicate("isinf", func(x float64) bool { return math.IsInf(x, 0) }),
+	"isnan":    newPredicate("isnan", math.IsNaN),
+	"lcm":      starlark.NewBuiltin("math.lcm", lcm),
+	"log":      starlark.NewBuiltin("math.log", log),
+	"log10":    newUnaryBuiltin("log10", logFunc(math.Log10)),
+	"log2":     newUnaryBuiltin("log2", logFunc(math.Log2)),
+	"pow":      starlark.NewBuiltin("math.pow", pow),
+	"radians":  newUnaryBuiltin("radians", func(x float64) float64 { return x * math.Pi / 180 }),
+	"sin":      newUnaryBuiltin("sin", math.Sin),
+	"sinh":     newUnaryBuiltin("sinh", math.Sinh),
+	"sqrt":     newUnaryBuiltin("sqrt", math.Sqrt),
+	"tan":      newUnaryBuiltin("tan", math.Tan),
+	"tanh":     newUnaryBuiltin("tanh", math.Tanh),
+	"trunc":    starlark.NewBuiltin("math.trunc", trunc),
+})
+
+// floatArg returns the value of the ith argument of a call to fn,
+// which must be a float or an int.
+func floatArg(fn *starlark.Builtin, i int, x starlark.Value) (float64, error) {
+	f, ok := starlark.AsFloat(x)
+	if !ok {
+		return 0, fmt.Errorf("%s: for parameter %d: got %s, want float or int", fn.Name(), i+1, x.Type())
+	}
+	return f, nil
+}
+
+// floatArgs unpacks the n float or int arguments of a call to fn.
+func floatArgs(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, n int) ([]float64, error) {
+	vals := make([]starlark.Value, n)
+	ptrs := make([]interface{}, n)
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, n, ptrs...); err != nil {
+		return nil, err
+	}
+	fs := make([]float64, n)
+	for i, x := range vals {
+		f, err := floatArg(fn, i, x)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+// result returns the Starlark value of the result r of a call to fn
+// with float arguments args. A NaN result from non-NaN arguments
+// indicates that the arguments were outside the function's domain.
+func result(fn *starlark.Builtin, r float64, args ...float64) (starlark.Value, error) {
+	if math.IsNaN(r) {
+		for _, x := range args {
+			if math.IsNaN(x) {
+				return starlark.Float(r), nil
+			}
+		}
+		return nil, domainError(fn, args...)
+	}
+	return starlark.Float(r), nil
+}
+
+func domainError(fn *starlark.Builtin, args ...float64) error {
+	s := ""
+	for i, x := range args {
+		if i > 0 {
+			s += ", "
+		}
+		s += starlark.Float(x).String()
+	}
+	return fmt.Errorf("%s: math domain error (%s)", fn.Name(), s)
+}
+
+// newUnaryBuiltin returns a math module function that applies f to a number.
+func newUnaryBuiltin(name string, f func(float64) float64) *starlark.Builtin {
+	return starlark.NewBuiltin("math."+name, func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		xs, err := floatArgs(fn, args, kwargs, 1)
+		if err != nil {
+			return nil, err
+		}
+		return result(fn, f(xs[0]), xs[0])
+	})
+}
+
+// newBinaryBuiltin returns a math module function that applies f to two numbers.
+func newBinaryBuiltin(name string, f func(float64, float64) float64) *starlark.Builtin {
+	return starlark.NewBuiltin("math."+name, func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		xs, err := floatArgs(fn, args, kwargs, 2)
+		if err != nil {
+			return nil, err
+		}
+		return result(fn, f(xs[0], xs[1]), xs[0], xs[1])
+	})
+}
+
+// newPredicate returns a math module function that reports whether f holds for a number.
+func newPredicate(name string, f func(float64) bool) *starlark.Builtin {
+	return starlark.NewBuiltin("math."+name, func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		xs, err := floatArgs(fn, args, kwargs, 1)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Bool(f(xs[0])), nil
+	})
+}
+
+// logFunc returns a logarithm function that yields NaN, which
+// result reports as a domain error, for zero as well as negative
+// arguments.
+func logFunc(f func(float64) float64) func(float64) float64 {
+	return func(x float64) float64 {
+		if x == 0 {
+			return math.NaN()
+		}
+		return f(x)
+	}
+}
+
+// log(x, base=e) returns the logarithm of x in the specified base.
+func log(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x, base starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x, &base); err != nil {
+		return nil, err
+	}
+	f, err := floatArg(fn, 0, x)
+	if err != nil {
+		return nil, err
+	}
+	if f <= 0 {
+		return nil, domainError(fn, f)
+	}
+	if base == nil {
+		return result(fn, math.Log(f), f)
+	}
+	b, err := floatArg(fn, 1, base)
+	if err != nil {
+		return nil, err
+	}
+	if b <= 0 || b == 1 {
+		return nil, domainError(fn, f, b)
+	}
+	return result(fn, math.Log(f)/math.Log(b), f, b)
+}
+
+// pow(x, y) returns x raised to the power y, as a float.
+func pow(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	xs, err := floatArgs(fn, args, kwargs, 2)
+	if err != nil {
+		return nil, err
+	}
+	x, y := xs[0], xs[1]
+	if x == 0 && y < 0 {
+		return nil, domainError(fn, x, y) // Go would return ±Inf
+	}
+	return result(fn, math.Pow(x, y), x, y)
+}
+
+// ceil(x) returns the least int greater than or equal to x.
+func ceil(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return rounding(fn, args, kwargs, math.Ceil)
+}
+
+// floor(x) returns the greatest int less than or equal to x.
+func floor(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return rounding(fn, args, kwargs, math.Floor)
+}
+
+// trunc(x) returns the int nearest x in the direction of zero.
+func trunc(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return rounding(fn, args, kwargs, math.Trunc)
+}
+
+// rounding implements the functions that round a number to an int.
+// An int argument is returned unchanged, so the result is exact.
+func rounding(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, round func(float64) float64) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case starlark.Int:
+		return x, nil
+	case starlark.Float:
+		i, err := starlark.NumberToInt(starlark.Float(round(float64(x))))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		return i, nil
+	}
+	return nil, fmt.Errorf("%s: for parameter 1: got %s, want float or int", fn.Name(), x.Type())
+}
+
+// intArgs unpacks the int arguments of a call to fn.
+func intArgs(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) ([]starlark.Int, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	ints := make([]starlark.Int, len(args))
+	for i, arg := range args {
+		x, ok := arg.(starlark.Int)
+		if !ok {
+			return nil, fmt.Errorf("%s: for parameter %d: got %s, want int", fn.Name(), i+1, arg.Type())
+		}
+		ints[i] = x
+	}
+	return ints, nil
+}
+
+var zero = starlark.MakeInt(0)
+
+func abs(x starlark.Int) starlark.Int {
+	if x.Sign() < 0 {
+		return zero.Sub(x)
+	}
+	return x
+}
+
+// gcd(*ints) returns the greatest common divisor of its arguments,
+// which is zero if all are zero, or if there are none.
+func gcd(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	ints, err := intArgs(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	g := zero
+	for _, x := range ints {
+		g = gcd2(g, x)
+	}
+	return g, nil
+}
+
+// gcd2 returns the non-negative greatest common divisor of x and y.
+func gcd2(x, y starlark.Int) starlark.Int {
+	x, y = abs(x), abs(y)
+	for y.Sign() != 0 {
+		x, y = y, x.Mod(y)
+	}
+	return x
+}
+
+// lcm(*ints) returns the least common multiple of its arguments,
+// which is zero if any is zero, or one if there are none.
+func lcm(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	ints, err := intArgs(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	l := starlark.MakeInt(1)
+	for _, x := range ints {
+		if x.Sign() == 0 {
+			return zero, nil
+		}
+		l = abs(l.Mul(x)).Div(gcd2(l, x))
+	}
+	return l, nil
+}
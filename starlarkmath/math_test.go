@@ -0,0 +1,44 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkmath_test
+
+import (
+	"testing"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkmath"
+	"go.starlark.net/starlarktest"
+)
+
+func init() {
+	// The tests make extensive use of these not-yet-standard features.
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+	resolve.AllowFloat = true
+}
+
+func Test(t *testing.T) {
+	filename := starlarktest.DataFile("starlarkmath", "testdata/math.star")
+	thread := &starlark.Thread{Load: load}
+	starlarktest.SetReporter(thread, t)
+	if _, err := starlark.ExecFile(thread, filename, nil, nil); err != nil {
+		if err, ok := err.(*starlark.EvalError); ok {
+			t.Fatal(err.Backtrace())
+		}
+		t.Fatal(err)
+	}
+}
+
+// load implements the 'load' operation as used in the evaluator tests.
+func load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	switch module {
+	case "assert.star":
+		return starlarktest.LoadAssertModule()
+	case "math.star":
+		return starlark.StringDict{"math": starlarkmath.Module}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,803 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkproto
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A Message is a Starlark value that wraps a protocol buffer message.
+// Its attributes are the fields of the message.
+//
+// Assigning to a field checks the value against the field's type.
+// Assigning None clears the field. Assigning a message or a
+// collection copies it, so a message never aliases another.
+//
+// Reading a repeated or map field yields a view that updates the
+// message in place. Reading a message field yields the nested message
+// itself, so msg.a.b = 1 updates msg, unless the field is unset, in
+// which case the result is an immutable empty message.
+//
+// Freezing a message, or any value obtained from it, freezes the
+// entire message.
+type Message struct {
+	msg   protoreflect.Message
+	state *state // shared by all values obtained from the same message
+}
+
+var (
+	_ starlark.HasAttrs    = (*Message)(nil)
+	_ starlark.HasSetField = (*Message)(nil)
+	_ starlark.Comparable  = (*Message)(nil)
+)
+
+// A state holds the mutable state shared by all the values obtained
+// from the same message.
+type state struct {
+	frozen    bool
+	itercount map[fieldKey]int // number of active iterators of each repeated field (ignored if frozen)
+}
+
+// A fieldKey identifies a field of a particular message.
+type fieldKey struct {
+	msg protoreflect.ProtoMessage
+	fd  protoreflect.FieldDescriptor
+}
+
+// readOnly returns a new frozen state, for a read-only view of a
+// message, such as the immutable empty message that represents an
+// unset message field. Each view has its own state, so that freezing
+// one never writes to memory shared with another.
+func readOnly() *state { return &state{frozen: true} }
+
+// Wrap returns a new mutable Starlark message that wraps msg.
+// Updates made by Starlark code are visible to the caller.
+func Wrap(msg proto.Message) *Message {
+	return &Message{msg: msg.ProtoReflect(), state: new(state)}
+}
+
+// AsMessage returns the protocol message underlying x,
+// if x is a Starlark message.
+func AsMessage(x starlark.Value) (proto.Message, bool) {
+	if m, ok := x.(*Message); ok {
+		return m.Message(), true
+	}
+	return nil, false
+}
+
+// Message returns the protocol message underlying m.
+func (m *Message) Message() proto.Message { return m.msg.Interface() }
+
+func (m *Message) String() string {
+	var buf bytes.Buffer
+	view := &Message{msg: m.msg, state: readOnly()} // reading must not mutate
+	buf.WriteString(string(m.msg.Descriptor().FullName()))
+	buf.WriteByte('(')
+	fields := m.msg.Descriptor().Fields()
+	sep := ""
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.msg.Has(fd) {
+			continue
+		}
+		buf.WriteString(sep)
+		buf.WriteString(string(fd.Name()))
+		buf.WriteString(" = ")
+		buf.WriteString(view.get(fd).String())
+		sep = ", "
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+func (m *Message) Type() string {
+	if m == nil {
+		return "proto.Message" // for UnpackArgs' error message
+	}
+	return string(m.msg.Descriptor().FullName())
+}
+
+func (m *Message) Freeze()              { m.state.frozen = true }
+func (m *Message) Truth() starlark.Bool { return true }
+func (m *Message) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: %s", m.Type())
+}
+
+// field returns the descriptor of the named field.
+func (m *Message) field(name string) (protoreflect.FieldDescriptor, error) {
+	if fd := m.msg.Descriptor().Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd, nil
+	}
+	return nil, fmt.Errorf("%s has no .%s field", m.Type(), name)
+}
+
+func (m *Message) Attr(name string) (starlark.Value, error) {
+	fd, err := m.field(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.get(fd), nil
+}
+
+// AttrNames returns the names of the fields in declaration order.
+func (m *Message) AttrNames() []string {
+	fields := m.msg.Descriptor().Fields()
+	names := make([]string, fields.Len())
+	for i := range names {
+		names[i] = string(fields.Get(i).Name())
+	}
+	return names
+}
+
+// get returns the Starlark value of field fd.
+func (m *Message) get(fd protoreflect.FieldDescriptor) starlark.Value {
+	switch {
+	case fd.IsList():
+		if m.state.frozen {
+			return &RepeatedField{list: m.msg.Get(fd).List(), fd: fd, owner: m.msg.Interface(), state: m.state}
+		}
+		return &RepeatedField{list: m.msg.Mutable(fd).List(), fd: fd, owner: m.msg.Interface(), state: m.state}
+	case fd.IsMap():
+		if m.state.frozen {
+			return &MapField{m: m.msg.Get(fd).Map(), fd: fd, state: m.state}
+		}
+		return &MapField{m: m.msg.Mutable(fd).Map(), fd: fd, state: m.state}
+	case fd.Message() != nil:
+		if !m.msg.Has(fd) {
+			return &Message{msg: m.msg.Get(fd).Message(), state: readOnly()}
+		}
+		if m.state.frozen {
+			return &Message{msg: m.msg.Get(fd).Message(), state: m.state}
+		}
+		return &Message{msg: m.msg.Mutable(fd).Message(), state: m.state}
+	}
+	return toStarlark(fd, m.msg.Get(fd), m.state)
+}
+
+// SetField sets the named field to v, which must be a value of the
+// field's type, or None to clear it. It fails if the message is frozen.
+func (m *Message) SetField(name string, v starlark.Value) error {
+	if m.state.frozen {
+		return fmt.Errorf("cannot set .%s field of frozen %s message", name, m.Type())
+	}
+	fd, err := m.field(name)
+	if err != nil {
+		return err
+	}
+	if v == starlark.None {
+		m.msg.Clear(fd)
+		return nil
+	}
+	switch {
+	case fd.IsList():
+		iter := starlark.Iterate(v)
+		if iter == nil {
+			return fmt.Errorf("%s: got %s, want iterable", fd.FullName(), v.Type())
+		}
+		defer iter.Done()
+		list := m.msg.NewField(fd).List()
+		var x starlark.Value
+		for iter.Next(&x) {
+			elem, err := toProto(fd, x, list.NewElement)
+			if err != nil {
+				return err
+			}
+			list.Append(elem)
+		}
+		m.msg.Set(fd, protoreflect.ValueOfList(list))
+	case fd.IsMap():
+		var items []starlark.Tuple
+		switch v := v.(type) {
+		case *starlark.Dict:
+			items = v.Items()
+		case *MapField:
+			items = v.items()
+		default:
+			return fmt.Errorf("%s: got %s, want dict", fd.FullName(), v.Type())
+		}
+		mp := m.msg.NewField(fd).Map()
+		for _, item := range items {
+			if err := setMapEntry(mp, fd, item[0], item[1]); err != nil {
+				return err
+			}
+		}
+		m.msg.Set(fd, protoreflect.ValueOfMap(mp))
+	default:
+		x, err := toProto(fd, v, func() protoreflect.Value { return m.msg.NewField(fd) })
+		if err != nil {
+			return err
+		}
+		m.msg.Set(fd, x)
+	}
+	return nil
+}
+
+func (x *Message) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*Message)
+	switch op {
+	case syntax.EQL:
+		return messagesEqual(x.msg, y.msg), nil
+	case syntax.NEQ:
+		return !messagesEqual(x.msg, y.msg), nil
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+func messagesEqual(x, y protoreflect.Message) bool {
+	if x.IsValid() && y.IsValid() {
+		return proto.Equal(x.Interface(), y.Interface())
+	}
+	// An invalid message, such as the value of an unset field, is empty.
+	return x.Descriptor().FullName() == y.Descriptor().FullName() && isEmpty(x) && isEmpty(y)
+}
+
+func isEmpty(m protoreflect.Message) bool {
+	empty := len(m.GetUnknown()) == 0
+	m.Range(func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
+
+// A RepeatedField is a Starlark view of a repeated field of a message.
+// It behaves like a list whose elements must be of the field's type.
+type RepeatedField struct {
+	list  protoreflect.List
+	fd    protoreflect.FieldDescriptor
+	owner protoreflect.ProtoMessage // message containing the field
+	state *state
+}
+
+var (
+	_ starlark.Sequence    = (*RepeatedField)(nil)
+	_ starlark.Indexable   = (*RepeatedField)(nil)
+	_ starlark.HasSetIndex = (*RepeatedField)(nil)
+	_ starlark.HasAttrs    = (*RepeatedField)(nil)
+	_ starlark.Comparable  = (*RepeatedField)(nil)
+)
+
+func (r *RepeatedField) String() string {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < r.list.Len(); i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(r.Index(i).String())
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+func (r *RepeatedField) Type() string         { return "proto.repeated" }
+func (r *RepeatedField) Freeze()              { r.state.frozen = true }
+func (r *RepeatedField) Truth() starlark.Bool { return r.list.Len() > 0 }
+func (r *RepeatedField) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: proto.repeated")
+}
+func (r *RepeatedField) Len() int { return r.list.Len() }
+func (r *RepeatedField) Iterate() starlark.Iterator {
+	if !r.state.frozen {
+		if r.state.itercount == nil {
+			r.state.itercount = make(map[fieldKey]int)
+		}
+		r.state.itercount[r.key()]++
+	}
+	return &repeatedIterator{r: r}
+}
+
+func (r *RepeatedField) key() fieldKey { return fieldKey{r.owner, r.fd} }
+
+// checkMutable reports an error if the field should not be mutated.
+// verb+" repeated field" should describe the operation.
+func (r *RepeatedField) checkMutable(verb string) error {
+	if r.state.frozen {
+		return fmt.Errorf("cannot %s frozen repeated field %s", verb, r.fd.FullName())
+	}
+	if r.state.itercount[r.key()] > 0 {
+		return fmt.Errorf("cannot %s repeated field %s during iteration", verb, r.fd.FullName())
+	}
+	return nil
+}
+
+func (r *RepeatedField) Index(i int) starlark.Value {
+	return toStarlark(r.fd, r.list.Get(i), r.state)
+}
+
+func (r *RepeatedField) SetIndex(i int, v starlark.Value) error {
+	if err := r.checkMutable("assign to element of"); err != nil {
+		return err
+	}
+	x, err := toProto(r.fd, v, r.list.NewElement)
+	if err != nil {
+		return err
+	}
+	r.list.Set(i, x)
+	return nil
+}
+
+// append appends v to the field, checking its type.
+func (r *RepeatedField) append(v starlark.Value) error {
+	if err := r.checkMutable("append to"); err != nil {
+		return err
+	}
+	x, err := toProto(r.fd, v, r.list.NewElement)
+	if err != nil {
+		return err
+	}
+	r.list.Append(x)
+	return nil
+}
+
+func (r *RepeatedField) Attr(name string) (starlark.Value, error) {
+	if fn, ok := repeatedMethods[name]; ok {
+		return starlark.NewBuiltin(name, fn).BindReceiver(r), nil
+	}
+	return nil, nil
+}
+
+func (r *RepeatedField) AttrNames() []string { return []string{"append", "clear", "extend"} }
+
+var repeatedMethods = map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+	"append": repeated_append,
+	"clear":  repeated_clear,
+	"extend": repeated_extend,
+}
+
+func repeated_append(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	if err := fn.Receiver().(*RepeatedField).append(x); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+func repeated_clear(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	r := fn.Receiver().(*RepeatedField)
+	if err := r.checkMutable("clear"); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	r.list.Truncate(0)
+	return starlark.None, nil
+}
+
+func repeated_extend(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var iterable starlark.Iterable
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &iterable); err != nil {
+		return nil, err
+	}
+	r := fn.Receiver().(*RepeatedField)
+	// Collect the elements first, in case iterable is r itself.
+	var elems []starlark.Value
+	iter := iterable.Iterate()
+	var x starlark.Value
+	for iter.Next(&x) {
+		elems = append(elems, x)
+	}
+	iter.Done()
+	for _, x := range elems {
+		if err := r.append(x); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+	}
+	return starlark.None, nil
+}
+
+func (x *RepeatedField) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*RepeatedField)
+	switch op {
+	case syntax.EQL:
+		return sequencesEqual(x, y, depth)
+	case syntax.NEQ:
+		eq, err := sequencesEqual(x, y, depth)
+		return !eq, err
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+func sequencesEqual(x, y starlark.Indexable, depth int) (bool, error) {
+	if x.Len() != y.Len() {
+		return false, nil
+	}
+	for i := 0; i < x.Len(); i++ {
+		if eq, err := starlark.EqualDepth(x.Index(i), y.Index(i), depth-1); err != nil {
+			return false, err
+		} else if !eq {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type repeatedIterator struct {
+	r *RepeatedField
+	i int
+}
+
+func (it *repeatedIterator) Next(p *starlark.Value) bool {
+	if it.i < it.r.Len() {
+		*p = it.r.Index(it.i)
+		it.i++
+		return true
+	}
+	return false
+}
+
+func (it *repeatedIterator) Done() {
+	if st := it.r.state; !st.frozen {
+		k := it.r.key()
+		if st.itercount[k]--; st.itercount[k] == 0 {
+			delete(st.itercount, k)
+		}
+	}
+}
+
+// A MapField is a Starlark view of a map field of a message.
+// It behaves like a dict whose keys and values must be of the
+// field's key and value types. It iterates over its keys in
+// ascending order.
+type MapField struct {
+	m     protoreflect.Map
+	fd    protoreflect.FieldDescriptor
+	state *state
+}
+
+var (
+	_ starlark.Mapping    = (*MapField)(nil)
+	_ starlark.HasSetKey  = (*MapField)(nil)
+	_ starlark.Iterable   = (*MapField)(nil)
+	_ starlark.Sequence   = (*MapField)(nil)
+	_ starlark.HasAttrs   = (*MapField)(nil)
+	_ starlark.Comparable = (*MapField)(nil)
+)
+
+func (mf *MapField) String() string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, item := range mf.items() {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(item[0].String())
+		buf.WriteString(": ")
+		buf.WriteString(item[1].String())
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+func (mf *MapField) Type() string          { return "proto.map" }
+func (mf *MapField) Freeze()               { mf.state.frozen = true }
+func (mf *MapField) Truth() starlark.Bool  { return mf.m.Len() > 0 }
+func (mf *MapField) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: proto.map") }
+func (mf *MapField) Len() int              { return mf.m.Len() }
+
+func (mf *MapField) Iterate() starlark.Iterator {
+	keys := mf.keys()
+	elems := make([]starlark.Value, len(keys))
+	for i, k := range keys {
+		elems[i] = toStarlark(mf.fd.MapKey(), k.Value(), mf.state)
+	}
+	return starlark.NewList(elems).Iterate()
+}
+
+func (mf *MapField) Get(k starlark.Value) (v starlark.Value, found bool, err error) {
+	key, err := toProto(mf.fd.MapKey(), k, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if !mf.m.Has(key.MapKey()) {
+		return nil, false, nil
+	}
+	return toStarlark(mf.fd.MapValue(), mf.m.Get(key.MapKey()), mf.state), true, nil
+}
+
+func (mf *MapField) SetKey(k, v starlark.Value) error {
+	if mf.state.frozen {
+		return fmt.Errorf("cannot insert into frozen map field %s", mf.fd.FullName())
+	}
+	return setMapEntry(mf.m, mf.fd, k, v)
+}
+
+// setMapEntry sets the entry for key k of map field fd to v, checking their types.
+func setMapEntry(mp protoreflect.Map, fd protoreflect.FieldDescriptor, k, v starlark.Value) error {
+	key, err := toProto(fd.MapKey(), k, nil)
+	if err != nil {
+		return err
+	}
+	val, err := toProto(fd.MapValue(), v, mp.NewValue)
+	if err != nil {
+		return err
+	}
+	mp.Set(key.MapKey(), val)
+	return nil
+}
+
+// keys returns the keys of the map in ascending order.
+func (mf *MapField) keys() []protoreflect.MapKey {
+	keys := make([]protoreflect.MapKey, 0, mf.m.Len())
+	mf.m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		x, y := keys[i], keys[j]
+		switch x.Interface().(type) {
+		case bool:
+			return !x.Bool() && y.Bool()
+		case int32, int64:
+			return x.Int() < y.Int()
+		case uint32, uint64:
+			return x.Uint() < y.Uint()
+		}
+		return x.String() < y.String()
+	})
+	return keys
+}
+
+// items returns the (key, value) pairs of the map in ascending key order.
+func (mf *MapField) items() []starlark.Tuple {
+	keys := mf.keys()
+	items := make([]starlark.Tuple, len(keys))
+	for i, k := range keys {
+		items[i] = starlark.Tuple{
+			toStarlark(mf.fd.MapKey(), k.Value(), mf.state),
+			toStarlark(mf.fd.MapValue(), mf.m.Get(k), mf.state),
+		}
+	}
+	return items
+}
+
+func (mf *MapField) Attr(name string) (starlark.Value, error) {
+	if fn, ok := mapMethods[name]; ok {
+		return starlark.NewBuiltin(name, fn).BindReceiver(mf), nil
+	}
+	return nil, nil
+}
+
+func (mf *MapField) AttrNames() []string {
+	return []string{"clear", "get", "items", "keys", "values"}
+}
+
+var mapMethods = map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+	"clear":  map_clear,
+	"get":    map_get,
+	"items":  map_items,
+	"keys":   map_keys,
+	"values": map_values,
+}
+
+func map_clear(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	mf := fn.Receiver().(*MapField)
+	if mf.state.frozen {
+		return nil, fmt.Errorf("%s: cannot clear frozen map field %s", fn.Name(), mf.fd.FullName())
+	}
+	for _, k := range mf.keys() {
+		mf.m.Clear(k)
+	}
+	return starlark.None, nil
+}
+
+func map_get(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key, dflt starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &key, &dflt); err != nil {
+		return nil, err
+	}
+	if v, ok, err := fn.Receiver().(*MapField).Get(key); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	} else if ok {
+		return v, nil
+	} else if dflt != nil {
+		return dflt, nil
+	}
+	return starlark.None, nil
+}
+
+func map_items(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	items := fn.Receiver().(*MapField).items()
+	res := make([]starlark.Value, len(items))
+	for i, item := range items {
+		res[i] = item
+	}
+	return starlark.NewList(res), nil
+}
+
+func map_keys(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	items := fn.Receiver().(*MapField).items()
+	res := make([]starlark.Value, len(items))
+	for i, item := range items {
+		res[i] = item[0]
+	}
+	return starlark.NewList(res), nil
+}
+
+func map_values(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	items := fn.Receiver().(*MapField).items()
+	res := make([]starlark.Value, len(items))
+	for i, item := range items {
+		res[i] = item[1]
+	}
+	return starlark.NewList(res), nil
+}
+
+func (x *MapField) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*MapField)
+	switch op {
+	case syntax.EQL:
+		return mapsEqual(x, y, depth)
+	case syntax.NEQ:
+		eq, err := mapsEqual(x, y, depth)
+		return !eq, err
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+func mapsEqual(x, y *MapField, depth int) (bool, error) {
+	if x.Len() != y.Len() {
+		return false, nil
+	}
+	for _, item := range x.items() {
+		yv, found, err := y.Get(item[0])
+		if err != nil || !found {
+			return false, err
+		}
+		if eq, err := starlark.EqualDepth(item[1], yv, depth-1); err != nil {
+			return false, err
+		} else if !eq {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// toStarlark returns the Starlark value for a singular value v of field fd,
+// or of an element of fd if it is repeated. Nested messages share the
+// state of their parent.
+func toStarlark(fd protoreflect.FieldDescriptor, v protoreflect.Value, st *state) starlark.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return starlark.Bool(v.Bool())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return starlark.MakeInt64(v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return starlark.MakeUint64(v.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return starlark.Float(v.Float())
+	case protoreflect.StringKind:
+		return starlark.String(v.String())
+	case protoreflect.BytesKind:
+		return starlark.Bytes(v.Bytes())
+	case protoreflect.EnumKind:
+		return &EnumValue{enum: fd.Enum(), number: v.Enum()}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return &Message{msg: v.Message(), state: st}
+	}
+	panic(fmt.Sprintf("unexpected field kind %v", fd.Kind()))
+}
+
+// toProto converts the Starlark value v to a singular value of field
+// fd, or an element of fd if it is repeated, reporting an error if v
+// is not of the field's type. If fd is a message field, newMessage
+// must return a new empty message value, into which v is copied.
+func toProto(fd protoreflect.FieldDescriptor, v starlark.Value, newMessage func() protoreflect.Value) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, ok := v.(starlark.Bool); ok {
+			return protoreflect.ValueOfBool(bool(b)), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, ok := v.(starlark.Int); ok {
+			if x, ok := i.Int64(); ok && math.MinInt32 <= x && x <= math.MaxInt32 {
+				return protoreflect.ValueOfInt32(int32(x)), nil
+			}
+			return protoreflect.Value{}, outOfRange(fd, v)
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, ok := v.(starlark.Int); ok {
+			if x, ok := i.Int64(); ok {
+				return protoreflect.ValueOfInt64(x), nil
+			}
+			return protoreflect.Value{}, outOfRange(fd, v)
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if i, ok := v.(starlark.Int); ok {
+			if x, ok := i.Uint64(); ok && x <= math.MaxUint32 {
+				return protoreflect.ValueOfUint32(uint32(x)), nil
+			}
+			return protoreflect.Value{}, outOfRange(fd, v)
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if i, ok := v.(starlark.Int); ok {
+			if x, ok := i.Uint64(); ok {
+				return protoreflect.ValueOfUint64(x), nil
+			}
+			return protoreflect.Value{}, outOfRange(fd, v)
+		}
+	case protoreflect.FloatKind:
+		if f, ok := starlark.AsFloat(v); ok {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+	case protoreflect.DoubleKind:
+		if f, ok := starlark.AsFloat(v); ok {
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+	case protoreflect.StringKind:
+		if s, ok := v.(starlark.String); ok {
+			return protoreflect.ValueOfString(string(s)), nil
+		}
+	case protoreflect.BytesKind:
+		switch v := v.(type) {
+		case starlark.Bytes:
+			return protoreflect.ValueOfBytes([]byte(v)), nil
+		case starlark.String:
+			return protoreflect.ValueOfBytes([]byte(v)), nil
+		}
+	case protoreflect.EnumKind:
+		n, err := enumNumber(fd.Enum(), v)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%s: %v", fd.FullName(), err)
+		}
+		return protoreflect.ValueOfEnum(n), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if m, ok := v.(*Message); ok && m.msg.Descriptor().FullName() == fd.Message().FullName() {
+			x := newMessage()
+			proto.Merge(x.Message().Interface(), m.Message())
+			return x, nil
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("%s: got %s, want %s", fd.FullName(), v.Type(), typeName(fd))
+}
+
+func outOfRange(fd protoreflect.FieldDescriptor, v starlark.Value) error {
+	return fmt.Errorf("%s: %s out of range for %s", fd.FullName(), v, fd.Kind())
+}
+
+// typeName returns the name of the Starlark type of the values of field fd.
+func typeName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return "bool"
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return "float"
+	case protoreflect.StringKind:
+		return "string"
+	case protoreflect.BytesKind:
+		return "bytes"
+	case protoreflect.EnumKind:
+		return string(fd.Enum().FullName())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().FullName())
+	}
+	return "int"
+}
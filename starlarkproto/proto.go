@@ -0,0 +1,298 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarkproto defines the Starlark 'proto' module for
+// constructing, inspecting, and encoding protocol buffer messages,
+// an optional language extension.
+//
+// Message and enum types are described by file descriptors, typically
+// loaded from a FileDescriptorSet produced by the protocol compiler:
+//
+// 	protoc --include_imports --descriptor_set_out=foo.fds foo.proto
+//
+// A script obtains the types of a protocol buffer package from the
+// 'proto' module, and constructs typed messages by calling them:
+//
+// 	pb = proto.package("foo")
+// 	msg = pb.Foo(bar=1, tags=["a", "b"], color=pb.Color.RED)
+// 	data = proto.marshal(msg)
+//
+// Every field assignment is checked against the descriptor, so a
+// misspelled field name or a value of the wrong type is reported
+// at the point of the mistake. A Go application retrieves the
+// proto.Message underlying a Starlark message using AsMessage.
+package starlarkproto // import "go.starlark.net/starlarkproto"
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// LoadFileDescriptorSet reads the named files, each of which must
+// contain a binary-encoded FileDescriptorSet, and returns a registry
+// of all the files they describe. Each set must be complete with
+// respect to imports, as produced by protoc --include_imports,
+// though a file may appear in more than one set.
+func LoadFileDescriptorSet(filenames ...string) (*protoregistry.Files, error) {
+	var all descriptorpb.FileDescriptorSet
+	seen := make(map[string]bool)
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, file := range set.File {
+			if !seen[file.GetName()] {
+				seen[file.GetName()] = true
+				all.File = append(all.File, file)
+			}
+		}
+	}
+	return protodesc.NewFiles(&all)
+}
+
+// NewModule returns the Starlark 'proto' module, whose functions
+// operate on the message and enum types described by files.
+//
+// An application can add 'proto' to the Starlark environment like so:
+//
+// 	files, err := starlarkproto.LoadFileDescriptorSet("foo.fds")
+// 	...
+// 	globals := starlark.StringDict{
+// 		"proto": starlarkproto.NewModule(files),
+// 	}
+//
+func NewModule(files *protoregistry.Files) *starlarkstruct.Struct {
+	m := &module{files: files, types: dynamicpb.NewTypes(files)}
+	return starlarkstruct.FromStringDict(starlark.String("proto"), starlark.StringDict{
+		"has":            starlark.NewBuiltin("has", proto_has),
+		"marshal":        starlark.NewBuiltin("marshal", proto_marshal),
+		"marshal_json":   starlark.NewBuiltin("marshal_json", m.marshalJSON),
+		"marshal_text":   starlark.NewBuiltin("marshal_text", m.marshalText),
+		"package":        starlark.NewBuiltin("package", m.package_),
+		"unmarshal":      starlark.NewBuiltin("unmarshal", m.unmarshal),
+		"unmarshal_json": starlark.NewBuiltin("unmarshal_json", m.unmarshalJSON),
+		"unmarshal_text": starlark.NewBuiltin("unmarshal_text", m.unmarshalText),
+		"which_oneof":    starlark.NewBuiltin("which_oneof", proto_which_oneof),
+	})
+}
+
+// A module holds the state shared by the functions of a 'proto' module.
+type module struct {
+	files *protoregistry.Files
+	types *dynamicpb.Types // resolves google.protobuf.Any and extensions
+}
+
+// package(name) returns the package of the specified name.
+func (m *module) package_(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	if !hasPackage(m.files, protoreflect.FullName(name)) {
+		return nil, fmt.Errorf("%s: no such package %q", fn.Name(), name)
+	}
+	return &Package{files: m.files, name: protoreflect.FullName(name)}, nil
+}
+
+// hasPackage reports whether any file defines the named package or
+// one of its subpackages.
+func hasPackage(files *protoregistry.Files, name protoreflect.FullName) bool {
+	if files.NumFilesByPackage(name) > 0 {
+		return true
+	}
+	found := false
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		found = strings.HasPrefix(string(file.Package()), string(name)+".")
+		return !found
+	})
+	return found
+}
+
+// marshal(msg) returns the binary encoding of a message as bytes.
+// The encoding is deterministic.
+func proto_marshal(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *Message
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &msg); err != nil {
+		return nil, err
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg.Message())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bytes(data), nil
+}
+
+// marshal_text(msg) returns the text format encoding of a message.
+func (m *module) marshalText(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *Message
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &msg); err != nil {
+		return nil, err
+	}
+	data, err := prototext.MarshalOptions{Multiline: true, Resolver: m.types}.Marshal(msg.Message())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.String(data), nil
+}
+
+// marshal_json(msg, indent="") returns the JSON encoding of a message.
+// If indent is non-empty, the output is spread across multiple lines.
+func (m *module) marshalJSON(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *Message
+	var indent string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg, "indent?", &indent); err != nil {
+		return nil, err
+	}
+	opts := protojson.MarshalOptions{Indent: indent, Multiline: indent != "", Resolver: m.types}
+	data, err := opts.Marshal(msg.Message())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.String(data), nil
+}
+
+// unmarshal(type, data) decodes a message of the specified type
+// from its binary encoding, which may be bytes or a string.
+func (m *module) unmarshal(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return m.decode(fn, args, kwargs, func(data []byte, msg proto.Message) error {
+		return proto.UnmarshalOptions{Resolver: m.types}.Unmarshal(data, msg)
+	})
+}
+
+// unmarshal_text(type, text) decodes a message of the specified type
+// from its text format encoding.
+func (m *module) unmarshalText(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return m.decode(fn, args, kwargs, func(data []byte, msg proto.Message) error {
+		return prototext.UnmarshalOptions{Resolver: m.types}.Unmarshal(data, msg)
+	})
+}
+
+// unmarshal_json(type, text) decodes a message of the specified type
+// from its JSON encoding.
+func (m *module) unmarshalJSON(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return m.decode(fn, args, kwargs, func(data []byte, msg proto.Message) error {
+		return protojson.UnmarshalOptions{Resolver: m.types}.Unmarshal(data, msg)
+	})
+}
+
+// decode implements the unmarshal functions.
+func (m *module) decode(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, unmarshal func([]byte, proto.Message) error) (starlark.Value, error) {
+	var t *MessageType
+	var data starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &t, &data); err != nil {
+		return nil, err
+	}
+	var buf []byte
+	switch data := data.(type) {
+	case starlark.Bytes:
+		buf = []byte(data)
+	case starlark.String:
+		buf = []byte(data)
+	default:
+		return nil, fmt.Errorf("%s: for parameter 2: got %s, want bytes or string", fn.Name(), data.Type())
+	}
+	msg := t.New()
+	if err := unmarshal(buf, msg.Message()); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return msg, nil
+}
+
+// has(msg, field) reports whether the named field of a message is set.
+func proto_has(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *Message
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &name); err != nil {
+		return nil, err
+	}
+	fd, err := msg.field(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bool(msg.msg.Has(fd)), nil
+}
+
+// which_oneof(msg, oneof) returns the name of the field of the
+// named oneof that is set, or None if no field is set.
+func proto_which_oneof(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg *Message
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msg, &name); err != nil {
+		return nil, err
+	}
+	od := msg.msg.Descriptor().Oneofs().ByName(protoreflect.Name(name))
+	if od == nil {
+		return nil, fmt.Errorf("%s: %s has no oneof %s", fn.Name(), msg.Type(), name)
+	}
+	if fd := msg.msg.WhichOneof(od); fd != nil {
+		return starlark.String(fd.Name()), nil
+	}
+	return starlark.None, nil
+}
+
+// A Package is a Starlark value whose attributes are the top-level
+// message and enum types, and the subpackages, of a protocol buffer
+// package.
+type Package struct {
+	files *protoregistry.Files
+	name  protoreflect.FullName
+}
+
+var _ starlark.HasAttrs = (*Package)(nil)
+
+func (p *Package) String() string        { return fmt.Sprintf("<proto.Package %s>", p.name) }
+func (p *Package) Type() string          { return "proto.Package" }
+func (p *Package) Freeze()               {} // immutable
+func (p *Package) Truth() starlark.Bool  { return true }
+func (p *Package) Hash() (uint32, error) { return starlark.String(p.name).Hash() }
+
+func (p *Package) Attr(name string) (starlark.Value, error) {
+	fullname := p.name.Append(protoreflect.Name(name))
+	if d, err := p.files.FindDescriptorByName(fullname); err == nil {
+		switch d := d.(type) {
+		case protoreflect.MessageDescriptor:
+			return &MessageType{desc: d}, nil
+		case protoreflect.EnumDescriptor:
+			return &EnumType{desc: d}, nil
+		}
+	}
+	if hasPackage(p.files, fullname) {
+		return &Package{files: p.files, name: fullname}, nil
+	}
+	return nil, fmt.Errorf("proto package %s has no type %s", p.name, name)
+}
+
+// AttrNames returns the sorted names of the top-level types of the package.
+func (p *Package) AttrNames() []string {
+	var names []string
+	p.files.RangeFilesByPackage(p.name, func(file protoreflect.FileDescriptor) bool {
+		for i := 0; i < file.Messages().Len(); i++ {
+			names = append(names, string(file.Messages().Get(i).Name()))
+		}
+		for i := 0; i < file.Enums().Len(); i++ {
+			names = append(names, string(file.Enums().Get(i).Name()))
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkproto_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkproto"
+	"go.starlark.net/starlarktest"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func init() {
+	// The tests make extensive use of these not-yet-standard features.
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+	resolve.AllowFloat = true
+	resolve.AllowBitwise = true
+}
+
+// loadTestFiles loads the descriptor of testdata/test.proto
+// by way of a binary FileDescriptorSet in a temporary file.
+func loadTestFiles(t *testing.T) *protoregistry.Files {
+	testdata := starlarktest.DataFile("starlarkproto", "testdata")
+	text, err := ioutil.ReadFile(filepath.Join(testdata, "test.fds.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := prototext.Unmarshal(text, &fds); err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(&fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "starlarkproto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.fds")
+	if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	// Loading the same set twice must not report duplicate files.
+	files, err := starlarkproto.LoadFileDescriptorSet(filename, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func Test(t *testing.T) {
+	files := loadTestFiles(t)
+	filename := starlarktest.DataFile("starlarkproto", "testdata/proto.star")
+	thread := &starlark.Thread{Load: load}
+	starlarktest.SetReporter(thread, t)
+	predeclared := starlark.StringDict{
+		"proto": starlarkproto.NewModule(files),
+	}
+	if _, err := starlark.ExecFile(thread, filename, nil, predeclared); err != nil {
+		if err, ok := err.(*starlark.EvalError); ok {
+			t.Fatal(err.Backtrace())
+		}
+		t.Fatal(err)
+	}
+}
+
+// load implements the 'load' operation as used in the evaluator tests.
+func load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	if module == "assert.star" {
+		return starlarktest.LoadAssertModule()
+	}
+	return nil, nil
+}
+
+// TestAsMessage tests the exchange of messages between Go and Starlark.
+func TestAsMessage(t *testing.T) {
+	files := loadTestFiles(t)
+	desc, err := files.FindDescriptorByName("starlarkproto.test.Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := desc.(protoreflect.MessageDescriptor)
+
+	// A message from Go, updated by Starlark.
+	in := dynamicpb.NewMessage(md)
+	in.Set(md.Fields().ByName("id"), protoreflect.ValueOfInt32(7))
+
+	thread := new(starlark.Thread)
+	predeclared := starlark.StringDict{
+		"proto":  starlarkproto.NewModule(files),
+		"person": starlarkproto.Wrap(in),
+	}
+	globals, err := starlark.ExecFile(thread, "msg.star", `
+pb = proto.package("starlarkproto.test")
+person.name = "updated"
+out = pb.Person(name="Bob", id=person.id + 1, emails=["bob@example.com"], scores={"x": 1})
+`, predeclared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := in.Get(md.Fields().ByName("name")).String(); got != "updated" {
+		t.Errorf("in.name = %q, want %q", got, "updated")
+	}
+
+	out, ok := starlarkproto.AsMessage(globals["out"])
+	if !ok {
+		t.Fatalf("AsMessage(%s) failed", globals["out"].Type())
+	}
+	want := dynamicpb.NewMessage(md)
+	if err := prototext.Unmarshal([]byte(`name: "Bob" id: 8 emails: "bob@example.com" scores { key: "x" value: 1 }`), want); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(out, want) {
+		t.Errorf("out = %v, want %v", prototext.Format(out), prototext.Format(want))
+	}
+	if _, ok := starlarkproto.AsMessage(starlark.None); ok {
+		t.Errorf("AsMessage(None) succeeded")
+	}
+}
+
+// TestFreezeViews tests that freezing the read-only views of unset
+// message fields of distinct messages, concurrently, is not a data race.
+func TestFreezeViews(t *testing.T) {
+	files := loadTestFiles(t)
+	desc, err := files.FindDescriptorByName("starlarkproto.test.Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := desc.(protoreflect.MessageDescriptor)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		m := starlarkproto.Wrap(dynamicpb.NewMessage(md))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr, err := m.Attr("address")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			addr.Freeze()
+		}()
+	}
+	wg.Wait()
+}
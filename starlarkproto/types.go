@@ -0,0 +1,274 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkproto
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// A MessageType is a Starlark value that represents a protocol
+// buffer message type. Calling it with keyword arguments, one per
+// field, returns a new message of that type. Its attributes are the
+// message and enum types nested within it.
+type MessageType struct {
+	desc protoreflect.MessageDescriptor
+}
+
+var (
+	_ starlark.HasAttrs   = (*MessageType)(nil)
+	_ starlark.Callable   = (*MessageType)(nil)
+	_ starlark.Comparable = (*MessageType)(nil)
+)
+
+// NewMessageType returns the Starlark value for the message type described by desc.
+func NewMessageType(desc protoreflect.MessageDescriptor) *MessageType {
+	return &MessageType{desc: desc}
+}
+
+func (t *MessageType) String() string {
+	return fmt.Sprintf("<proto.MessageType %s>", t.desc.FullName())
+}
+func (t *MessageType) Type() string          { return "proto.MessageType" }
+func (t *MessageType) Freeze()               {} // immutable
+func (t *MessageType) Truth() starlark.Bool  { return true }
+func (t *MessageType) Hash() (uint32, error) { return starlark.String(t.desc.FullName()).Hash() }
+func (t *MessageType) Name() string          { return string(t.desc.FullName()) }
+
+// Descriptor returns the descriptor of the message type.
+func (t *MessageType) Descriptor() protoreflect.MessageDescriptor { return t.desc }
+
+// New returns a new, empty, mutable message of type t.
+func (t *MessageType) New() *Message {
+	return &Message{msg: dynamicpb.NewMessage(t.desc), state: new(state)}
+}
+
+func (t *MessageType) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("%s: unexpected positional arguments", t.desc.FullName())
+	}
+	msg := t.New()
+	for _, kwarg := range kwargs {
+		if err := msg.SetField(string(kwarg[0].(starlark.String)), kwarg[1]); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func (t *MessageType) Attr(name string) (starlark.Value, error) {
+	if md := t.desc.Messages().ByName(protoreflect.Name(name)); md != nil {
+		return &MessageType{desc: md}, nil
+	}
+	if ed := t.desc.Enums().ByName(protoreflect.Name(name)); ed != nil {
+		return &EnumType{desc: ed}, nil
+	}
+	return nil, fmt.Errorf("proto message type %s has no nested type %s", t.desc.FullName(), name)
+}
+
+// AttrNames returns the names of the nested message and enum types,
+// excluding the synthetic entry types of map fields.
+func (t *MessageType) AttrNames() []string {
+	var names []string
+	for i := 0; i < t.desc.Messages().Len(); i++ {
+		if md := t.desc.Messages().Get(i); !md.IsMapEntry() {
+			names = append(names, string(md.Name()))
+		}
+	}
+	for i := 0; i < t.desc.Enums().Len(); i++ {
+		names = append(names, string(t.desc.Enums().Get(i).Name()))
+	}
+	return names
+}
+
+func (x *MessageType) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*MessageType)
+	switch op {
+	case syntax.EQL:
+		return x.desc.FullName() == y.desc.FullName(), nil
+	case syntax.NEQ:
+		return x.desc.FullName() != y.desc.FullName(), nil
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+// An EnumType is a Starlark value that represents a protocol buffer
+// enum type. Its attributes are the values of the enum. Calling it
+// with the name or number of a value returns that value.
+type EnumType struct {
+	desc protoreflect.EnumDescriptor
+}
+
+var (
+	_ starlark.HasAttrs   = (*EnumType)(nil)
+	_ starlark.Callable   = (*EnumType)(nil)
+	_ starlark.Comparable = (*EnumType)(nil)
+)
+
+// NewEnumType returns the Starlark value for the enum type described by desc.
+func NewEnumType(desc protoreflect.EnumDescriptor) *EnumType {
+	return &EnumType{desc: desc}
+}
+
+func (t *EnumType) String() string        { return fmt.Sprintf("<proto.EnumType %s>", t.desc.FullName()) }
+func (t *EnumType) Type() string          { return "proto.EnumType" }
+func (t *EnumType) Freeze()               {} // immutable
+func (t *EnumType) Truth() starlark.Bool  { return true }
+func (t *EnumType) Hash() (uint32, error) { return starlark.String(t.desc.FullName()).Hash() }
+func (t *EnumType) Name() string          { return string(t.desc.FullName()) }
+
+// Descriptor returns the descriptor of the enum type.
+func (t *EnumType) Descriptor() protoreflect.EnumDescriptor { return t.desc }
+
+func (t *EnumType) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(t.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	n, err := enumNumber(t.desc, x)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", t.Name(), err)
+	}
+	return &EnumValue{enum: t.desc, number: n}, nil
+}
+
+func (t *EnumType) Attr(name string) (starlark.Value, error) {
+	if vd := t.desc.Values().ByName(protoreflect.Name(name)); vd != nil {
+		return &EnumValue{enum: t.desc, number: vd.Number()}, nil
+	}
+	return nil, fmt.Errorf("proto enum %s has no value %s", t.desc.FullName(), name)
+}
+
+// AttrNames returns the names of the enum values in declaration order.
+func (t *EnumType) AttrNames() []string {
+	values := t.desc.Values()
+	names := make([]string, values.Len())
+	for i := range names {
+		names[i] = string(values.Get(i).Name())
+	}
+	return names
+}
+
+func (x *EnumType) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*EnumType)
+	switch op {
+	case syntax.EQL:
+		return x.desc.FullName() == y.desc.FullName(), nil
+	case syntax.NEQ:
+		return x.desc.FullName() != y.desc.FullName(), nil
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+// An EnumValue is a value of a protocol buffer enum type.
+// Its type, as reported by the Starlark 'type' function, is the full
+// name of the enum. Values of the same enum are ordered by number.
+type EnumValue struct {
+	enum   protoreflect.EnumDescriptor
+	number protoreflect.EnumNumber
+}
+
+var (
+	_ starlark.HasAttrs   = (*EnumValue)(nil)
+	_ starlark.Comparable = (*EnumValue)(nil)
+)
+
+func (v *EnumValue) String() string {
+	if vd := v.enum.Values().ByNumber(v.number); vd != nil {
+		return fmt.Sprintf("%s.%s", v.enum.FullName(), vd.Name())
+	}
+	return fmt.Sprintf("%s(%d)", v.enum.FullName(), v.number) // unknown value
+}
+
+func (v *EnumValue) Type() string {
+	if v == nil {
+		return "proto.EnumValue" // for UnpackArgs' error message
+	}
+	return string(v.enum.FullName())
+}
+
+func (v *EnumValue) Freeze()              {} // immutable
+func (v *EnumValue) Truth() starlark.Bool { return v.number != 0 }
+func (v *EnumValue) Hash() (uint32, error) {
+	h, _ := starlark.String(v.enum.FullName()).Hash()
+	return h ^ uint32(v.number)*9839, nil
+}
+
+// Number returns the number of the enum value.
+func (v *EnumValue) Number() protoreflect.EnumNumber { return v.number }
+
+// Descriptor returns the descriptor of the enum type of the value.
+func (v *EnumValue) Descriptor() protoreflect.EnumDescriptor { return v.enum }
+
+func (v *EnumValue) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		if vd := v.enum.Values().ByNumber(v.number); vd != nil {
+			return starlark.String(vd.Name()), nil
+		}
+		return starlark.None, nil
+	case "number":
+		return starlark.MakeInt(int(v.number)), nil
+	}
+	return nil, nil
+}
+
+func (v *EnumValue) AttrNames() []string { return []string{"name", "number"} }
+
+func (x *EnumValue) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*EnumValue)
+	if x.enum.FullName() != y.enum.FullName() {
+		switch op {
+		case syntax.EQL:
+			return false, nil
+		case syntax.NEQ:
+			return true, nil
+		}
+		return false, fmt.Errorf("cannot compare values of distinct enums %s and %s", x.Type(), y.Type())
+	}
+	switch op {
+	case syntax.EQL:
+		return x.number == y.number, nil
+	case syntax.NEQ:
+		return x.number != y.number, nil
+	case syntax.LT:
+		return x.number < y.number, nil
+	case syntax.LE:
+		return x.number <= y.number, nil
+	case syntax.GT:
+		return x.number > y.number, nil
+	case syntax.GE:
+		return x.number >= y.number, nil
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+// enumNumber returns the number of the value of enum ed denoted by v,
+// which may be an EnumValue of that enum, or the name or number of one
+// of its values.
+func enumNumber(ed protoreflect.EnumDescriptor, v starlark.Value) (protoreflect.EnumNumber, error) {
+	switch v := v.(type) {
+	case *EnumValue:
+		if v.enum.FullName() == ed.FullName() {
+			return v.number, nil
+		}
+	case starlark.String:
+		if vd := ed.Values().ByName(protoreflect.Name(v)); vd != nil {
+			return vd.Number(), nil
+		}
+		return 0, fmt.Errorf("%s has no value %s", ed.FullName(), v)
+	case starlark.Int:
+		n, err := starlark.AsInt32(v)
+		if err != nil || ed.Values().ByNumber(protoreflect.EnumNumber(n)) == nil {
+			return 0, fmt.Errorf("%s has no value with number %s", ed.FullName(), v)
+		}
+		return protoreflect.EnumNumber(n), nil
+	}
+	return 0, fmt.Errorf("got %s, want %s", v.Type(), ed.FullName())
+}
@@ -0,0 +1,643 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarkre defines the Starlark 're' module of regular
+// expressions, an optional language extension.
+//
+// The module resembles Python's re module, but its patterns use the
+// RE2 syntax of Go's regexp package, so matching takes time linear in
+// the size of the input. RE2 does not support backreferences within
+// patterns or lookaround assertions; flags are set inline, as in (?i).
+// Positions are byte offsets, consistent with string indexing.
+//
+// The module has the following functions, each of which accepts
+// a pattern as either a string or a compiled pattern:
+//
+// 	compile(pattern)                         # returns a compiled pattern
+// 	match(pattern, string)                   # match at the start of string, or None
+// 	search(pattern, string)                  # first match anywhere in string, or None
+// 	fullmatch(pattern, string)               # match of the entire string, or None
+// 	findall(pattern, string)                 # list of matched strings or groups
+// 	finditer(pattern, string)                # list of match objects
+// 	sub(pattern, repl, string, count=0)      # replaces matches by repl
+// 	split(pattern, string, maxsplit=0)       # splits string at matches
+// 	escape(string)                           # quotes metacharacters
+//
+// A compiled pattern has methods of the same names, without the
+// pattern parameter. It is immutable and hashable.
+package starlarkre // import "go.starlark.net/starlarkre"
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	resyntax "regexp/syntax"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// Module is the Starlark 're' module.
+//
+// An application can make it available to load statements like so:
+//
+// 	thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+// 		if module == "re.star" {
+// 			return starlark.StringDict{"re": starlarkre.Module}, nil
+// 		}
+// 		...
+// 	}
+//
+var Module = starlarkstruct.FromStringDict(starlark.String("re"), starlark.StringDict{
+	"compile":   starlark.NewBuiltin("re.compile", compile),
+	"escape":    starlark.NewBuiltin("re.escape", escape),
+	"findall":   newFunction("findall"),
+	"finditer":  newFunction("finditer"),
+	"fullmatch": newFunction("fullmatch"),
+	"match":     newFunction("match"),
+	"search":    newFunction("search"),
+	"split":     newFunction("split"),
+	"sub":       newFunction("sub"),
+})
+
+// Compile returns the compiled pattern for the regular expression expr.
+func Compile(expr string) (*Pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := anchor(expr, false)
+	if err != nil {
+		return nil, err
+	}
+	complete, err := anchor(expr, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{re: re, prefix: prefix, complete: complete}, nil
+}
+
+// anchor compiles expr anchored at the start of the text and, if
+// complete, at its end. The anchors are added to the syntax tree, not
+// to the text of expr, which cannot safely be embedded in a larger
+// expression: consider `\Qa.b`, which quotes all that follows it.
+// The anchored variants do not alter the group numbering.
+func anchor(expr string, complete bool) (*regexp.Regexp, error) {
+	re, err := resyntax.Parse(expr, resyntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	subs := []*resyntax.Regexp{{Op: resyntax.OpBeginText}, re}
+	if complete {
+		subs = append(subs, &resyntax.Regexp{Op: resyntax.OpEndText})
+	}
+	return regexp.Compile((&resyntax.Regexp{Op: resyntax.OpConcat, Sub: subs}).String())
+}
+
+// compile(pattern) returns the compiled pattern.
+func compile(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &pattern); err != nil {
+		return nil, err
+	}
+	return patternOf(fn, pattern)
+}
+
+// escape(string) returns string with all regular expression
+// metacharacters escaped.
+func escape(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	return starlark.String(regexp.QuoteMeta(s)), nil
+}
+
+// patternOf returns the compiled pattern denoted by x,
+// which is either a compiled pattern or a string.
+func patternOf(fn *starlark.Builtin, x starlark.Value) (*Pattern, error) {
+	switch x := x.(type) {
+	case *Pattern:
+		return x, nil
+	case starlark.String:
+		p, err := Compile(string(x))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("%s: for parameter 1: got %s, want string or re.pattern", fn.Name(), x.Type())
+}
+
+// newFunction returns the module-level function of the specified
+// name, which compiles its first argument and calls the pattern
+// method of the same name with the remaining arguments.
+func newFunction(name string) *starlark.Builtin {
+	method := patternMethods[name]
+	return starlark.NewBuiltin("re."+name, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: missing pattern argument", fn.Name())
+		}
+		p, err := patternOf(fn, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return method(thread, starlark.NewBuiltin(fn.Name(), method).BindReceiver(p), args[1:], kwargs)
+	})
+}
+
+// A Pattern is a compiled regular expression.
+type Pattern struct {
+	re       *regexp.Regexp
+	prefix   *regexp.Regexp // anchored at start, for match
+	complete *regexp.Regexp // anchored at both ends, for fullmatch
+}
+
+var (
+	_ starlark.HasAttrs   = (*Pattern)(nil)
+	_ starlark.Comparable = (*Pattern)(nil)
+)
+
+// Regexp returns the Go regular expression underlying the pattern.
+func (p *Pattern) Regexp() *regexp.Regexp { return p.re }
+
+func (p *Pattern) String() string {
+	return fmt.Sprintf("re.compile(%s)", starlark.String(p.re.String()))
+}
+func (p *Pattern) Type() string          { return "re.pattern" }
+func (p *Pattern) Freeze()               {} // immutable
+func (p *Pattern) Truth() starlark.Bool  { return true }
+func (p *Pattern) Hash() (uint32, error) { return starlark.String(p.re.String()).Hash() }
+
+func (p *Pattern) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "pattern":
+		return starlark.String(p.re.String()), nil
+	case "groups":
+		return starlark.MakeInt(p.re.NumSubexp()), nil
+	case "groupindex":
+		dict := new(starlark.Dict)
+		for i, name := range p.re.SubexpNames() {
+			if name != "" {
+				dict.SetKey(starlark.String(name), starlark.MakeInt(i))
+			}
+		}
+		return dict, nil
+	}
+	if method, ok := patternMethods[name]; ok {
+		return starlark.NewBuiltin(name, method).BindReceiver(p), nil
+	}
+	return nil, nil
+}
+
+func (p *Pattern) AttrNames() []string {
+	return []string{
+		"findall", "finditer", "fullmatch", "groupindex", "groups",
+		"match", "pattern", "search", "split", "sub",
+	}
+}
+
+func (x *Pattern) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*Pattern)
+	switch op {
+	case syntax.EQL:
+		return x.re.String() == y.re.String(), nil
+	case syntax.NEQ:
+		return x.re.String() != y.re.String(), nil
+	}
+	return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+}
+
+var patternMethods = map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+	"findall":   pattern_findall,
+	"finditer":  pattern_finditer,
+	"fullmatch": pattern_fullmatch,
+	"match":     pattern_match,
+	"search":    pattern_search,
+	"split":     pattern_split,
+	"sub":       pattern_sub,
+}
+
+// find returns the first match of re in s, or None.
+func (p *Pattern) find(re *regexp.Regexp, s string) starlark.Value {
+	if loc := re.FindStringSubmatchIndex(s); loc != nil {
+		return &Match{pattern: p, s: s, loc: loc}
+	}
+	return starlark.None
+}
+
+func pattern_match(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+	return p.find(p.prefix, s), nil
+}
+
+func pattern_search(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+	return p.find(p.re, s), nil
+}
+
+func pattern_fullmatch(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+	return p.find(p.complete, s), nil
+}
+
+// findall returns a list of all non-overlapping matches. If the
+// pattern has no groups, each element is the matched string; if it
+// has one, the string matched by that group; otherwise a tuple of the
+// strings matched by each group. Unmatched groups yield "".
+func pattern_findall(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+	var elems []starlark.Value
+	for _, loc := range p.re.FindAllStringSubmatchIndex(s, -1) {
+		m := &Match{pattern: p, s: s, loc: loc}
+		switch n := p.re.NumSubexp(); n {
+		case 0:
+			elems = append(elems, m.groupString(0))
+		case 1:
+			elems = append(elems, m.groupString(1))
+		default:
+			groups := make(starlark.Tuple, n)
+			for i := range groups {
+				groups[i] = m.groupString(i + 1)
+			}
+			elems = append(elems, groups)
+		}
+	}
+	return starlark.NewList(elems), nil
+}
+
+// finditer returns a list of match objects for all non-overlapping matches.
+func pattern_finditer(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+	var elems []starlark.Value
+	for _, loc := range p.re.FindAllStringSubmatchIndex(s, -1) {
+		elems = append(elems, &Match{pattern: p, s: s, loc: loc})
+	}
+	return starlark.NewList(elems), nil
+}
+
+// split(string, maxsplit=0) splits string at each match, up to maxsplit
+// times if it is positive. The strings matched by any groups of the
+// pattern are included in the result; unmatched groups yield None.
+func pattern_split(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	maxsplit := 0
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "string", &s, "maxsplit?", &maxsplit); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+	n := -1
+	if maxsplit > 0 {
+		n = maxsplit
+	}
+	var elems []starlark.Value
+	last := 0
+	for _, loc := range p.re.FindAllStringSubmatchIndex(s, n) {
+		elems = append(elems, starlark.String(s[last:loc[0]]))
+		m := &Match{pattern: p, s: s, loc: loc}
+		for i := 1; i <= p.re.NumSubexp(); i++ {
+			elems = append(elems, m.group(i))
+		}
+		last = loc[1]
+	}
+	elems = append(elems, starlark.String(s[last:]))
+	return starlark.NewList(elems), nil
+}
+
+// sub(repl, string, count=0) returns string with each non-overlapping
+// match, up to count of them if count is positive, replaced by repl.
+// If repl is a string, the escapes \n or \g<n> (for a group number)
+// and \g<name> (for a group name) are replaced by the group's match,
+// and \\ by a backslash. Otherwise repl must be a function, which is
+// called with each match object and must return a string.
+func pattern_sub(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var repl starlark.Value
+	var s string
+	count := 0
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "repl", &repl, "string", &s, "count?", &count); err != nil {
+		return nil, err
+	}
+	p := fn.Receiver().(*Pattern)
+
+	var replace func(m *Match) (string, error)
+	switch repl := repl.(type) {
+	case starlark.String:
+		tmpl, err := parseTemplate(p, string(repl))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		replace = func(m *Match) (string, error) { return tmpl.expand(m), nil }
+	case starlark.Callable:
+		replace = func(m *Match) (string, error) {
+			v, err := starlark.Call(thread, repl, starlark.Tuple{m}, nil)
+			if err != nil {
+				return "", err
+			}
+			s, ok := starlark.AsString(v)
+			if !ok {
+				return "", fmt.Errorf("%s: repl function returned %s, want string", fn.Name(), v.Type())
+			}
+			return s, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s: for parameter repl: got %s, want string or function", fn.Name(), repl.Type())
+	}
+
+	n := -1
+	if count > 0 {
+		n = count
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range p.re.FindAllStringSubmatchIndex(s, n) {
+		buf.WriteString(s[last:loc[0]])
+		r, err := replace(&Match{pattern: p, s: s, loc: loc})
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(r)
+		last = loc[1]
+	}
+	buf.WriteString(s[last:])
+	return starlark.String(buf.String()), nil
+}
+
+// A template is a parsed replacement string of sub.
+// It alternates literal text with group references.
+type template struct {
+	literals []string // len(literals) == len(groups)+1
+	groups   []int
+}
+
+func parseTemplate(p *Pattern, repl string) (*template, error) {
+	t := new(template)
+	var lit strings.Builder
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		if c != '\\' || i+1 == len(repl) {
+			lit.WriteByte(c)
+			continue
+		}
+		i++
+		var group int
+		switch c = repl[i]; {
+		case c == '\\':
+			lit.WriteByte('\\')
+			continue
+		case '0' <= c && c <= '9':
+			j := i
+			for j < len(repl) && j < i+2 && '0' <= repl[j] && repl[j] <= '9' {
+				j++
+			}
+			group, _ = strconv.Atoi(repl[i:j])
+			i = j - 1
+		case c == 'g':
+			end := strings.IndexByte(repl[i:], '>')
+			if i+1 >= len(repl) || repl[i+1] != '<' || end < 0 {
+				return nil, fmt.Errorf("missing group name in \\g escape of replacement %q", repl)
+			}
+			name := repl[i+2 : i+end]
+			if n, err := strconv.Atoi(name); err == nil {
+				group = n
+			} else if group = p.re.SubexpIndex(name); group < 0 {
+				return nil, fmt.Errorf("unknown group name %q in replacement", name)
+			}
+			i += end
+		default:
+			lit.WriteByte('\\')
+			lit.WriteByte(c)
+			continue
+		}
+		if group < 0 || group > p.re.NumSubexp() {
+			return nil, fmt.Errorf("invalid group reference %d in replacement", group)
+		}
+		t.literals = append(t.literals, lit.String())
+		t.groups = append(t.groups, group)
+		lit.Reset()
+	}
+	t.literals = append(t.literals, lit.String())
+	return t, nil
+}
+
+// expand returns the replacement text for match m.
+func (t *template) expand(m *Match) string {
+	var buf bytes.Buffer
+	for i, g := range t.groups {
+		buf.WriteString(t.literals[i])
+		if start := m.loc[2*g]; start >= 0 {
+			buf.WriteString(m.s[start:m.loc[2*g+1]])
+		}
+	}
+	buf.WriteString(t.literals[len(t.groups)])
+	return buf.String()
+}
+
+// A Match is the result of a successful match of a pattern against a string.
+type Match struct {
+	pattern *Pattern
+	s       string
+	loc     []int // start and end of each group, as from FindStringSubmatchIndex
+}
+
+var _ starlark.HasAttrs = (*Match)(nil)
+
+func (m *Match) String() string {
+	return fmt.Sprintf("<re.match span=(%d, %d), match=%s>", m.loc[0], m.loc[1], m.groupString(0))
+}
+func (m *Match) Type() string         { return "re.match" }
+func (m *Match) Freeze()              {} // immutable
+func (m *Match) Truth() starlark.Bool { return true }
+func (m *Match) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: re.match")
+}
+
+// group returns the string matched by group i, or None if it did not participate.
+func (m *Match) group(i int) starlark.Value {
+	if m.loc[2*i] < 0 {
+		return starlark.None
+	}
+	return starlark.String(m.s[m.loc[2*i]:m.loc[2*i+1]])
+}
+
+// groupString returns the string matched by group i, or "" if it did not participate.
+func (m *Match) groupString(i int) starlark.String {
+	if m.loc[2*i] < 0 {
+		return ""
+	}
+	return starlark.String(m.s[m.loc[2*i]:m.loc[2*i+1]])
+}
+
+// groupIndex returns the index of the group denoted by x,
+// a group number or name.
+func (m *Match) groupIndex(x starlark.Value) (int, error) {
+	switch x := x.(type) {
+	case starlark.Int:
+		if i, err := starlark.AsInt32(x); err == nil && 0 <= i && i <= m.pattern.re.NumSubexp() {
+			return i, nil
+		}
+	case starlark.String:
+		if i := m.pattern.re.SubexpIndex(string(x)); i >= 0 {
+			return i, nil
+		}
+	default:
+		return 0, fmt.Errorf("got %s, want int or string", x.Type())
+	}
+	return 0, fmt.Errorf("no such group: %s", x)
+}
+
+func (m *Match) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "string":
+		return starlark.String(m.s), nil
+	case "re":
+		return m.pattern, nil
+	}
+	if method, ok := matchMethods[name]; ok {
+		return starlark.NewBuiltin(name, method).BindReceiver(m), nil
+	}
+	return nil, nil
+}
+
+func (m *Match) AttrNames() []string {
+	return []string{"end", "group", "groupdict", "groups", "re", "span", "start", "string"}
+}
+
+var matchMethods = map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+	"end":       match_end,
+	"group":     match_group,
+	"groupdict": match_groupdict,
+	"groups":    match_groups,
+	"span":      match_span,
+	"start":     match_start,
+}
+
+// group(*groups) returns the string matched by a group, identified
+// by number or name, or None if it did not participate in the match.
+// With no arguments, it returns the entire match; with more than one,
+// a tuple of results.
+func match_group(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	m := fn.Receiver().(*Match)
+	if len(args) == 0 {
+		return m.group(0), nil
+	}
+	res := make(starlark.Tuple, len(args))
+	for i, arg := range args {
+		g, err := m.groupIndex(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		res[i] = m.group(g)
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+// groups(default=None) returns a tuple of the strings matched by each
+// group, with default in place of groups that did not participate.
+func match_groups(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var dflt starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	m := fn.Receiver().(*Match)
+	res := make(starlark.Tuple, m.pattern.re.NumSubexp())
+	for i := range res {
+		if res[i] = m.group(i + 1); res[i] == starlark.None {
+			res[i] = dflt
+		}
+	}
+	return res, nil
+}
+
+// groupdict(default=None) returns a dict mapping the name of each named
+// group to the string it matched, or default if it did not participate.
+func match_groupdict(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var dflt starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	m := fn.Receiver().(*Match)
+	dict := new(starlark.Dict)
+	for i, name := range m.pattern.re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		v := m.group(i)
+		if v == starlark.None {
+			v = dflt
+		}
+		dict.SetKey(starlark.String(name), v)
+	}
+	return dict, nil
+}
+
+// groupBounds implements start, end, and span, which return -1
+// for a group that did not participate in the match.
+func groupBounds(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (start, end int, err error) {
+	var g starlark.Value = starlark.MakeInt(0)
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0, &g); err != nil {
+		return 0, 0, err
+	}
+	m := fn.Receiver().(*Match)
+	i, err := m.groupIndex(g)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return m.loc[2*i], m.loc[2*i+1], nil
+}
+
+// start(group=0) returns the start offset of a group's match.
+func match_start(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	start, _, err := groupBounds(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(start), nil
+}
+
+// end(group=0) returns the end offset of a group's match.
+func match_end(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	_, end, err := groupBounds(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(end), nil
+}
+
+// span(group=0) returns the (start, end) offsets of a group's match.
+func match_span(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	start, end, err := groupBounds(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Tuple{starlark.MakeInt(start), starlark.MakeInt(end)}, nil
+}
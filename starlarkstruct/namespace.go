@@ -0,0 +1,195 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkstruct
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// MakeNamespace is the implementation of a built-in function that
+// instantiates a mutable namespace from the specified keyword arguments.
+//
+// An application can add 'namespace' to the Starlark environment like so:
+//
+// 	globals := starlark.StringDict{
+// 		"namespace": starlark.NewBuiltin("namespace", starlarkstruct.MakeNamespace),
+// 	}
+//
+func MakeNamespace(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("namespace: unexpected positional arguments")
+	}
+	ns := NewNamespace()
+	for _, kwarg := range kwargs {
+		ns.set(string(kwarg[0].(starlark.String)), kwarg[1])
+	}
+	return ns, nil
+}
+
+// A Namespace is a mutable Starlark type that maps field names to
+// values. Unlike a Struct, its fields may be updated, and new fields
+// added, using assignments such as ns.f = x, until it is frozen.
+// Its fields are enumerated in the order in which they were first set.
+//
+// A Namespace is hashable only once frozen.
+type Namespace struct {
+	entries []entry        // in insertion order
+	index   map[string]int // maps name to index in entries
+	frozen  bool
+}
+
+var (
+	_ starlark.HasAttrs    = (*Namespace)(nil)
+	_ starlark.HasSetField = (*Namespace)(nil)
+	_ starlark.Comparable  = (*Namespace)(nil)
+)
+
+// NewNamespace returns a new empty namespace.
+func NewNamespace() *Namespace {
+	return &Namespace{index: make(map[string]int)}
+}
+
+// Len returns the number of fields of the namespace.
+func (ns *Namespace) Len() int { return len(ns.entries) }
+
+// Field returns the name and value of the ith field of the namespace,
+// in insertion order.
+func (ns *Namespace) Field(i int) (string, starlark.Value) {
+	e := ns.entries[i]
+	return e.name, e.value
+}
+
+// Get returns the value of the named field, if present.
+func (ns *Namespace) Get(name string) (v starlark.Value, found bool) {
+	if i, ok := ns.index[name]; ok {
+		return ns.entries[i].value, true
+	}
+	return nil, false
+}
+
+// ToStringDict adds a name/value entry to d for each field of the namespace.
+func (ns *Namespace) ToStringDict(d starlark.StringDict) {
+	for _, e := range ns.entries {
+		d[e.name] = e.value
+	}
+}
+
+// set sets the value of the named field, adding it if necessary.
+func (ns *Namespace) set(name string, v starlark.Value) {
+	if i, ok := ns.index[name]; ok {
+		ns.entries[i].value = v
+	} else {
+		ns.index[name] = len(ns.entries)
+		ns.entries = append(ns.entries, entry{name, v})
+	}
+}
+
+func (ns *Namespace) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("namespace(")
+	for i, e := range ns.entries {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(e.name)
+		buf.WriteString(" = ")
+		buf.WriteString(e.value.String())
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+func (ns *Namespace) Type() string         { return "namespace" }
+func (ns *Namespace) Truth() starlark.Bool { return true } // even when empty
+
+func (ns *Namespace) Freeze() {
+	if !ns.frozen {
+		ns.frozen = true
+		for _, e := range ns.entries {
+			e.value.Freeze()
+		}
+	}
+}
+
+func (ns *Namespace) Hash() (uint32, error) {
+	if !ns.frozen {
+		return 0, fmt.Errorf("unhashable type: namespace (not frozen)")
+	}
+	// Same algorithm as Struct.Hash, but independent of field order,
+	// since equality is too.
+	var x uint32 = 8731
+	for _, e := range ns.entries {
+		namehash, _ := starlark.String(e.name).Hash()
+		y, err := e.value.Hash()
+		if err != nil {
+			return 0, err
+		}
+		x += namehash*3 ^ y*9839
+	}
+	return x, nil
+}
+
+func (ns *Namespace) Attr(name string) (starlark.Value, error) {
+	if v, ok := ns.Get(name); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("namespace has no .%s attribute", name)
+}
+
+// AttrNames returns a new list of the namespace's fields, in insertion order.
+func (ns *Namespace) AttrNames() []string {
+	names := make([]string, len(ns.entries))
+	for i, e := range ns.entries {
+		names[i] = e.name
+	}
+	return names
+}
+
+// SetField sets the value of the named field, adding it if necessary.
+// It fails if the namespace is frozen.
+func (ns *Namespace) SetField(name string, v starlark.Value) error {
+	if ns.frozen {
+		return fmt.Errorf("cannot set .%s field of frozen namespace", name)
+	}
+	ns.set(name, v)
+	return nil
+}
+
+func (x *Namespace) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*Namespace)
+	switch op {
+	case syntax.EQL:
+		return namespacesEqual(x, y, depth)
+	case syntax.NEQ:
+		eq, err := namespacesEqual(x, y, depth)
+		return !eq, err
+	default:
+		return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+	}
+}
+
+// namespacesEqual reports whether x and y have the same fields
+// with equal values, regardless of insertion order.
+func namespacesEqual(x, y *Namespace, depth int) (bool, error) {
+	if x.Len() != y.Len() {
+		return false, nil
+	}
+	for _, e := range x.entries {
+		yv, ok := y.Get(e.name)
+		if !ok {
+			return false, nil
+		}
+		if eq, err := starlark.EqualDepth(e.value, yv, depth-1); err != nil {
+			return false, err
+		} else if !eq {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,426 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarkstruct
+
+// This file defines record types: named struct-like types with a
+// fixed set of declared fields, each of which may have a default value
+// and a type constraint.
+//
+// Unlike a Struct, which accepts any field names, a record rejects
+// unknown fields both when it is constructed and when its fields are
+// read or written, so that misspelled field names are reported
+// promptly rather than silently producing the wrong value.
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// MakeRecordType is the implementation of a built-in function that
+// defines a new record type.
+// It takes two parameters, the name of the type and a list of its
+// fields, each of which is either a string, for a mandatory field of
+// any type, or a field descriptor created by the 'field' built-in.
+//
+// An application can add 'record' and 'field' to the Starlark
+// environment like so:
+//
+// 	globals := starlark.StringDict{
+// 		"record": starlark.NewBuiltin("record", starlarkstruct.MakeRecordType),
+// 		"field":  starlark.NewBuiltin("field", starlarkstruct.MakeField),
+// 	}
+//
+// Example:
+//
+// 	Point = record(name="Point", fields=["x", "y", field("z", type="int", default=0)])
+// 	p = Point(x=1, y=2)
+//
+func MakeRecordType(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var fields starlark.Iterable
+	if err := starlark.UnpackArgs("record", args, kwargs, "name", &name, "fields", &fields); err != nil {
+		return nil, err
+	}
+
+	var fieldList []*Field
+	iter := fields.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		switch x := x.(type) {
+		case starlark.String:
+			fieldList = append(fieldList, &Field{name: string(x), mandatory: true})
+		case *Field:
+			fieldList = append(fieldList, x)
+		default:
+			return nil, fmt.Errorf("record: got %s in fields, want string or field", x.Type())
+		}
+	}
+	return NewRecordType(name, fieldList)
+}
+
+// MakeField is the implementation of a built-in function that creates
+// a field descriptor for use in a call to 'record'.
+//
+// Its parameters are the name of the field; its type, which is either
+// None, a type name as reported by the built-in 'type' function, or
+// a record type; its default value; and whether it is mandatory.
+// A field is mandatory by default unless it has a default value.
+// An optional field with no default value defaults to None.
+func MakeField(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var typ, dflt, mandatory starlark.Value
+	if err := starlark.UnpackArgs("field", args, kwargs,
+		"name", &name, "type?", &typ, "default?", &dflt, "mandatory?", &mandatory); err != nil {
+		return nil, err
+	}
+	f := &Field{name: name, dflt: dflt}
+	switch typ := typ.(type) {
+	case nil, starlark.NoneType:
+		// no type constraint
+	case starlark.String:
+		f.typ = string(typ)
+	case *RecordType:
+		f.rtype = typ
+	default:
+		return nil, fmt.Errorf("field: for parameter type: got %s, want string or record type", typ.Type())
+	}
+	if mandatory != nil {
+		f.mandatory = bool(mandatory.Truth())
+	} else {
+		f.mandatory = dflt == nil
+	}
+	if f.mandatory && dflt != nil {
+		return nil, fmt.Errorf("field: mandatory field %s cannot have a default value", name)
+	}
+	if dflt != nil {
+		if err := f.check(dflt); err != nil {
+			return nil, fmt.Errorf("field %s: invalid default: %v", name, err)
+		}
+	}
+	return f, nil
+}
+
+// A Field describes one field of a record type.
+// It is an immutable Starlark value created by the 'field' built-in.
+type Field struct {
+	name      string
+	typ       string      // if non-empty, the required Type() of the value
+	rtype     *RecordType // if non-nil, the required record type of the value
+	dflt      starlark.Value
+	mandatory bool
+}
+
+var _ starlark.HasAttrs = (*Field)(nil)
+
+// NewField returns a new field descriptor.
+// If typ is non-empty, the values of the field must have that type.
+// If dflt is nil, the field is mandatory.
+func NewField(name, typ string, dflt starlark.Value) *Field {
+	return &Field{name: name, typ: typ, dflt: dflt, mandatory: dflt == nil}
+}
+
+func (f *Field) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "field(%q", f.name)
+	if t := f.typeName(); t != "" {
+		fmt.Fprintf(&buf, ", type = %q", t)
+	}
+	if f.dflt != nil {
+		fmt.Fprintf(&buf, ", default = %s", f.dflt)
+	}
+	if !f.mandatory && f.dflt == nil {
+		buf.WriteString(", mandatory = False")
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+func (f *Field) Type() string          { return "field" }
+func (f *Field) Freeze()               {} // immutable; default frozen by RecordType
+func (f *Field) Truth() starlark.Bool  { return true }
+func (f *Field) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: field") }
+
+// Name returns the name of the field.
+func (f *Field) Name() string { return f.name }
+
+// Default returns the default value of the field, or nil if it has none.
+func (f *Field) Default() starlark.Value { return f.dflt }
+
+// Mandatory reports whether a value for the field must be provided
+// when the record is constructed.
+func (f *Field) Mandatory() bool { return f.mandatory }
+
+func (f *Field) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(f.name), nil
+	case "type":
+		if t := f.typeName(); t != "" {
+			return starlark.String(t), nil
+		}
+		return starlark.None, nil
+	case "default":
+		if f.dflt != nil {
+			return f.dflt, nil
+		}
+		return starlark.None, nil
+	case "mandatory":
+		return starlark.Bool(f.mandatory), nil
+	}
+	return nil, nil
+}
+
+func (f *Field) AttrNames() []string { return []string{"default", "mandatory", "name", "type"} }
+
+// typeName returns the name of the type required by the field, or "" if none.
+func (f *Field) typeName() string {
+	if f.rtype != nil {
+		return f.rtype.name
+	}
+	return f.typ
+}
+
+// check reports an error if v is not a valid value for the field.
+func (f *Field) check(v starlark.Value) error {
+	if v == starlark.None && !f.mandatory && f.dflt == nil {
+		return nil // an optional field without a default may hold None
+	}
+	if f.rtype != nil {
+		if r, ok := v.(*Record); !ok || r.rtype != f.rtype {
+			return fmt.Errorf("got %s, want %s", v.Type(), f.rtype.name)
+		}
+	} else if f.typ != "" && v.Type() != f.typ {
+		return fmt.Errorf("got %s, want %s", v.Type(), f.typ)
+	}
+	return nil
+}
+
+// A RecordType is a Starlark value that describes a named record type
+// with a fixed set of fields.  Calling it creates a new Record.
+type RecordType struct {
+	name   string
+	fields []*Field
+	index  map[string]int // maps field name to index in fields
+}
+
+var (
+	_ starlark.Callable = (*RecordType)(nil)
+	_ starlark.HasAttrs = (*RecordType)(nil)
+)
+
+// NewRecordType returns a new record type with the specified name and fields.
+// The default values of the fields are frozen, as they are shared by all
+// instances of the type.
+func NewRecordType(name string, fields []*Field) (*RecordType, error) {
+	if name == "" {
+		return nil, fmt.Errorf("record: empty name")
+	}
+	rt := &RecordType{
+		name:   name,
+		fields: fields,
+		index:  make(map[string]int, len(fields)),
+	}
+	for i, f := range fields {
+		if f.name == "" {
+			return nil, fmt.Errorf("record %s: empty field name", name)
+		}
+		if _, dup := rt.index[f.name]; dup {
+			return nil, fmt.Errorf("record %s: duplicate field %s", name, f.name)
+		}
+		rt.index[f.name] = i
+		if f.dflt != nil {
+			f.dflt.Freeze()
+		}
+	}
+	return rt, nil
+}
+
+func (rt *RecordType) String() string        { return fmt.Sprintf("<record %s>", rt.name) }
+func (rt *RecordType) Type() string          { return "record_type" }
+func (rt *RecordType) Freeze()               {} // immutable
+func (rt *RecordType) Truth() starlark.Bool  { return true }
+func (rt *RecordType) Hash() (uint32, error) { return starlark.String(rt.name).Hash() }
+
+// Name returns the name of the record type.
+func (rt *RecordType) Name() string { return rt.name }
+
+// NumFields returns the number of fields of the record type.
+func (rt *RecordType) NumFields() int { return len(rt.fields) }
+
+// Field returns the ith field of the record type.
+func (rt *RecordType) Field(i int) *Field { return rt.fields[i] }
+
+func (rt *RecordType) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(rt.name), nil
+	case "fields":
+		fields := make(starlark.Tuple, len(rt.fields))
+		for i, f := range rt.fields {
+			fields[i] = f
+		}
+		return fields, nil
+	}
+	return nil, nil
+}
+
+func (rt *RecordType) AttrNames() []string { return []string{"fields", "name"} }
+
+func (rt *RecordType) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("%s: unexpected positional arguments", rt.name)
+	}
+	values := make([]starlark.Value, len(rt.fields))
+	for _, kwarg := range kwargs {
+		k := string(kwarg[0].(starlark.String))
+		i, ok := rt.index[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected field %s", rt.name, k)
+		}
+		if err := rt.fields[i].check(kwarg[1]); err != nil {
+			return nil, fmt.Errorf("%s: field %s: %v", rt.name, k, err)
+		}
+		values[i] = kwarg[1]
+	}
+	for i, f := range rt.fields {
+		if values[i] == nil {
+			if f.mandatory {
+				return nil, fmt.Errorf("%s: missing mandatory field %s", rt.name, f.name)
+			}
+			if f.dflt != nil {
+				values[i] = f.dflt
+			} else {
+				values[i] = starlark.None
+			}
+		}
+	}
+	return &Record{rtype: rt, values: values}, nil
+}
+
+// A Record is an instance of a RecordType.
+// Its fields may be updated until it is frozen,
+// after which it is immutable and hashable.
+type Record struct {
+	rtype  *RecordType
+	values []starlark.Value // parallel to rtype.fields
+	frozen bool
+}
+
+var (
+	_ starlark.HasAttrs    = (*Record)(nil)
+	_ starlark.HasSetField = (*Record)(nil)
+	_ starlark.Comparable  = (*Record)(nil)
+)
+
+// RecordType returns the type of the record.
+func (r *Record) RecordType() *RecordType { return r.rtype }
+
+func (r *Record) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(r.rtype.name)
+	buf.WriteByte('(')
+	for i, f := range r.rtype.fields {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(f.name)
+		buf.WriteString(" = ")
+		buf.WriteString(r.values[i].String())
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// Type returns the name of the record type.
+func (r *Record) Type() string         { return r.rtype.name }
+func (r *Record) Truth() starlark.Bool { return true }
+
+func (r *Record) Freeze() {
+	if !r.frozen {
+		r.frozen = true
+		for _, v := range r.values {
+			v.Freeze()
+		}
+	}
+}
+
+func (r *Record) Hash() (uint32, error) {
+	if !r.frozen {
+		return 0, fmt.Errorf("unhashable type: %s (not frozen)", r.rtype.name)
+	}
+	// Same algorithm as Struct.Hash.
+	x, _ := starlark.String(r.rtype.name).Hash()
+	var m uint32 = 9839
+	for _, v := range r.values {
+		y, err := v.Hash()
+		if err != nil {
+			return 0, err
+		}
+		x = x ^ y*m
+		m += 7349
+	}
+	return x, nil
+}
+
+func (r *Record) Attr(name string) (starlark.Value, error) {
+	if i, ok := r.rtype.index[name]; ok {
+		return r.values[i], nil
+	}
+	return nil, fmt.Errorf("%s has no .%s field", r.rtype.name, name)
+}
+
+// AttrNames returns the names of the record's fields, in declaration order.
+func (r *Record) AttrNames() []string {
+	names := make([]string, len(r.rtype.fields))
+	for i, f := range r.rtype.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+func (r *Record) SetField(name string, v starlark.Value) error {
+	i, ok := r.rtype.index[name]
+	if !ok {
+		return fmt.Errorf("%s has no .%s field", r.rtype.name, name)
+	}
+	if r.frozen {
+		return fmt.Errorf("cannot set .%s field of frozen %s", name, r.rtype.name)
+	}
+	if err := r.rtype.fields[i].check(v); err != nil {
+		return fmt.Errorf("%s.%s: %v", r.rtype.name, name, err)
+	}
+	r.values[i] = v
+	return nil
+}
+
+func (x *Record) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(*Record)
+	switch op {
+	case syntax.EQL:
+		return recordsEqual(x, y, depth)
+	case syntax.NEQ:
+		eq, err := recordsEqual(x, y, depth)
+		return !eq, err
+	default:
+		return false, fmt.Errorf("%s %s %s not implemented", x.Type(), op, y.Type())
+	}
+}
+
+func recordsEqual(x, y *Record, depth int) (bool, error) {
+	if x.rtype != y.rtype {
+		return false, nil
+	}
+	for i := range x.values {
+		if eq, err := starlark.EqualDepth(x.values[i], y.values[i], depth-1); err != nil {
+			return false, err
+		} else if !eq {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -27,17 +27,58 @@ func Test(t *testing.T) {
 	testdata := starlarktest.DataFile("starlarkstruct", ".")
 	thread := &starlark.Thread{Load: load}
 	starlarktest.SetReporter(thread, t)
-	filename := filepath.Join(testdata, "testdata/struct.star")
 	predeclared := starlark.StringDict{
-		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
-		"gensym": starlark.NewBuiltin("gensym", gensym),
+		"struct":    starlark.NewBuiltin("struct", starlarkstruct.Make),
+		"gensym":    starlark.NewBuiltin("gensym", gensym),
+		"record":    starlark.NewBuiltin("record", starlarkstruct.MakeRecordType),
+		"field":     starlark.NewBuiltin("field", starlarkstruct.MakeField),
+		"namespace": starlark.NewBuiltin("namespace", starlarkstruct.MakeNamespace),
 	}
-	if _, err := starlark.ExecFile(thread, filename, nil, predeclared); err != nil {
-		if err, ok := err.(*starlark.EvalError); ok {
-			t.Fatal(err.Backtrace())
+	for _, file := range []string{
+		"testdata/struct.star",
+		"testdata/record.star",
+		"testdata/namespace.star",
+	} {
+		filename := filepath.Join(testdata, file)
+		if _, err := starlark.ExecFile(thread, filename, nil, predeclared); err != nil {
+			if err, ok := err.(*starlark.EvalError); ok {
+				t.Fatal(err.Backtrace())
+			}
+			t.Fatal(err)
 		}
+	}
+}
+
+func TestNamespaceFields(t *testing.T) {
+	thread := new(starlark.Thread)
+	predeclared := starlark.StringDict{
+		"namespace": starlark.NewBuiltin("namespace", starlarkstruct.MakeNamespace),
+	}
+	globals, err := starlark.ExecFile(thread, "ns.star", `
+ns = namespace(c=1, a=2)
+ns.b = 3
+ns.c = 4
+`, predeclared)
+	if err != nil {
 		t.Fatal(err)
 	}
+	ns := globals["ns"].(*starlarkstruct.Namespace)
+	var got []string
+	for i := 0; i < ns.Len(); i++ {
+		name, v := ns.Field(i)
+		got = append(got, fmt.Sprintf("%s=%v", name, v))
+	}
+	if got, want := fmt.Sprint(got), "[c=4 a=2 b=3]"; got != want {
+		t.Errorf("fields = %s, want %s", got, want)
+	}
+
+	// ExecFile freezes the module globals.
+	if err := ns.SetField("d", starlark.None); err == nil {
+		t.Errorf("SetField on frozen namespace succeeded")
+	}
+	if _, ok := ns.Get("d"); ok {
+		t.Errorf("Get(d) found a field that should not exist")
+	}
 }
 
 // load implements the 'load' operation as used in the evaluator tests.
@@ -0,0 +1,506 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarktime defines the Starlark 'time' module of time
+// instants, durations, and time zones, an optional language extension.
+//
+// The module defines two data types, time and duration, which are
+// immutable, hashable, and ordered. They support these operators:
+//
+// 	time + duration = time         duration + duration = duration
+// 	time - duration = time         duration - duration = duration
+// 	time - time = duration         duration * int = duration
+// 	                               duration / duration = float
+// 	                               duration / int = duration
+// 	                               duration // duration = int
+//
+// and the module has the following members:
+//
+// 	nanosecond, microsecond, millisecond, second, minute, hour  # durations
+// 	now()                          # the current time
+// 	time(year, month=1, day=1, hour=0, minute=0, second=0, nanosecond=0, location="UTC")
+// 	from_timestamp(sec, nsec=0)    # the time of a Unix timestamp, in UTC
+// 	parse_time(x, format=RFC3339, location="UTC")
+// 	parse_duration(x)              # parses a duration such as "1h30m"
+// 	is_valid_timezone(name)        # reports whether a time zone name is known
+//
+// Layouts for parsing and formatting are those of Go's time package.
+// Time zones are loaded by name from the host's time zone database.
+//
+// An application that needs deterministic evaluation may fix the
+// time returned by now() using SetNow.
+package starlarktime // import "go.starlark.net/starlarktime"
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// Module is the Starlark 'time' module.
+//
+// An application can make it available to load statements like so:
+//
+// 	thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+// 		if module == "time.star" {
+// 			return starlark.StringDict{"time": starlarktime.Module}, nil
+// 		}
+// 		...
+// 	}
+//
+var Module = starlarkstruct.FromStringDict(starlark.String("time"), starlark.StringDict{
+	"nanosecond":  Duration(time.Nanosecond),
+	"microsecond": Duration(time.Microsecond),
+	"millisecond": Duration(time.Millisecond),
+	"second":      Duration(time.Second),
+	"minute":      Duration(time.Minute),
+	"hour":        Duration(time.Hour),
+
+	"from_timestamp":    starlark.NewBuiltin("time.from_timestamp", fromTimestamp),
+	"is_valid_timezone": starlark.NewBuiltin("time.is_valid_timezone", isValidTimezone),
+	"now":               starlark.NewBuiltin("time.now", now),
+	"parse_duration":    starlark.NewBuiltin("time.parse_duration", parseDuration),
+	"parse_time":        starlark.NewBuiltin("time.parse_time", parseTime),
+	"time":              starlark.NewBuiltin("time.time", newTime),
+})
+
+// NowFunc is the default implementation of now() for threads that
+// have no function set by SetNow.
+var NowFunc = time.Now
+
+const nowKey = "go.starlark.net/starlarktime.now" // thread-local key
+
+// SetNow sets the function that now() calls to obtain the current
+// time when executed by the specified thread. For deterministic
+// evaluation, the function may return a fixed time.
+func SetNow(thread *starlark.Thread, now func() time.Time) {
+	thread.SetLocal(nowKey, now)
+}
+
+// now() returns the current time.
+func now(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	nowFunc := NowFunc
+	if f, ok := thread.Local(nowKey).(func() time.Time); ok {
+		nowFunc = f
+	}
+	return Time(nowFunc().Round(0)), nil // strip the monotonic clock reading
+}
+
+// loadLocation returns the time zone of the specified name,
+// such as "UTC", "Local", or "America/New_York".
+func loadLocation(fn *starlark.Builtin, name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return loc, nil
+}
+
+// time(year, month=1, day=1, hour=0, minute=0, second=0, nanosecond=0, location="UTC")
+// returns the time of the specified calendar date and clock reading in a
+// time zone. Out-of-range values are normalized, so October 32 is November 1.
+func newTime(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var year, hour, minute, second, nanosecond int
+	month, day := 1, 1
+	location := "UTC"
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"year", &year,
+		"month?", &month,
+		"day?", &day,
+		"hour?", &hour,
+		"minute?", &minute,
+		"second?", &second,
+		"nanosecond?", &nanosecond,
+		"location?", &location,
+	); err != nil {
+		return nil, err
+	}
+	loc, err := loadLocation(fn, location)
+	if err != nil {
+		return nil, err
+	}
+	return Time(time.Date(year, time.Month(month), day, hour, minute, second, nanosecond, loc)), nil
+}
+
+// from_timestamp(sec, nsec=0) returns the UTC time of the
+// specified number of seconds and nanoseconds since the Unix epoch.
+func fromTimestamp(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var sec, nsec starlark.Int
+	nsec = starlark.MakeInt(0)
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &sec, &nsec); err != nil {
+		return nil, err
+	}
+	s, ok1 := sec.Int64()
+	ns, ok2 := nsec.Int64()
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%s: timestamp out of range", fn.Name())
+	}
+	return Time(time.Unix(s, ns).UTC()), nil
+}
+
+// parse_time(x, format=RFC3339, location="UTC") parses a time using a
+// layout of Go's time package. The location is the time zone of times
+// that do not specify one.
+func parseTime(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x string
+	format := time.RFC3339
+	location := "UTC"
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "x", &x, "format?", &format, "location?", &location); err != nil {
+		return nil, err
+	}
+	loc, err := loadLocation(fn, location)
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.ParseInLocation(format, x, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return Time(t), nil
+}
+
+// parse_duration(x) parses a duration such as "300ms" or "-1h30m".
+// A duration argument is returned unchanged.
+func parseDuration(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case Duration:
+		return x, nil
+	case starlark.String:
+		d, err := time.ParseDuration(string(x))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		return Duration(d), nil
+	}
+	return nil, fmt.Errorf("%s: for parameter 1: got %s, want string or duration", fn.Name(), x.Type())
+}
+
+// is_valid_timezone(name) reports whether name is a time zone known to the host.
+func isValidTimezone(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	_, err := time.LoadLocation(name)
+	return starlark.Bool(err == nil), nil
+}
+
+// A Duration is a Starlark value that represents the elapsed time
+// between two instants, with nanosecond precision.
+type Duration time.Duration
+
+var (
+	_ starlark.HasAttrs   = Duration(0)
+	_ starlark.HasBinary  = Duration(0)
+	_ starlark.Comparable = Duration(0)
+)
+
+func (d Duration) String() string       { return time.Duration(d).String() }
+func (d Duration) Type() string         { return "time.duration" }
+func (d Duration) Freeze()              {} // immutable
+func (d Duration) Truth() starlark.Bool { return d != 0 }
+func (d Duration) Hash() (uint32, error) {
+	return uint32(d) ^ uint32(int64(d)>>32), nil
+}
+
+func (d Duration) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "hours":
+		return starlark.Float(time.Duration(d).Hours()), nil
+	case "minutes":
+		return starlark.Float(time.Duration(d).Minutes()), nil
+	case "seconds":
+		return starlark.Float(time.Duration(d).Seconds()), nil
+	case "milliseconds":
+		return starlark.MakeInt64(int64(d) / int64(time.Millisecond)), nil
+	case "microseconds":
+		return starlark.MakeInt64(int64(d) / int64(time.Microsecond)), nil
+	case "nanoseconds":
+		return starlark.MakeInt64(int64(d)), nil
+	}
+	return nil, nil
+}
+
+func (d Duration) AttrNames() []string {
+	return []string{"hours", "microseconds", "milliseconds", "minutes", "nanoseconds", "seconds"}
+}
+
+func (x Duration) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	y := y_.(Duration)
+	return compare(op, int64(x)-int64(y)), nil
+}
+
+// compare returns the result of the comparison op applied to
+// two operands whose difference (or three-way comparison) is cmp.
+func compare(op syntax.Token, cmp int64) bool {
+	switch op {
+	case syntax.EQL:
+		return cmp == 0
+	case syntax.NEQ:
+		return cmp != 0
+	case syntax.LT:
+		return cmp < 0
+	case syntax.LE:
+		return cmp <= 0
+	case syntax.GT:
+		return cmp > 0
+	case syntax.GE:
+		return cmp >= 0
+	}
+	panic(op)
+}
+
+// Binary implements binary operators on durations:
+// d + d, d - d, d * int, int * d, d / d, d / int, and d // d.
+// Operations involving times are implemented by Time.Binary.
+func (d Duration) Binary(op syntax.Token, y starlark.Value, side starlark.Side) (starlark.Value, error) {
+	x := time.Duration(d)
+	switch op {
+	case syntax.PLUS, syntax.MINUS:
+		if y, ok := y.(Duration); ok {
+			if op == syntax.MINUS && side == starlark.Right {
+				return subDurations(time.Duration(y), x)
+			} else if op == syntax.MINUS {
+				return subDurations(x, time.Duration(y))
+			}
+			return addDurations(x, time.Duration(y))
+		}
+
+	case syntax.STAR:
+		if y, ok := y.(starlark.Int); ok {
+			n, ok := y.Int64()
+			if !ok {
+				return nil, fmt.Errorf("duration multiplier %s out of range", y)
+			}
+			return mulDuration(x, n)
+		}
+
+	case syntax.SLASH:
+		if side == starlark.Right {
+			break // number / duration is meaningless
+		}
+		switch y := y.(type) {
+		case Duration:
+			if y == 0 {
+				return nil, fmt.Errorf("division by zero duration")
+			}
+			return starlark.Float(float64(x) / float64(y)), nil
+		case starlark.Int:
+			n, ok := y.Int64()
+			if !ok {
+				return nil, fmt.Errorf("duration divisor %s out of range", y)
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if n == -1 {
+				return mulDuration(x, n) // x / -1 overflows for the minimum duration
+			}
+			return Duration(x / time.Duration(n)), nil
+		}
+
+	case syntax.SLASHSLASH:
+		if y, ok := y.(Duration); ok {
+			num, den := x, time.Duration(y)
+			if side == starlark.Right {
+				num, den = den, num
+			}
+			if den == 0 {
+				return nil, fmt.Errorf("division by zero duration")
+			}
+			if num == math.MinInt64 && den == -1 {
+				return nil, errDurationOverflow
+			}
+			return starlark.MakeInt64(int64(num / den)), nil
+		}
+	}
+	return nil, nil // unhandled
+}
+
+// errDurationOverflow is the error for arithmetic whose result
+// is not representable as a duration.
+var errDurationOverflow = fmt.Errorf("duration out of range")
+
+// addDurations returns x + y, or an error if it overflows.
+func addDurations(x, y time.Duration) (starlark.Value, error) {
+	z := x + y
+	if (z > x) != (y > 0) {
+		return nil, errDurationOverflow
+	}
+	return Duration(z), nil
+}
+
+// subDurations returns x - y, or an error if it overflows.
+func subDurations(x, y time.Duration) (starlark.Value, error) {
+	z := x - y
+	if (z < x) != (y > 0) {
+		return nil, errDurationOverflow
+	}
+	return Duration(z), nil
+}
+
+// mulDuration returns x * n, or an error if it overflows.
+func mulDuration(x time.Duration, n int64) (starlark.Value, error) {
+	z := x * time.Duration(n)
+	if x != 0 && (int64(z/x) != n || x == -1 && n == math.MinInt64) {
+		return nil, errDurationOverflow
+	}
+	return Duration(z), nil
+}
+
+// A Time is a Starlark value that represents an instant in time,
+// with nanosecond precision, as observed in a particular time zone.
+// Times that denote the same instant are equal even if their time
+// zones differ.
+type Time time.Time
+
+var (
+	_ starlark.HasAttrs   = Time{}
+	_ starlark.HasBinary  = Time{}
+	_ starlark.Comparable = Time{}
+)
+
+func (t Time) String() string       { return time.Time(t).String() }
+func (t Time) Type() string         { return "time.time" }
+func (t Time) Freeze()              {} // immutable
+func (t Time) Truth() starlark.Bool { return starlark.Bool(!time.Time(t).IsZero()) }
+func (t Time) Hash() (uint32, error) {
+	// Consistent with equality, which ignores the time zone.
+	sec, nsec := time.Time(t).Unix(), time.Time(t).Nanosecond()
+	return uint32(sec) ^ uint32(sec>>32) ^ uint32(nsec)*9839, nil
+}
+
+func (t Time) Attr(name string) (starlark.Value, error) {
+	tt := time.Time(t)
+	switch name {
+	case "year":
+		return starlark.MakeInt(tt.Year()), nil
+	case "month":
+		return starlark.MakeInt(int(tt.Month())), nil
+	case "day":
+		return starlark.MakeInt(tt.Day()), nil
+	case "hour":
+		return starlark.MakeInt(tt.Hour()), nil
+	case "minute":
+		return starlark.MakeInt(tt.Minute()), nil
+	case "second":
+		return starlark.MakeInt(tt.Second()), nil
+	case "nanosecond":
+		return starlark.MakeInt(tt.Nanosecond()), nil
+	case "weekday":
+		return starlark.MakeInt(int(tt.Weekday())), nil
+	case "yearday":
+		return starlark.MakeInt(tt.YearDay()), nil
+	case "unix":
+		return starlark.MakeInt64(tt.Unix()), nil
+	case "unix_nano":
+		return starlark.MakeInt64(tt.UnixNano()), nil
+	case "location":
+		return starlark.String(tt.Location().String()), nil
+	}
+	if fn, ok := timeMethods[name]; ok {
+		return starlark.NewBuiltin(name, fn).BindReceiver(t), nil
+	}
+	return nil, nil
+}
+
+func (t Time) AttrNames() []string {
+	names := []string{
+		"day", "hour", "location", "minute", "month", "nanosecond",
+		"second", "unix", "unix_nano", "weekday", "year", "yearday",
+	}
+	for name := range timeMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var timeMethods = map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+	"format":      time_format,
+	"in_location": time_in_location,
+	"truncate":    time_truncate,
+}
+
+// format(layout=RFC3339) formats the time using a layout of Go's time package.
+func time_format(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	layout := time.RFC3339
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0, &layout); err != nil {
+		return nil, err
+	}
+	t := time.Time(fn.Receiver().(Time))
+	return starlark.String(t.Format(layout)), nil
+}
+
+// in_location(name) returns the same instant as observed in the named time zone.
+func time_in_location(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	loc, err := loadLocation(fn, name)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Time(fn.Receiver().(Time))
+	return Time(t.In(loc)), nil
+}
+
+// truncate(d) rounds the time down to a multiple of d since the zero time.
+func time_truncate(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var d Duration
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &d); err != nil {
+		return nil, err
+	}
+	t := time.Time(fn.Receiver().(Time))
+	return Time(t.Truncate(time.Duration(d))), nil
+}
+
+func (x Time) CompareSameType(op syntax.Token, y_ starlark.Value, depth int) (bool, error) {
+	tx, ty := time.Time(x), time.Time(y_.(Time))
+	var cmp int64
+	if tx.Before(ty) {
+		cmp = -1
+	} else if tx.After(ty) {
+		cmp = +1
+	}
+	return compare(op, cmp), nil
+}
+
+// Binary implements binary operators on times:
+// t + d, d + t, t - d, and t - t.
+func (t Time) Binary(op syntax.Token, y starlark.Value, side starlark.Side) (starlark.Value, error) {
+	x := time.Time(t)
+	switch op {
+	case syntax.PLUS:
+		if y, ok := y.(Duration); ok {
+			return Time(x.Add(time.Duration(y))), nil
+		}
+	case syntax.MINUS:
+		switch y := y.(type) {
+		case Duration:
+			if side == starlark.Left {
+				return Time(x.Add(-time.Duration(y))), nil
+			}
+		case Time:
+			if side == starlark.Left {
+				return Duration(x.Sub(time.Time(y))), nil
+			}
+			return Duration(time.Time(y).Sub(x)), nil
+		}
+	}
+	return nil, nil // unhandled
+}
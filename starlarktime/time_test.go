@@ -0,0 +1,83 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package starlarktime_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarktest"
+	"go.starlark.net/starlarktime"
+)
+
+func init() {
+	// The tests make extensive use of these not-yet-standard features.
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+	resolve.AllowFloat = true
+}
+
+func Test(t *testing.T) {
+	filename := starlarktest.DataFile("starlarktime", "testdata/time.star")
+	thread := &starlark.Thread{Load: load}
+	starlarktest.SetReporter(thread, t)
+	starlarktime.SetNow(thread, func() time.Time {
+		return time.Date(2018, time.June, 15, 12, 30, 0, 0, time.UTC)
+	})
+	if _, err := starlark.ExecFile(thread, filename, nil, nil); err != nil {
+		if err, ok := err.(*starlark.EvalError); ok {
+			t.Fatal(err.Backtrace())
+		}
+		t.Fatal(err)
+	}
+}
+
+// load implements the 'load' operation as used in the evaluator tests.
+func load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	switch module {
+	case "assert.star":
+		return starlarktest.LoadAssertModule()
+	case "time.star":
+		return starlark.StringDict{"time": starlarktime.Module}, nil
+	}
+	return nil, nil
+}
+
+// TestNowFunc tests that now() defaults to NowFunc.
+func TestNowFunc(t *testing.T) {
+	fixed := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	defer func(prev func() time.Time) { starlarktime.NowFunc = prev }(starlarktime.NowFunc)
+	starlarktime.NowFunc = func() time.Time { return fixed }
+
+	thread := new(starlark.Thread)
+	predeclared := starlark.StringDict{"time": starlarktime.Module}
+	globals, err := starlark.ExecFile(thread, "now.star", "t = time.now()", predeclared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := globals["t"].(starlarktime.Time); !ok || !time.Time(got).Equal(fixed) {
+		t.Errorf("now() = %v, want %v", globals["t"], fixed)
+	}
+}
+
+// TestNowMonotonic tests that now() discards the monotonic clock
+// reading, which is not part of the time value.
+func TestNowMonotonic(t *testing.T) {
+	thread := new(starlark.Thread)
+	predeclared := starlark.StringDict{"time": starlarktime.Module}
+	globals, err := starlark.ExecFile(thread, "now.star", "t = time.now()\ns = str(t)", predeclared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := globals["s"].(starlark.String); strings.Contains(string(s), "m=") {
+		t.Errorf("str(now()) = %s, contains monotonic clock reading", s)
+	}
+	if got := time.Time(globals["t"].(starlarktime.Time)); got != got.Round(0) {
+		t.Errorf("now() = %v, has monotonic clock reading", got)
+	}
+}
@@ -0,0 +1,513 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package starlarkyaml defines the Starlark 'yaml' module for decoding
+// and encoding YAML documents, an optional language extension.
+//
+// The module is a struct with the following functions:
+//
+// 	decode(x)                                  # decodes the sole document of a YAML stream
+// 	decode_all(x)                              # decodes all documents of a YAML stream, as a list
+// 	encode(x, sort_keys=False, indent=2)       # encodes a value as a YAML document
+// 	encode_all(xs, sort_keys=False, indent=2)  # encodes a sequence of values as a YAML stream
+//
+// Decoding maps YAML mappings to dicts, sequences to lists, and
+// scalars to None, bool, int, float, string, or bytes (for !!binary).
+// Mappings preserve the order of their keys, and merge keys (<<) are
+// expanded. Errors in the input are reported with the line and column
+// at which they occur.
+//
+// Encoding is the inverse, and is deterministic: dict entries appear
+// in insertion order, or in ascending key order if sort_keys is true.
+// Struct fields appear in ascending order. Tuples, sets, and other
+// iterables are encoded as sequences.
+package starlarkyaml // import "go.starlark.net/starlarkyaml"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Module is the Starlark 'yaml' module.
+//
+// An application can make it available to load statements like so:
+//
+// 	thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+// 		if module == "yaml.star" {
+// 			return starlark.StringDict{"yaml": starlarkyaml.Module}, nil
+// 		}
+// 		...
+// 	}
+//
+var Module = starlarkstruct.FromStringDict(starlark.String("yaml"), starlark.StringDict{
+	"decode":     starlark.NewBuiltin("yaml.decode", decode),
+	"decode_all": starlark.NewBuiltin("yaml.decode_all", decodeAll),
+	"encode":     starlark.NewBuiltin("yaml.encode", encode),
+	"encode_all": starlark.NewBuiltin("yaml.encode_all", encodeAll),
+})
+
+// ---- decoding ----
+
+// decode(x) decodes the sole document of the YAML stream x,
+// a string or bytes. An empty stream decodes to None.
+func decode(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	docs, err := decodeStream(fn, x)
+	if err != nil {
+		return nil, err
+	}
+	switch len(docs) {
+	case 0:
+		return starlark.None, nil
+	case 1:
+		return docs[0], nil
+	}
+	return nil, fmt.Errorf("%s: stream contains %d documents (use decode_all)", fn.Name(), len(docs))
+}
+
+// decode_all(x) decodes all the documents of the YAML stream x,
+// a string or bytes, and returns them as a list.
+func decodeAll(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	docs, err := decodeStream(fn, x)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.NewList(docs), nil
+}
+
+// decodeStream decodes the documents of the stream x.
+func decodeStream(fn *starlark.Builtin, x starlark.Value) ([]starlark.Value, error) {
+	var data []byte
+	switch x := x.(type) {
+	case starlark.String:
+		data = []byte(x)
+	case starlark.Bytes:
+		data = []byte(x)
+	default:
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want string or bytes", fn.Name(), x.Type())
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	d := decoder{expanding: make(map[*yaml.Node]bool)}
+	var docs []starlark.Value
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		doc, err := d.fromNode(&node)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// A nodeError is an error in the decoding of a YAML node.
+type nodeError struct {
+	line, col int
+	msg       string
+}
+
+func (e *nodeError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.line, e.col, e.msg)
+}
+
+func errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return &nodeError{node.Line, node.Column, fmt.Sprintf(format, args...)}
+}
+
+// maxAliasValues is the maximum number of values that may be created
+// by the expansion of aliases in a stream. It defends against streams,
+// such as the "billion laughs", in which nested aliases multiply the
+// size of the result.
+const maxAliasValues = 1 << 20
+
+// A decoder converts YAML nodes to Starlark values.
+type decoder struct {
+	expanding map[*yaml.Node]bool // anchored nodes whose aliases are being expanded
+	aliased   int                 // number of values created by expansion of aliases
+}
+
+// expand returns the node denoted by the alias node, and marks it as
+// being expanded until the returned function is called. It fails if
+// the node is already being expanded, as the alias refers to itself.
+func (d *decoder) expand(alias *yaml.Node) (*yaml.Node, func(), error) {
+	node := alias.Alias
+	if d.expanding[node] {
+		return nil, nil, errorf(alias, "alias *%s refers to itself", alias.Value)
+	}
+	d.expanding[node] = true
+	return node, func() { delete(d.expanding, node) }, nil
+}
+
+// fromNode returns the Starlark value for a YAML node.
+func (d *decoder) fromNode(node *yaml.Node) (starlark.Value, error) {
+	if len(d.expanding) > 0 {
+		if d.aliased++; d.aliased > maxAliasValues {
+			return nil, errorf(node, "expansion of aliases exceeds %d values", maxAliasValues)
+		}
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return starlark.None, nil
+		}
+		return d.fromNode(node.Content[0])
+
+	case yaml.AliasNode:
+		target, done, err := d.expand(node)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		return d.fromNode(target)
+
+	case yaml.SequenceNode:
+		elems := make([]starlark.Value, len(node.Content))
+		for i, n := range node.Content {
+			elem, err := d.fromNode(n)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return starlark.NewList(elems), nil
+
+	case yaml.MappingNode:
+		dict := new(starlark.Dict)
+		if err := d.addMapping(dict, node, false); err != nil {
+			return nil, err
+		}
+		return dict, nil
+
+	case yaml.ScalarNode:
+		return fromScalar(node)
+	}
+	return nil, errorf(node, "unexpected YAML node kind %d", node.Kind)
+}
+
+// addMapping adds the entries of the mapping node to dict.
+// Unless merging, it is an error for a key to appear twice.
+func (d *decoder) addMapping(dict *starlark.Dict, node *yaml.Node, merging bool) error {
+	// Explicit keys take precedence over merged ones,
+	// so process merge keys after all others.
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+			merges = append(merges, v)
+			continue
+		}
+		key, err := d.fromNode(k)
+		if err != nil {
+			return err
+		}
+		if _, err := key.Hash(); err != nil {
+			return errorf(k, "invalid mapping key: %v", err)
+		}
+		if _, found, _ := dict.Get(key); found {
+			if merging {
+				continue
+			}
+			return errorf(k, "duplicate mapping key %s", key)
+		}
+		value, err := d.fromNode(v)
+		if err != nil {
+			return err
+		}
+		dict.SetKey(key, value)
+	}
+	for _, v := range merges {
+		if err := d.merge(dict, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge adds to dict the entries of the value of a merge key, which
+// must be a mapping or a sequence of mappings, or an alias of one.
+func (d *decoder) merge(dict *starlark.Dict, v *yaml.Node) error {
+	if v.Kind == yaml.AliasNode {
+		target, done, err := d.expand(v)
+		if err != nil {
+			return err
+		}
+		defer done()
+		v = target
+	}
+	switch v.Kind {
+	case yaml.MappingNode:
+		return d.addMapping(dict, v, true)
+	case yaml.SequenceNode:
+		for _, m := range v.Content {
+			if err := d.mergeMapping(dict, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errorf(v, "merge key requires a mapping or sequence of mappings")
+}
+
+// mergeMapping adds to dict the entries of an element of the sequence
+// value of a merge key, which must be a mapping or an alias of one.
+func (d *decoder) mergeMapping(dict *starlark.Dict, m *yaml.Node) error {
+	if m.Kind == yaml.AliasNode {
+		target, done, err := d.expand(m)
+		if err != nil {
+			return err
+		}
+		defer done()
+		m = target
+	}
+	if m.Kind != yaml.MappingNode {
+		return errorf(m, "merge key requires a mapping or sequence of mappings")
+	}
+	return d.addMapping(dict, m, true)
+}
+
+// fromScalar returns the Starlark value for a YAML scalar node,
+// according to its resolved tag.
+func fromScalar(node *yaml.Node) (starlark.Value, error) {
+	switch tag := node.ShortTag(); tag {
+	case "!!null":
+		return starlark.None, nil
+	case "!!bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return nil, errorf(node, "invalid bool %q", node.Value)
+		}
+		return starlark.Bool(b), nil
+	case "!!int":
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return nil, errorf(node, "invalid int %q", node.Value)
+		}
+		switch v := v.(type) {
+		case int:
+			return starlark.MakeInt(v), nil
+		case int64:
+			return starlark.MakeInt64(v), nil
+		case uint64:
+			return starlark.MakeUint64(v), nil
+		}
+		return nil, errorf(node, "int %s out of range", node.Value)
+	case "!!float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return nil, errorf(node, "invalid float %q", node.Value)
+		}
+		return starlark.Float(f), nil
+	case "!!str", "!!timestamp":
+		return starlark.String(node.Value), nil
+	case "!!binary":
+		data, err := base64.StdEncoding.DecodeString(node.Value)
+		if err != nil {
+			return nil, errorf(node, "invalid !!binary value: %v", err)
+		}
+		return starlark.Bytes(data), nil
+	default:
+		return nil, errorf(node, "unsupported tag %s", tag)
+	}
+}
+
+// ---- encoding ----
+
+// encode(x, sort_keys=False, indent=2) returns the YAML encoding of x.
+func encode(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	var e encoder
+	indent := 2
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "x", &x, "sort_keys?", &e.sortKeys, "indent?", &indent); err != nil {
+		return nil, err
+	}
+	return e.encodeStream(fn, []starlark.Value{x}, indent)
+}
+
+// encode_all(xs, sort_keys=False, indent=2) returns the YAML encoding
+// of the stream whose documents are the elements of xs.
+func encodeAll(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var iterable starlark.Iterable
+	var e encoder
+	indent := 2
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "xs", &iterable, "sort_keys?", &e.sortKeys, "indent?", &indent); err != nil {
+		return nil, err
+	}
+	var docs []starlark.Value
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		docs = append(docs, x)
+	}
+	return e.encodeStream(fn, docs, indent)
+}
+
+// An encoder holds the state of a single call to encode.
+type encoder struct {
+	sortKeys bool
+	path     map[starlark.Value]bool // lists and dicts being encoded, to detect cycles
+}
+
+func (e *encoder) encodeStream(fn *starlark.Builtin, docs []starlark.Value, indent int) (starlark.Value, error) {
+	if indent < 1 {
+		return nil, fmt.Errorf("%s: invalid indent %d", fn.Name(), indent)
+	}
+	if len(docs) == 0 {
+		return starlark.String(""), nil
+	}
+	e.path = make(map[starlark.Value]bool)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	for _, doc := range docs {
+		node, err := e.toNode(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		if err := enc.Encode(node); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.String(buf.String()), nil
+}
+
+func scalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// toNode returns the YAML node for a Starlark value.
+func (e *encoder) toNode(x starlark.Value) (*yaml.Node, error) {
+	switch x := x.(type) {
+	case starlark.NoneType:
+		return scalar("!!null", "null"), nil
+	case starlark.Bool:
+		if x {
+			return scalar("!!bool", "true"), nil
+		}
+		return scalar("!!bool", "false"), nil
+	case starlark.Int:
+		return scalar("!!int", x.String()), nil
+	case starlark.Float:
+		f := float64(x)
+		switch {
+		case math.IsNaN(f):
+			return scalar("!!float", ".nan"), nil
+		case math.IsInf(f, +1):
+			return scalar("!!float", ".inf"), nil
+		case math.IsInf(f, -1):
+			return scalar("!!float", "-.inf"), nil
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			s += ".0" // preserve the float tag when decoded
+		}
+		return scalar("!!float", s), nil
+	case starlark.String:
+		return scalar("!!str", string(x)), nil
+	case starlark.Bytes:
+		return scalar("!!binary", base64.StdEncoding.EncodeToString([]byte(x))), nil
+
+	case *starlark.Dict:
+		if e.path[x] {
+			return nil, fmt.Errorf("cycle in dict")
+		}
+		e.path[x] = true
+		defer delete(e.path, x)
+		items := x.Items()
+		if e.sortKeys {
+			var err error
+			sort.SliceStable(items, func(i, j int) bool {
+				less, cmpErr := starlark.Compare(syntax.LT, items[i][0], items[j][0])
+				if cmpErr != nil && err == nil {
+					err = fmt.Errorf("cannot sort keys: %v", cmpErr)
+				}
+				return less
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return e.mappingNode(items)
+
+	case *starlarkstruct.Struct:
+		var items []starlark.Tuple
+		for _, name := range x.AttrNames() { // sorted
+			v, _ := x.Attr(name)
+			items = append(items, starlark.Tuple{starlark.String(name), v})
+		}
+		return e.mappingNode(items)
+
+	case *starlark.List:
+		if e.path[x] {
+			return nil, fmt.Errorf("cycle in list")
+		}
+		e.path[x] = true
+		defer delete(e.path, x)
+		return e.sequenceNode(x)
+
+	case starlark.Iterable: // tuple, set, etc
+		return e.sequenceNode(x)
+	}
+	return nil, fmt.Errorf("cannot encode %s as YAML", x.Type())
+}
+
+func (e *encoder) mappingNode(items []starlark.Tuple) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, item := range items {
+		k, err := e.toNode(item[0])
+		if err != nil {
+			return nil, err
+		}
+		if k.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("cannot encode %s as YAML mapping key", item[0].Type())
+		}
+		v, err := e.toNode(item[1])
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, k, v)
+	}
+	return node, nil
+}
+
+func (e *encoder) sequenceNode(iterable starlark.Iterable) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		elem, err := e.toNode(x)
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, elem)
+	}
+	return node, nil
+}
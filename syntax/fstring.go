@@ -0,0 +1,169 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+// This file defines the parsing of f-string literals.
+//
+// The scanner treats an f-string as a single FSTRING token. The parser
+// splits its text into literal portions, which it unquotes, and
+// replacement fields, whose expressions it parses using a secondary
+// scanner positioned at the start of each expression, so that the
+// positions of the resulting syntax nodes are relative to the file.
+
+import (
+	"bytes"
+	"strings"
+)
+
+// parseFString parses the f-string literal whose raw text,
+// including prefix and quotes, starts at pos.
+func (p *parser) parseFString(pos Position, raw string) *FStringExpr {
+	i := strings.IndexAny(raw, `"'`)
+	isRaw := strings.Contains(raw[:i], "r")
+	quote := raw[i : i+1]
+	if len(raw)-i >= 6 && strings.HasPrefix(raw[i:], strings.Repeat(quote, 3)) {
+		quote = raw[i : i+3]
+	}
+	body := raw[i+len(quote) : len(raw)-len(quote)]
+	bodyPos := pos.add(raw[:i+len(quote)])
+
+	e := &FStringExpr{TokenPos: pos, Raw: raw}
+	var lit bytes.Buffer // literal text, still quoted
+	flush := func() {
+		s, err := unescape(lit.String(), isRaw)
+		if err != nil {
+			p.in.error(pos, err.Error())
+		}
+		e.Literals = append(e.Literals, s)
+		lit.Reset()
+	}
+	for j := 0; j < len(body); {
+		switch c := body[j]; {
+		case c == '\\' && !isRaw && j+1 < len(body):
+			// Escape sequences are copied verbatim, for unescape.
+			lit.WriteString(body[j : j+2])
+			j += 2
+		case c == '{' && j+1 < len(body) && body[j+1] == '{',
+			c == '}' && j+1 < len(body) && body[j+1] == '}':
+			lit.WriteByte(c)
+			j += 2
+		case c == '}':
+			p.in.error(bodyPos.add(body[:j]), "f-string: single '}' is not allowed")
+		case c == '{':
+			flush()
+			field, n := p.parseFStringField(bodyPos.add(body[:j]), body[j:])
+			e.Fields = append(e.Fields, field)
+			j += n
+		default:
+			lit.WriteByte(c)
+			j++
+		}
+	}
+	flush()
+	return e
+}
+
+// parseFStringField parses the replacement field {x!conv:spec} at the
+// start of s, whose opening brace is at lbrace. It returns the field
+// and its length in bytes.
+func (p *parser) parseFStringField(lbrace Position, s string) (*FStringField, int) {
+	// Find the end of the expression, skipping over
+	// brackets and string literals within it.
+	depth := 0
+	var quote byte // quote character of enclosing string literal, or 0
+	j := 1
+loop:
+	for ; j < len(s); j++ {
+		c := s[j]
+		if quote != 0 {
+			if c == '\\' {
+				j++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 && c == '}' {
+				break loop
+			}
+			depth--
+		case '#':
+			p.in.error(lbrace.add(s[:j]), "f-string: expression cannot include '#'")
+		case '!':
+			if depth == 0 && !strings.HasPrefix(s[j:], "!=") {
+				break loop
+			}
+		case ':':
+			if depth == 0 {
+				break loop
+			}
+		}
+	}
+	if j == len(s) {
+		p.in.error(lbrace, "f-string: expecting '}'")
+	}
+	text := s[1:j]
+	if strings.TrimSpace(text) == "" {
+		p.in.error(lbrace, "f-string: empty expression not allowed")
+	}
+	field := &FStringField{Lbrace: lbrace, X: p.parseFStringExpr(lbrace.add("{"), text)}
+
+	// conversion
+	if s[j] == '!' {
+		k := j + 1
+		for k < len(s) && s[k] != ':' && s[k] != '}' {
+			k++
+		}
+		field.Conv = s[j+1 : k]
+		if field.Conv != "s" && field.Conv != "r" {
+			p.in.errorf(lbrace.add(s[:j]), "f-string: invalid conversion %q", field.Conv)
+		}
+		j = k
+	}
+
+	// format specification
+	if j < len(s) && s[j] == ':' {
+		k := j + 1
+		for k < len(s) && s[k] != '}' {
+			if s[k] == '{' {
+				p.in.error(lbrace.add(s[:k]), "f-string: nested replacement fields are not supported")
+			}
+			k++
+		}
+		field.Spec = s[j+1 : k]
+		j = k
+	}
+
+	if j == len(s) {
+		p.in.error(lbrace, "f-string: expecting '}'")
+	}
+	field.Rbrace = lbrace.add(s[:j])
+	return field, j + 1
+}
+
+// parseFStringExpr parses the expression text of a replacement field,
+// which starts at pos.
+func (p *parser) parseFStringExpr(pos Position, text string) Expr {
+	in := &scanner{
+		complete:  []byte(text),
+		rest:      []byte(text),
+		pos:       pos,
+		depth:     1, // as if within parentheses, so newlines are ignored
+		indentstk: make([]int, 1, 10),
+	}
+	sub := parser{in: in}
+	sub.nextToken() // read first lookahead token
+	x := sub.parseExpr(false)
+	if sub.tok != EOF {
+		in.errorf(sub.tokval.pos, "got %#v in f-string expression, want '}'", sub.tok)
+	}
+	return x
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+// FileOptions specifies the dialect of Starlark accepted in a single
+// file: the optional language features that its parser, resolver, and
+// compiler permit. These features are either not standard Starlark
+// (yet), or deprecated features of the BUILD language.
+//
+// The zero value of FileOptions is the standard dialect.
+// Because each file records its own options, files of different
+// dialects may be processed concurrently within one program.
+//
+// A file may enable features for itself using a pragma, a comment
+// among those that precede its first statement, of the form:
+//
+//	# starlark: lambda, float
+//
+// Pragmas are honoured by the resolver only if Permitted is non-nil,
+// and then only for features enabled in Permitted; otherwise they are
+// ignored. See Features for the list of feature names.
+type FileOptions struct {
+	NestedDef      bool // allow def statements within function bodies
+	Lambda         bool // allow lambda expressions
+	Float          bool // allow floating point literals, the 'float' built-in, and x / y
+	Set            bool // allow the 'set' built-in
+	GlobalReassign bool // allow reassignment to globals declared in same file (deprecated)
+	Bitwise        bool // allow bitwise operations (&, |, ^, ~, <<, and >>)
+	FString        bool // allow f-string literals
+	Types          bool // allow type annotations on def parameters and results
+
+	Permitted *FileOptions // features a file may enable by pragma; nil means pragmas are ignored
+}
+
+// LegacyFileOptions returns a new FileOptions for use by the
+// functions, such as Parse, that predate FileOptions.
+// Its result reflects the deprecated global variables of the
+// resolve package (resolve.AllowLambda, and so on), which install
+// this function.
+var LegacyFileOptions = func() *FileOptions { return new(FileOptions) }
+
+// Features lists the names of the optional features of FileOptions,
+// as they appear in a pragma.
+var Features = []string{
+	"nesteddef",
+	"lambda",
+	"float",
+	"set",
+	"global_reassign",
+	"bitwise",
+	"fstring",
+	"types",
+}
+
+// Feature returns the address of the field of opts that enables the
+// named feature, or nil if there is no such feature.
+func (opts *FileOptions) Feature(name string) *bool {
+	switch name {
+	case "nesteddef":
+		return &opts.NestedDef
+	case "lambda":
+		return &opts.Lambda
+	case "float":
+		return &opts.Float
+	case "set":
+		return &opts.Set
+	case "global_reassign":
+		return &opts.GlobalReassign
+	case "bitwise":
+		return &opts.Bitwise
+	case "fstring":
+		return &opts.FString
+	case "types":
+		return &opts.Types
+	}
+	return nil
+}
+
+// AllFeatures returns a new FileOptions that enables every optional
+// feature. Use it as the Permitted field of a FileOptions to allow
+// files to enable any feature by pragma.
+func AllFeatures() *FileOptions {
+	opts := new(FileOptions)
+	for _, name := range Features {
+		*opts.Feature(name) = true
+	}
+	return opts
+}
+
+// A Pragma is a request, in a comment at the start of a file,
+// that the named dialect feature be enabled for that file.
+type Pragma struct {
+	Pos  Position
+	Name string
+}
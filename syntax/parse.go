@@ -11,7 +11,10 @@ package syntax
 // package.  Verify that error positions are correct using the
 // chunkedfile mechanism.
 
-import log "log"
+import (
+	"fmt"
+	"log"
+)
 
 // Enable this flag to print the token stream and log.Fatal on the first error.
 const debug = false
@@ -21,6 +24,8 @@ type Mode uint
 
 const (
 	RetainComments Mode = 1 << iota // retain comments in AST; see Node.Comments
+	RecoverErrors                   // report all syntax errors, not just the first; see Parse
+	RetainTokens                    // retain every token and its trivia; see File.Tokens
 )
 
 // Parse parses the input data and returns the corresponding parse tree.
@@ -30,20 +35,47 @@ const (
 // The type of the argument for the src parameter must be string,
 // []byte, or io.Reader.
 // If src == nil, ParseFile parses the file specified by filename.
+//
+// By default, parsing stops at the first syntax error, which is
+// returned as an Error. In RecoverErrors mode, the parser instead
+// resynchronizes at the next statement after each error, and returns
+// a partial syntax tree, in which BadStmt and BadExpr nodes stand for
+// the erroneous parts, along with an ErrorList of all syntax errors.
+//
+// The resulting file has the options returned by LegacyFileOptions.
+// New code should use FileOptions.Parse.
 func Parse(filename string, src interface{}, mode Mode) (f *File, err error) {
+	return LegacyFileOptions().Parse(filename, src, mode)
+}
+
+// Parse parses a file of the dialect specified by opts,
+// and records opts in the resulting File, along with any
+// pragmas in the comments preceding its first statement.
+// See the Parse function for explanation of parameters.
+func (opts *FileOptions) Parse(filename string, src interface{}, mode Mode) (f *File, err error) {
 	in, err := newScanner(filename, src, mode&RetainComments != 0)
 	if err != nil {
 		return nil, err
 	}
-	p := parser{in: in}
+	p := parser{in: in, recovering: mode&RecoverErrors != 0}
+	p.in.keepTokens = mode&RetainTokens != 0
+	defer p.mergeErrors(&err)
 	defer p.in.recover(&err)
 
-	p.nextToken() // read first lookahead token
+	p.in.header = true
+	p.nextToken() // read first lookahead token, skipping header comments
+	p.in.header = false
 	f = p.parseFile()
 	if f != nil {
 		f.Path = filename
+		f.Options = opts
+		f.Pragmas = p.in.pragmas
+		f.Tokens = p.in.tokens
 	}
 	p.assignComments(f)
+	if p.errors != nil {
+		return f, p.errors
+	}
 	return f, nil
 }
 
@@ -54,7 +86,8 @@ func ParseExpr(filename string, src interface{}, mode Mode) (expr Expr, err erro
 	if err != nil {
 		return nil, err
 	}
-	p := parser{in: in}
+	p := parser{in: in, recovering: mode&RecoverErrors != 0}
+	defer p.mergeErrors(&err)
 	defer p.in.recover(&err)
 
 	p.nextToken() // read first lookahead token
@@ -70,6 +103,9 @@ func ParseExpr(filename string, src interface{}, mode Mode) (expr Expr, err erro
 		p.in.errorf(p.in.pos, "got %#v after expression, want EOF", p.tok)
 	}
 	p.assignComments(expr)
+	if p.errors != nil {
+		return expr, p.errors
+	}
 	return expr, nil
 }
 
@@ -77,13 +113,61 @@ type parser struct {
 	in     *scanner
 	tok    Token
 	tokval tokenValue
+
+	recovering bool      // RecoverErrors mode
+	errors     ErrorList // errors so far (if recovering)
+	ntokens    int       // number of tokens read, to ensure progress after errors
+}
+
+// mergeErrors, in RecoverErrors mode, adds the error that stopped
+// the parser, if any, to the earlier ones.
+func (p *parser) mergeErrors(err *error) {
+	if e, ok := (*err).(Error); ok && p.recovering {
+		p.error(e)
+		*err = p.errors
+	}
+}
+
+// error records a syntax error in RecoverErrors mode.
+// To avoid cascades, only the first error on each line is recorded.
+func (p *parser) error(err Error) {
+	if n := len(p.errors); n > 0 && p.errors[n-1].Pos.Line == err.Pos.Line {
+		return
+	}
+	p.errors = append(p.errors, err)
+}
+
+// caught records the syntax error, if any, recovered from a panic
+// by a deferred function, and reports whether there was one.
+// Other panics are propagated.
+func (p *parser) caught(e interface{}) bool {
+	switch e := e.(type) {
+	case nil:
+		return false
+	case Error:
+		p.error(e)
+		return true
+	default:
+		panic(e)
+	}
 }
 
 // nextToken advances the scanner and returns the position of the
 // previous token.
+//
+// In RecoverErrors mode, a scanner error is recorded and the
+// offending input is treated as an ILLEGAL token.
 func (p *parser) nextToken() Position {
 	oldpos := p.tokval.pos
-	p.tok = p.in.nextToken(&p.tokval)
+	p.ntokens++
+	if p.recovering {
+		p.tok = p.scanRecover()
+	} else {
+		p.tok = p.in.nextToken(&p.tokval)
+	}
+	if p.in.keepTokens && p.tok != ILLEGAL {
+		p.in.recordToken(p.tok, &p.tokval)
+	}
 	// enable to see the token stream
 	if debug {
 		log.Printf("nextToken: %-20s%+v\n", p.tok, p.tokval.pos)
@@ -91,6 +175,15 @@ func (p *parser) nextToken() Position {
 	return oldpos
 }
 
+func (p *parser) scanRecover() (tok Token) {
+	defer func() {
+		if p.caught(recover()) {
+			tok = ILLEGAL
+		}
+	}()
+	return p.in.nextToken(&p.tokval)
+}
+
 // file_input = (NEWLINE | stmt)* EOF
 func (p *parser) parseFile() *File {
 	var stmts []Stmt
@@ -99,11 +192,74 @@ func (p *parser) parseFile() *File {
 			p.nextToken()
 			continue
 		}
-		stmts = p.parseStmt(stmts)
+		if p.recovering && (p.tok == INDENT || p.tok == OUTDENT) {
+			// Unbalanced indentation at top level, either in the
+			// first statement or after an earlier error.
+			// Report it, and parse what follows as top-level statements.
+			p.error(Error{p.tokval.pos, fmt.Sprintf("unexpected %s", p.tok)})
+			p.nextToken()
+			continue
+		}
+		stmts = p.parseStmtRecover(stmts)
 	}
 	return &File{Stmts: stmts}
 }
 
+// parseStmtRecover is like parseStmt, but in RecoverErrors mode,
+// after a syntax error it skips to the next statement, and
+// replaces the erroneous one by a BadStmt.
+func (p *parser) parseStmtRecover(stmts []Stmt) (res []Stmt) {
+	if !p.recovering {
+		return p.parseStmt(stmts)
+	}
+	from, start := p.tokval.pos, p.ntokens
+	defer func() {
+		if p.caught(recover()) {
+			to := p.tokval.pos
+			p.resync()
+			if p.ntokens == start && p.tok != EOF {
+				p.nextToken() // ensure progress
+			}
+			res = append(stmts, &BadStmt{From: from, To: to})
+		}
+	}()
+	return p.parseStmt(stmts)
+}
+
+// resync skips tokens up to and including the NEWLINE at the end of
+// the current statement, and any indented block that follows it,
+// so that the parser is positioned at the start of the next
+// statement, or at the OUTDENT or EOF that ends the enclosing block.
+func (p *parser) resync() {
+	depth := 0 // nesting of indented blocks
+	for {
+		switch p.tok {
+		case EOF:
+			return
+		case NEWLINE:
+			if depth == 0 {
+				p.nextToken()
+				if p.tok != INDENT {
+					return
+				}
+				continue
+			}
+		case INDENT:
+			depth++
+		case OUTDENT:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 func (p *parser) parseStmt(stmts []Stmt) []Stmt {
 	if p.tok == DEF {
 		return append(stmts, p.parseDefStmt())
@@ -119,17 +275,26 @@ func (p *parser) parseDefStmt() Stmt {
 	defpos := p.nextToken() // consume DEF
 	id := p.parseIdent()
 	p.consume(LPAREN)
-	params := p.parseParams()
+	params, types := p.parseParams(true)
 	p.consume(RPAREN)
+	var arrow Position
+	var result Expr
+	if p.tok == ARROW {
+		arrow = p.nextToken()
+		result = p.parseTest()
+	}
 	p.consume(COLON)
 	body := p.parseSuite()
 	return &DefStmt{
 		Def:  defpos,
 		Name: id,
 		Function: Function{
-			StartPos: defpos,
-			Params:   params,
-			Body:     body,
+			StartPos:   defpos,
+			Params:     params,
+			Body:       body,
+			ParamTypes: types,
+			Arrow:      arrow,
+			ResultType: result,
 		},
 	}
 }
@@ -335,7 +500,7 @@ func (p *parser) parseSuite() []Stmt {
 		p.consume(INDENT)
 		var stmts []Stmt
 		for p.tok != OUTDENT && p.tok != EOF {
-			stmts = p.parseStmt(stmts)
+			stmts = p.parseStmtRecover(stmts)
 		}
 		p.consume(OUTDENT)
 		return stmts
@@ -366,10 +531,10 @@ func (p *parser) consume(t Token) Position {
 // params = (param COMMA)* param
 //        |
 //
-// param = IDENT
-//       | IDENT EQ test
-//       | STAR IDENT
-//       | STARSTAR IDENT
+// param = IDENT [COLON test]
+//       | IDENT [COLON test] EQ test
+//       | STAR IDENT [COLON test]
+//       | STARSTAR IDENT [COLON test]
 //
 // parseParams parses a parameter list.  The resulting expressions are of the form:
 //
@@ -377,8 +542,20 @@ func (p *parser) consume(t Token) Position {
 //      *Binary{Op: EQ, X: *Ident, Y: Expr}
 //      *Unary{Op: STAR, X: *Ident}
 //      *Unary{Op: STARSTAR, X: *Ident}
-func (p *parser) parseParams() []Expr {
-	var params []Expr
+//
+// If allowTypes, a parameter may have a type annotation;
+// the annotations are returned in types, which is parallel to params,
+// or nil if no parameter has one.
+func (p *parser) parseParams(allowTypes bool) (params, types []Expr) {
+	annotated := false
+	annotation := func() Expr {
+		if allowTypes && p.tok == COLON {
+			p.nextToken()
+			annotated = true
+			return p.parseTest()
+		}
+		return nil
+	}
 	stars := false
 	for p.tok != RPAREN && p.tok != COLON && p.tok != EOF {
 		if len(params) > 0 {
@@ -402,6 +579,7 @@ func (p *parser) parseParams() []Expr {
 				Op:    STAR,
 				X:     id,
 			})
+			types = append(types, annotation())
 			continue
 		}
 
@@ -415,12 +593,14 @@ func (p *parser) parseParams() []Expr {
 				Op:    STARSTAR,
 				X:     id,
 			})
+			types = append(types, annotation())
 			continue
 		}
 
 		// IDENT
 		// IDENT = test
 		id := p.parseIdent()
+		types = append(types, annotation())
 		if p.tok == EQ { // default value
 			eq := p.nextToken()
 			dflt := p.parseTest()
@@ -435,7 +615,10 @@ func (p *parser) parseParams() []Expr {
 
 		params = append(params, id)
 	}
-	return params
+	if !annotated {
+		types = nil
+	}
+	return params, types
 }
 
 // parseExpr parses an expression, possible consisting of a
@@ -509,7 +692,7 @@ func (p *parser) parseLambda(allowCond bool) Expr {
 	lambda := p.nextToken()
 	var params []Expr
 	if p.tok != COLON {
-		params = p.parseParams()
+		params, _ = p.parseParams(false)
 	}
 	p.consume(COLON)
 
@@ -755,7 +938,7 @@ func (p *parser) parseArgs() []Expr {
 
 //  primary = IDENT
 //          | INT | FLOAT
-//          | STRING
+//          | STRING | BYTES | FSTRING
 //          | '[' ...                    // list literal or comprehension
 //          | '{' ...                    // dict literal or comprehension
 //          | '(' ...                    // tuple or parenthesized expression
@@ -765,7 +948,7 @@ func (p *parser) parsePrimary() Expr {
 	case IDENT:
 		return p.parseIdent()
 
-	case INT, FLOAT, STRING:
+	case INT, FLOAT, STRING, BYTES:
 		var val interface{}
 		tok := p.tok
 		switch tok {
@@ -777,13 +960,18 @@ func (p *parser) parsePrimary() Expr {
 			}
 		case FLOAT:
 			val = p.tokval.float
-		case STRING:
+		case STRING, BYTES:
 			val = p.tokval.string
 		}
 		raw := p.tokval.raw
 		pos := p.nextToken()
 		return &Literal{Token: tok, TokenPos: pos, Raw: raw, Value: val}
 
+	case FSTRING:
+		raw := p.tokval.raw
+		pos := p.nextToken()
+		return p.parseFString(pos, raw)
+
 	case LBRACK:
 		return p.parseList()
 
@@ -815,8 +1003,12 @@ func (p *parser) parsePrimary() Expr {
 			X:     x,
 		}
 	}
-	p.in.errorf(p.in.pos, "got %#v, want primary expression", p.tok)
-	panic("unreachable")
+	err := Error{p.in.pos, fmt.Sprintf("got %#v, want primary expression", p.tok)}
+	if !p.recovering {
+		panic(err)
+	}
+	p.error(err)
+	return &BadExpr{From: p.tokval.pos, To: p.tokval.pos}
 }
 
 // list = '[' ']'
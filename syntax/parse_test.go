@@ -7,9 +7,13 @@ package syntax_test
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"go.starlark.net/internal/chunkedfile"
 	"go.starlark.net/starlarktest"
@@ -106,6 +110,14 @@ func TestExprParseTrees(t *testing.T) {
 			`(BinaryExpr X=a Op=and Y=(UnaryExpr Op=not X=b))`},
 		{`[e for x in y if cond1 if cond2]`,
 			`(Comprehension Body=e Clauses=((ForClause Vars=x X=y) (IfClause Cond=cond1) (IfClause Cond=cond2)))`}, // github.com/google/skylark/issues/53
+		{`f"a{x}b"`,
+			`(FStringExpr Literals=("a" "b") Fields=((FStringField X=x)))`},
+		{`f"{x!r:>5}{y.z(1)}"`,
+			`(FStringExpr Literals=("" "" "") Fields=((FStringField X=x Conv=r Spec=>5) (FStringField X=(CallExpr Fn=(DotExpr X=y Name=z) Args=(1)))))`},
+		{`f"{{}}{ {'k': [1, 2]}['k'] }\t"`,
+			`(FStringExpr Literals=("{}" "\t") Fields=((FStringField X=(IndexExpr X=(DictExpr List=((DictEntry Key="k" Value=(ListExpr List=(1 2))))) Y="k"))))`},
+		{`rf"\n{a != b, c}"`,
+			`(FStringExpr Literals=("\\n" "") Fields=((FStringField X=(TupleExpr List=((BinaryExpr X=a Op=!= Y=b) c)))))`},
 	} {
 		e, err := syntax.ParseExpr("foo.star", test.input, 0)
 		if err != nil {
@@ -168,6 +180,10 @@ else:
 			`(DefStmt Name=f Function=(Function Params=(a b (BinaryExpr X=c Op== Y=d)) Body=((BranchStmt Token=pass))))`},
 		{`def f(a, b=c, d): pass`,
 			`(DefStmt Name=f Function=(Function Params=(a (BinaryExpr X=b Op== Y=c) d) Body=((BranchStmt Token=pass))))`}, // TODO(adonovan): fix this
+		{`def f(x: int, y, z: list[str] = [], *args: int, **kwargs) -> str: pass`,
+			`(DefStmt Name=f Function=(Function Params=(x y (BinaryExpr X=z Op== Y=(ListExpr)) (UnaryExpr Op=* X=args) (UnaryExpr Op=** X=kwargs)) Body=((BranchStmt Token=pass)) ParamTypes=(int nil (IndexExpr X=list Y=str) int nil) ResultType=str))`},
+		{`def f(x) -> int | None: pass`,
+			`(DefStmt Name=f Function=(Function Params=(x) Body=((BranchStmt Token=pass)) ResultType=(BinaryExpr X=int Op=| Y=None)))`},
 		{`def f():
 	def g():
 		pass
@@ -283,6 +299,27 @@ func writeTree(out *bytes.Buffer, x reflect.Value) {
 		case syntax.Ident:
 			out.WriteString(v.Name)
 			return
+		case syntax.FStringExpr:
+			out.WriteString("(FStringExpr Literals=(")
+			for i, lit := range v.Literals {
+				if i > 0 {
+					out.WriteByte(' ')
+				}
+				fmt.Fprintf(out, "%q", lit)
+			}
+			out.WriteByte(')')
+			if len(v.Fields) > 0 {
+				out.WriteString(" Fields=(")
+				for i, field := range v.Fields {
+					if i > 0 {
+						out.WriteByte(' ')
+					}
+					writeTree(out, reflect.ValueOf(field))
+				}
+				out.WriteByte(')')
+			}
+			out.WriteByte(')')
+			return
 		}
 		fmt.Fprintf(out, "(%s", strings.TrimPrefix(x.Type().String(), "syntax."))
 		for i, n := 0, x.NumField(); i < n; i++ {
@@ -321,6 +358,10 @@ func writeTree(out *bytes.Buffer, x reflect.Value) {
 					fmt.Fprintf(out, " %s", name)
 				}
 				continue
+			case reflect.String:
+				if f.Len() == 0 {
+					continue
+				}
 			}
 			fmt.Fprintf(out, " %s=", name)
 			writeTree(out, f)
@@ -347,6 +388,238 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+func TestRecoverErrors(t *testing.T) {
+	for _, test := range []struct {
+		input, want, errors string
+	}{
+		{"x = 1 +\ny = 2\n",
+			`(AssignStmt Op== LHS=x RHS=(BinaryExpr X=1 Op=+ Y=(BadExpr)))
+(AssignStmt Op== LHS=y RHS=2)`,
+			`[foo.star:2:1: got newline, want primary expression]`},
+		{"x = 1\nf(a b)\ny = $\nz = 3\n",
+			`(AssignStmt Op== LHS=x RHS=1)
+(BadStmt)
+(BadStmt)
+(AssignStmt Op== LHS=z RHS=3)`,
+			"[foo.star:2:6: got identifier, want ',' foo.star:3:5: unexpected input character '$']"},
+		{"def f(x y):\n\tpass\n\tpass\nz = 3\n",
+			`(BadStmt)
+(AssignStmt Op== LHS=z RHS=3)`,
+			`[foo.star:1:10: got identifier, want ',']`},
+		{"def f():\n\tx = )\n\treturn 1\n",
+			`(DefStmt Name=f Function=(Function Body=((BadStmt) (ReturnStmt Result=1))))`,
+			`[foo.star:2:6: indentation error]`},
+		{"s = 'abc\nt = 1\n",
+			`(BadStmt)
+(AssignStmt Op== LHS=t RHS=1)`,
+			`[foo.star:1:5: unexpected newline in string]`},
+		{"  x = 1\n    (\n",
+			`(AssignStmt Op== LHS=x RHS=1)
+(BadStmt)`,
+			`[foo.star:1:3: unexpected indent foo.star:2:5: unexpected indent foo.star:3:1: got outdent, want primary expression]`},
+		{" :\n  :\n ",
+			`(BadStmt)`,
+			`[foo.star:1:2: unexpected indent foo.star:3:2: unexpected outdent]`},
+		{"x = 1\n",
+			`(AssignStmt Op== LHS=x RHS=1)`,
+			`[]`},
+	} {
+		f, err := syntax.Parse("foo.star", test.input, syntax.RecoverErrors)
+		var errors syntax.ErrorList
+		if err != nil {
+			var ok bool
+			errors, ok = err.(syntax.ErrorList)
+			if !ok {
+				t.Errorf("parse `%s` returned %T, want ErrorList", test.input, err)
+				continue
+			}
+		}
+		var msgs []string
+		for _, e := range errors {
+			msgs = append(msgs, e.Error())
+		}
+		if got := fmt.Sprint(msgs); got != test.errors {
+			t.Errorf("parse `%s` reported errors %s, want %s", test.input, got, test.errors)
+		}
+		if f == nil {
+			t.Errorf("parse `%s` returned no tree", test.input)
+			continue
+		}
+		var buf bytes.Buffer
+		for i, stmt := range f.Stmts {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			writeTree(&buf, reflect.ValueOf(stmt))
+		}
+		if got := buf.String(); test.want != got {
+			t.Errorf("parse `%s` = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+// TestRecoverErrorsTerminates checks that recovery makes progress on
+// every prefix of a file.
+func TestRecoverErrorsTerminates(t *testing.T) {
+	filename := starlarktest.DataFile("syntax", "testdata/errors.star")
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		f, err := syntax.Parse(filename, data[:i], syntax.RecoverErrors)
+		if f == nil {
+			t.Fatalf("prefix %d: no tree (err=%v)", i, err)
+		}
+	}
+}
+
+// TestRecoverErrorsMutations checks that parsing in RecoverErrors
+// mode terminates with a syntax tree for random mutations of the test
+// files, such as the deletion or insertion of indentation, brackets,
+// and colons, which unbalance the blocks of a file.
+func TestRecoverErrorsMutations(t *testing.T) {
+	files, err := filepath.Glob(starlarktest.DataFile("syntax", "testdata/*.star"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs [][]byte
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, data)
+	}
+	const chars = " \t\n:()[]{}'\"#\\x="
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := append([]byte(nil), inputs[rng.Intn(len(inputs))]...)
+		for j := rng.Intn(8); j >= 0 && len(data) > 0; j-- {
+			k := rng.Intn(len(data))
+			switch rng.Intn(3) {
+			case 0: // delete
+				data = append(data[:k], data[k+1:]...)
+			case 1: // insert
+				data = append(data[:k], append([]byte{chars[rng.Intn(len(chars))]}, data[k:]...)...)
+			case 2: // replace
+				data[k] = chars[rng.Intn(len(chars))]
+			}
+		}
+
+		done := make(chan *syntax.File, 1)
+		go func() {
+			f, _ := syntax.Parse("foo.star", data, syntax.RecoverErrors)
+			done <- f
+		}()
+		select {
+		case f := <-done:
+			if f == nil {
+				t.Fatalf("parse %q returned no tree", data)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("parse %q did not terminate", data)
+		}
+	}
+}
+
+// TestRetainTokens checks that the tokens and trivia of a file
+// reproduce it exactly.
+func TestRetainTokens(t *testing.T) {
+	inputs := []string{
+		"",
+		"x = 1",
+		"# comment\r\nx = [1,\r\n  2] # suffix\r\n\r\n",
+		"def f(x):\n\tif x: \\\n  pass\n\n\treturn x   \n",
+		"x = 'unterminated\ny = )\n", // errors are trivia
+	}
+	files, err := filepath.Glob(starlarktest.DataFile("syntax", "testdata/*.star"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(data))
+	}
+	for _, input := range inputs {
+		f, _ := syntax.Parse("foo.star", input, syntax.RetainTokens|syntax.RecoverErrors)
+		if got := string(f.Source()); got != input {
+			t.Errorf("Source() = %q, want %q", got, input)
+		}
+		if n := len(f.Tokens); n == 0 || f.Tokens[n-1].Token != syntax.EOF {
+			t.Errorf("tokens of %q do not end with EOF", input)
+		}
+		for _, tok := range f.Tokens {
+			if input[tok.Start:tok.End] != tok.Text {
+				t.Errorf("token %s at offset %d has text %q, want %q", tok.Token, tok.Start, tok.Text, input[tok.Start:tok.End])
+			}
+		}
+	}
+}
+
+func TestTokenRange(t *testing.T) {
+	const src = "x = f(a,  # comment\n      b)\nif x:\n    pass\ny = 1\n"
+	f, err := syntax.Parse("foo.star", src, syntax.RetainTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(n syntax.Node) string {
+		i, j := f.TokenRange(n)
+		var buf bytes.Buffer
+		for k, tok := range f.Tokens[i:j] {
+			if k > 0 {
+				buf.WriteString(tok.Leading)
+			}
+			buf.WriteString(tok.Text)
+		}
+		return buf.String()
+	}
+	call := f.Stmts[0].(*syntax.AssignStmt).RHS
+	for _, test := range []struct {
+		n    syntax.Node
+		want string
+	}{
+		{f.Stmts[0], "x = f(a,  # comment\n      b)"},
+		{call, "f(a,  # comment\n      b)"},
+		{call.(*syntax.CallExpr).Args[1], "b"},
+		{f.Stmts[1], "if x:\n    pass"},
+		{f.Stmts[2], "y = 1"},
+	} {
+		if got := text(test.n); got != test.want {
+			t.Errorf("text of %T = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestPragmas(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{"# starlark: lambda, float\nx = 1", "[1:13 lambda 1:21 float]"},
+		{"#!/usr/bin/env starlark\n\n#starlark:set bitwise,\n  # starlark: types\nx = 1", "[3:11 set 3:15 bitwise 4:15 types]"},
+		{"# Starlark: lambda\nx = 1", "[]"},         // case-sensitive
+		{"x = 1 # starlark: lambda\n", "[]"},        // suffix comment
+		{"x = 1\n# starlark: lambda\ny = 2", "[]"},  // after first statement
+		{"# starlark:\n# starlark: ,\nx = 1", "[]"}, // no features
+	} {
+		f, err := syntax.Parse("foo.star", test.input, 0)
+		if err != nil {
+			t.Errorf("parse `%s` failed: %v", test.input, err)
+			continue
+		}
+		var pragmas []string
+		for _, pragma := range f.Pragmas {
+			pragmas = append(pragmas, fmt.Sprintf("%d:%d %s", pragma.Pos.Line, pragma.Pos.Col, pragma.Name))
+		}
+		if got := fmt.Sprintf("%v", pragmas); got != test.want {
+			t.Errorf("pragmas of `%s` = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
 func TestWalk(t *testing.T) {
 	const src = `
 for x in y:
@@ -402,3 +675,77 @@ File
 		t.Errorf("got %s, want %s", got, want)
 	}
 }
+
+// TestSpans checks that the byte offsets of the start and end
+// positions of each node delimit its text.
+func TestSpans(t *testing.T) {
+	const src = "load(\"m\", \"a\")\n" +
+		"x = (1, 2)[0]\n" +
+		"y = \"é\\n\\t\" + s[1:2]\r\n" +
+		"z = '''a\n😀'''.f(b = [c], *d)\n" +
+		"def f(a, b = {1: 2}):\n\treturn -a if b else x.y\n"
+	f, err := syntax.Parse("foo.star", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	syntax.Walk(f, func(n syntax.Node) bool {
+		if n == nil {
+			return false
+		}
+		start, end := n.Span()
+		i, j := start.Offset(), end.Offset()
+		if i < 0 || j < i || j > len(src) {
+			t.Errorf("%s: %T has invalid span [%d:%d)", start, n, i, j)
+			return false
+		}
+		texts = append(texts, src[i:j])
+
+		// Check that offset, line, and column agree.
+		for _, pos := range []syntax.Position{start, end} {
+			noOffset := syntax.MakePosition(nil, pos.Line, pos.Col)
+			if got, want := noOffset.ByteCol([]byte(src)), pos.ByteCol([]byte(src)); got != want {
+				t.Errorf("%s: ByteCol is %d without offset, %d with", pos, got, want)
+			}
+		}
+		return true
+	})
+	got := strings.Join(texts, "|")
+	want := src[:len(src)-1] + "|" + // file, without final newline
+		`load("m", "a")|"m"|a|a|` +
+		`x = (1, 2)[0]|(1, 2)[0]|(1, 2)|1, 2|1|2|0|x|` +
+		`y = "é\n\t" + s[1:2]|"é\n\t" + s[1:2]|"é\n\t"|s[1:2]|s|1|2|y|` +
+		"z = '''a\n😀'''.f(b = [c], *d)|'''a\n😀'''.f(b = [c], *d)|'''a\n😀'''.f|'''a\n😀'''|f|" +
+		`b = [c]|b|[c]|c|*d|d|z|` +
+		"def f(a, b = {1: 2}):\n\treturn -a if b else x.y|f|a|b = {1: 2}|b|{1: 2}|1|2|" +
+		`return -a if b else x.y|-a if b else x.y|b|-a|a|x.y|x|y`
+	if got != want {
+		t.Errorf("got node texts:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	const src = "s = '😀é' + x\n"
+	f, err := syntax.Parse("foo.star", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := f.Stmts[0].(*syntax.AssignStmt).RHS.(*syntax.BinaryExpr).Y.(*syntax.Ident)
+	for _, pos := range []syntax.Position{x.NamePos, syntax.MakePosition(nil, 1, 12)} {
+		if pos.Col != 12 {
+			t.Errorf("Col = %d, want 12", pos.Col)
+		}
+		if got := pos.ByteCol([]byte(src)); got != 16 {
+			t.Errorf("ByteCol = %d, want 16", got)
+		}
+		if got := pos.UTF16Col([]byte(src)); got != 13 {
+			t.Errorf("UTF16Col = %d, want 13", got)
+		}
+	}
+	if got := x.NamePos.Offset(); got != 15 {
+		t.Errorf("Offset = %d, want 15", got)
+	}
+	if got := syntax.MakePosition(nil, 1, 12).Offset(); got != -1 {
+		t.Errorf("Offset of MakePosition = %d, want -1", got)
+	}
+}
@@ -51,7 +51,16 @@ const notEsc = " !#$%&()*+,-./:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ{|}~"
 // unquote unquotes the quoted string, returning the actual
 // string value, whether the original was triple-quoted, and
 // an error describing invalid input.
+// The quoted string may be that of a bytes literal (b"...");
+// the prefix is discarded.
 func unquote(quoted string) (s string, triple bool, err error) {
+	// Check for bytes prefix, which may precede or follow the raw prefix.
+	if strings.HasPrefix(quoted, "b") {
+		quoted = quoted[1:]
+	} else if strings.HasPrefix(quoted, "rb") {
+		quoted = "r" + quoted[2:]
+	}
+
 	// Check for raw prefix: means don't interpret the inner \.
 	raw := false
 	if strings.HasPrefix(quoted, "r") {
@@ -78,7 +87,14 @@ func unquote(quoted string) (s string, triple bool, err error) {
 		quoted = quoted[1 : len(quoted)-1]
 	}
 
-	// Now quoted is the quoted data, but no quotes.
+	s, err = unescape(quoted, raw)
+	return
+}
+
+// unescape returns the value of the quoted data of a string literal,
+// without its quotes, by processing escape sequences (unless raw)
+// and carriage returns.
+func unescape(quoted string, raw bool) (s string, err error) {
 	// If we're in raw mode or there are no escapes or
 	// carriage returns, we're done.
 	var unquoteChars string
@@ -7,6 +7,7 @@ package syntax
 // A lexical scanner for Starlark.
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,10 +31,12 @@ const (
 	OUTDENT
 
 	// Tokens with values
-	IDENT  // x
-	INT    // 123
-	FLOAT  // 1.23e45
-	STRING // "foo" or 'foo' or '''foo''' or r'foo' or r"foo"
+	IDENT   // x
+	INT     // 123
+	FLOAT   // 1.23e45
+	STRING  // "foo" or 'foo' or '''foo''' or r'foo' or r"foo"
+	BYTES   // b"foo" or b'foo' or rb'foo' or br"foo"
+	FSTRING // f"foo" or f'foo' or rf'foo' or fr"foo"
 
 	// Punctuation
 	PLUS          // +
@@ -77,6 +80,7 @@ const (
 	LTLT_EQ       // <<=
 	GTGT_EQ       // >>=
 	STARSTAR      // **
+	ARROW         // ->
 
 	// Keywords
 	AND
@@ -104,7 +108,7 @@ func (tok Token) String() string { return tokenNames[tok] }
 // GoString is like String but quotes punctuation tokens.
 // Use Sprintf("%#v", tok) when constructing error messages.
 func (tok Token) GoString() string {
-	if tok >= PLUS && tok <= STARSTAR {
+	if tok >= PLUS && tok <= ARROW {
 		return "'" + tokenNames[tok] + "'"
 	}
 	return tokenNames[tok]
@@ -120,6 +124,8 @@ var tokenNames = [...]string{
 	INT:           "int literal",
 	FLOAT:         "float literal",
 	STRING:        "string literal",
+	BYTES:         "bytes literal",
+	FSTRING:       "f-string literal",
 	PLUS:          "+",
 	MINUS:         "-",
 	STAR:          "*",
@@ -161,6 +167,7 @@ var tokenNames = [...]string{
 	LTLT_EQ:       "<<=",
 	GTGT_EQ:       ">>=",
 	STARSTAR:      "**",
+	ARROW:         "->",
 	AND:           "and",
 	BREAK:         "break",
 	CONTINUE:      "continue",
@@ -181,9 +188,10 @@ var tokenNames = [...]string{
 
 // A Position describes the location of a rune of input.
 type Position struct {
-	file *string // filename (indirect for compactness)
-	Line int32   // 1-based line number
-	Col  int32   // 1-based column number (strictly: rune)
+	file   *string // filename (indirect for compactness)
+	Line   int32   // 1-based line number
+	Col    int32   // 1-based column number (strictly: rune)
+	offset int32   // 1-based byte offset, or 0 if unknown
 }
 
 // IsValid reports whether the position is valid.
@@ -200,10 +208,21 @@ func (p Position) Filename() string {
 }
 
 // MakePosition returns position with the specified components.
-func MakePosition(file *string, line, col int32) Position { return Position{file, line, col} }
+// Its byte offset is unknown.
+func MakePosition(file *string, line, col int32) Position {
+	return Position{file: file, Line: line, Col: col}
+}
+
+// Offset returns the 0-based byte offset of the position within its
+// file, or -1 if it is unknown. Positions produced by the scanner,
+// and the end positions of syntax tree nodes, have known offsets.
+func (p Position) Offset() int { return int(p.offset) - 1 }
 
 // add returns the position at the end of s, assuming it starts at p.
 func (p Position) add(s string) Position {
+	if p.offset > 0 {
+		p.offset += int32(len(s))
+	}
 	if n := strings.Count(s, "\n"); n > 0 {
 		p.Line += int32(n)
 		s = s[strings.LastIndex(s, "\n")+1:]
@@ -213,6 +232,57 @@ func (p Position) add(s string) Position {
 	return p
 }
 
+// ByteCol returns the 1-based column of the position measured in
+// bytes rather than runes. The src argument is the content of the
+// file containing the position.
+func (p Position) ByteCol(src []byte) int {
+	return len(p.linePrefix(src)) + 1
+}
+
+// UTF16Col returns the 1-based column of the position measured in
+// UTF-16 code units, as used by the Language Server Protocol and by
+// JavaScript. The src argument is the content of the file containing
+// the position.
+func (p Position) UTF16Col(src []byte) int {
+	col := 1
+	for _, r := range string(p.linePrefix(src)) {
+		if r >= 0x10000 {
+			col += 2 // surrogate pair
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// linePrefix returns the portion of p's line in src that precedes p.
+func (p Position) linePrefix(src []byte) []byte {
+	if off := p.Offset(); off >= 0 && off <= len(src) {
+		return src[bytes.LastIndexAny(src[:off], "\r\n")+1 : off]
+	}
+
+	// Offset unknown: find the start of the line,
+	// then advance by runes.
+	start := 0
+	for line := int32(1); line < p.Line && start < len(src); line++ {
+		i := bytes.IndexAny(src[start:], "\r\n")
+		if i < 0 {
+			start = len(src)
+			break
+		}
+		start += i + 1
+		if src[start-1] == '\r' && start < len(src) && src[start] == '\n' {
+			start++ // DOS newline
+		}
+	}
+	end := start
+	for col := int32(1); col < p.Col && end < len(src); col++ {
+		_, size := utf8.DecodeRune(src[end:])
+		end += size
+	}
+	return src[start:end]
+}
+
 func (p Position) String() string {
 	if p.Col > 0 {
 		return fmt.Sprintf("%s:%d:%d", p.Filename(), p.Line, p.Col)
@@ -240,6 +310,12 @@ type scanner struct {
 	keepComments   bool      // accumulate comments in slice
 	lineComments   []Comment // list of full line comments (if keepComments)
 	suffixComments []Comment // list of suffix comments (if keepComments)
+	header         bool      // before first token of file; scan pragmas
+	pragmas        []Pragma  // dialect features requested by header comments
+
+	keepTokens bool          // accumulate tokens in slice
+	tokens     []SourceToken // list of tokens and their trivia (if keepTokens)
+	prevEnd    int           // byte offset of end of previous token (if keepTokens)
 }
 
 func newScanner(filename string, src interface{}, keepComments bool) (*scanner, error) {
@@ -250,7 +326,7 @@ func newScanner(filename string, src interface{}, keepComments bool) (*scanner,
 	return &scanner{
 		complete:     data,
 		rest:         data,
-		pos:          Position{file: &filename, Line: 1, Col: 1},
+		pos:          Position{file: &filename, Line: 1, Col: 1, offset: 1},
 		indentstk:    make([]int, 1, 10), // []int{0} + spare capacity
 		lineStart:    true,
 		keepComments: keepComments,
@@ -284,6 +360,12 @@ type Error struct {
 
 func (e Error) Error() string { return e.Pos.String() + ": " + e.Msg }
 
+// An ErrorList is a non-empty list of syntax errors,
+// as reported by Parse in RecoverErrors mode.
+type ErrorList []Error
+
+func (e ErrorList) Error() string { return e[0].Error() }
+
 // errorf is called to report an error.
 // errorf does not return: it panics.
 func (sc *scanner) error(pos Position, s string) {
@@ -348,9 +430,11 @@ func (sc *scanner) readRune() rune {
 	if b := sc.rest[0]; b < utf8.RuneSelf {
 		r := rune(b)
 		sc.rest = sc.rest[1:]
+		sc.pos.offset++
 		if r == '\r' {
 			if len(sc.rest) > 0 && sc.rest[0] == '\n' {
 				sc.rest = sc.rest[1:]
+				sc.pos.offset++
 			}
 			r = '\n'
 		}
@@ -365,6 +449,7 @@ func (sc *scanner) readRune() rune {
 
 	r, size := utf8.DecodeRune(sc.rest)
 	sc.rest = sc.rest[size:]
+	sc.pos.offset += int32(size)
 	sc.pos.Col++
 	return r
 }
@@ -498,7 +583,8 @@ start:
 
 	// comment
 	if c == '#' {
-		if sc.keepComments {
+		header := sc.header && blank
+		if sc.keepComments || header {
 			sc.startToken(val)
 		}
 		// Consume up to newline (included).
@@ -506,8 +592,13 @@ start:
 			sc.readRune()
 			c = sc.peekRune()
 		}
-		if sc.keepComments {
+		if sc.keepComments || header {
 			sc.endToken(val)
+		}
+		if header {
+			sc.scanPragma(val.pos, val.raw)
+		}
+		if sc.keepComments {
 			if blank {
 				sc.lineComments = append(sc.lineComments, Comment{val.pos, val.raw})
 			} else {
@@ -538,7 +629,7 @@ start:
 		if len(sc.indentstk) > 1 {
 			if savedLineStart {
 				sc.dents = 1 - len(sc.indentstk)
-				sc.indentstk = sc.indentstk[1:]
+				sc.indentstk = sc.indentstk[:1]
 				goto start
 			} else {
 				sc.lineStart = true
@@ -587,6 +678,16 @@ start:
 			return sc.scanString(val, c)
 		}
 
+		// bytes literal, possibly raw: b"", rb"", br""
+		// or f-string literal, possibly raw: f"", rf"", fr""
+		if n := bytesPrefixLen(sc.rest) + fstringPrefixLen(sc.rest); n > 0 {
+			for i := 0; i < n; i++ {
+				sc.readRune()
+			}
+			c = sc.peekRune()
+			return sc.scanString(val, c)
+		}
+
 		for isIdent(c) {
 			sc.readRune()
 			c = sc.peekRune()
@@ -617,10 +718,11 @@ start:
 
 	case ']', ')', '}':
 		if sc.depth == 0 {
-			sc.error(sc.pos, "indentation error")
-		} else {
-			sc.depth--
+			pos := sc.pos
+			sc.readRune() // skip it, for error recovery
+			sc.error(pos, "indentation error")
 		}
+		sc.depth--
 		sc.readRune()
 		sc.endToken(val)
 		switch c {
@@ -702,6 +804,10 @@ start:
 		case '+':
 			return PLUS
 		case '-':
+			if sc.peekRune() == '>' {
+				sc.readRune()
+				return ARROW
+			}
 			return MINUS
 		case '/':
 			if sc.peekRune() == '/' {
@@ -750,7 +856,9 @@ start:
 		return STAR
 	}
 
-	sc.errorf(sc.pos, "unexpected input character %#q", c)
+	pos := sc.pos
+	sc.readRune() // skip it, for error recovery
+	sc.errorf(pos, "unexpected input character %#q", c)
 	panic("unreachable")
 }
 
@@ -768,10 +876,10 @@ func (sc *scanner) scanString(val *tokenValue, quote rune) Token {
 		if sc.eof() {
 			sc.error(val.pos, "unexpected EOF in string")
 		}
-		c := sc.readRune()
-		if c == '\n' && !triple {
+		if sc.peekRune() == '\n' && !triple {
 			sc.error(val.pos, "unexpected newline in string")
 		}
+		c := sc.readRune()
 		if c == quote {
 			quoteCount++
 			if !triple || quoteCount == 3 {
@@ -789,14 +897,57 @@ func (sc *scanner) scanString(val *tokenValue, quote rune) Token {
 	}
 
 	sc.endToken(val)
+	if val.raw[0] == 'f' || val.raw[0] == 'r' && val.raw[1] == 'f' {
+		// The parser splits the f-string into literals and expressions.
+		return FSTRING
+	}
 	s, _, err := unquote(val.raw)
 	if err != nil {
 		sc.error(start, err.Error())
 	}
 	val.string = s
+	if val.raw[0] == 'b' || val.raw[0] == 'r' && val.raw[1] == 'b' {
+		return BYTES
+	}
 	return STRING
 }
 
+// bytesPrefixLen returns the length of the prefix (b, rb, or br) of
+// the bytes literal at the start of s, or zero if there is none.
+func bytesPrefixLen(s []byte) int {
+	n := 0
+	switch {
+	case len(s) > 2 && (s[0] == 'r' && s[1] == 'b' || s[0] == 'b' && s[1] == 'r'):
+		n = 2
+	case len(s) > 1 && s[0] == 'b':
+		n = 1
+	default:
+		return 0
+	}
+	if s[n] != '"' && s[n] != '\'' {
+		return 0
+	}
+	return n
+}
+
+// fstringPrefixLen returns the length of the prefix (f, rf, or fr) of
+// the f-string literal at the start of s, or zero if there is none.
+func fstringPrefixLen(s []byte) int {
+	n := 0
+	switch {
+	case len(s) > 2 && (s[0] == 'r' && s[1] == 'f' || s[0] == 'f' && s[1] == 'r'):
+		n = 2
+	case len(s) > 1 && s[0] == 'f':
+		n = 1
+	default:
+		return 0
+	}
+	if s[n] != '"' && s[n] != '\'' {
+		return 0
+	}
+	return n
+}
+
 func (sc *scanner) scanNumber(val *tokenValue, c rune) Token {
 	// https://github.com/google/starlark-go/blob/master/doc/spec.md#lexical-elements
 	//
@@ -1016,3 +1167,41 @@ var keywordToken = map[string]Token{
 	"with":     ILLEGAL,
 	"yield":    ILLEGAL,
 }
+
+// pragmaPrefix introduces a pragma comment, after the '#' and any spaces.
+const pragmaPrefix = "starlark:"
+
+// scanPragma appends to sc.pragmas the features named by the comment
+// text, which starts at pos, if it is a pragma.
+func (sc *scanner) scanPragma(pos Position, text string) {
+	rest := strings.TrimLeft(text[len("#"):], " \t")
+	if !strings.HasPrefix(rest, pragmaPrefix) {
+		return
+	}
+	pos = pos.add(text[:len(text)-len(rest)+len(pragmaPrefix)])
+	rest = rest[len(pragmaPrefix):]
+	for rest != "" {
+		// Skip separators.
+		i := strings.IndexFunc(rest, isPragmaName)
+		if i < 0 {
+			break
+		}
+		pos = pos.add(rest[:i])
+		rest = rest[i:]
+
+		// Read a name.
+		j := strings.IndexFunc(rest, func(r rune) bool { return !isPragmaName(r) })
+		if j < 0 {
+			j = len(rest)
+		}
+		sc.pragmas = append(sc.pragmas, Pragma{Pos: pos, Name: rest[:j]})
+		pos = pos.add(rest[:j])
+		rest = rest[j:]
+	}
+}
+
+// isPragmaName reports whether r may appear in a pragma feature name.
+// Any other rune is a separator.
+func isPragmaName(r rune) bool {
+	return r != ',' && !unicode.IsSpace(r)
+}
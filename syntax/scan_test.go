@@ -44,6 +44,10 @@ func scan(src interface{}) (tokens string, err error) {
 			fmt.Fprintf(&buf, "%e", val.float)
 		case STRING:
 			fmt.Fprintf(&buf, "%q", val.string)
+		case BYTES:
+			fmt.Fprintf(&buf, "b%q", val.string)
+		case FSTRING:
+			buf.WriteString(val.raw)
 		default:
 			buf.WriteString(tok.String())
 		}
@@ -67,6 +71,7 @@ func TestScanner(t *testing.T) {
 		{`print(x); print(y)`, "print ( x ) ; print ( y ) EOF"},
 		{"\nprint(\n1\n)\n", "print ( 1 ) newline EOF"}, // final \n is at toplevel on non-blank line => token
 		{`/ // /= //= ///=`, "/ // /= //= // /= EOF"},
+		{`- -> ->- >-`, "- -> -> - > - EOF"},
 		{`# hello
 print(x)`, "print ( x ) EOF"},
 		{`# hello
@@ -115,6 +120,7 @@ pass`, "pass newline pass EOF"}, // consecutive newlines are consolidated
 		{"pass\n ", "pass newline EOF"},
 		{"pass\n \n", "pass newline EOF"},
 		{"if x:\n  pass\n ", "if x : newline indent pass newline outdent EOF"},
+		{"if x:\n  if y:\n    pass\n ", "if x : newline indent if y : newline indent pass newline outdent outdent EOF"},
 		{`x = 1 + \
 2`, `x = 1 + 2 EOF`},
 		{`x = 'a\nb'`, `x = "a\nb" EOF`},
@@ -133,6 +139,16 @@ pass`, "pass newline pass EOF"}, // consecutive newlines are consolidated
 		{"x = r'a\\\nb'", `x = "a\\\nb" EOF`},
 		{"x = r'a\\\rb'", `x = "a\\\nb" EOF`},
 		{"x = r'a\\\r\nb'", `x = "a\\\nb" EOF`},
+		{`x = f"a{b}c"`, `x = f"a{b}c" EOF`},
+		{`x = rf'{a}\n' + fr"{b}"`, `x = rf'{a}\n' + fr"{b}" EOF`},
+		{`f '{a}'`, `f "{a}" EOF`}, // not an f-string
+		{"f'''{a}\n{b}'''", "f'''{a}\n{b}''' EOF"},
+		{`x = b'a\nb'`, `x = b"a\nb" EOF`},
+		{`x = b"\xff\x00"`, `x = b"\xff\x00" EOF`},
+		{`x = rb'a\nb'`, `x = b"a\\nb" EOF`},
+		{`x = br'a\nb'`, `x = b"a\\nb" EOF`},
+		{`x = b'''a'b'''`, `x = b"a'b" EOF`},
+		{`x = b + br + rb`, `x = b + br + rb EOF`},
 		{"a\rb", `a newline b EOF`},
 		{"a\nb", `a newline b EOF`},
 		{"a\r\nb", `a newline b EOF`},
@@ -8,6 +8,7 @@ package syntax // import "go.starlark.net/syntax"
 // A Node is a node in a Starlark syntax tree.
 type Node interface {
 	// Span returns the start and end position of the expression.
+	// The end position is that of the byte just after the node.
 	Span() (start, end Position)
 
 	// Comments returns the comments associated with this node.
@@ -67,8 +68,11 @@ func End(n Node) Position {
 // A File represents a Starlark file.
 type File struct {
 	commentsRef
-	Path  string
-	Stmts []Stmt
+	Path    string
+	Stmts   []Stmt
+	Options *FileOptions  // dialect of the file (the resolver adds pragmas)
+	Pragmas []Pragma      // dialect features requested by the file itself
+	Tokens  []SourceToken // all tokens, with trivia (if RetainTokens)
 
 	// set by resolver:
 	Locals  []*Ident // this file's (comprehension-)local variables
@@ -91,6 +95,7 @@ type Stmt interface {
 }
 
 func (*AssignStmt) stmt() {}
+func (*BadStmt) stmt()    {}
 func (*BranchStmt) stmt() {}
 func (*DefStmt) stmt()    {}
 func (*ExprStmt) stmt()   {}
@@ -124,6 +129,11 @@ type Function struct {
 	Params   []Expr   // param = ident | ident=expr | *ident | **ident
 	Body     []Stmt
 
+	// Type annotations (DefStmt only):
+	ParamTypes []Expr   // annotation of each parameter, or nil; nil if there are none
+	Arrow      Position // position of '->', if ResultType != nil
+	ResultType Expr     // result annotation, or nil
+
 	// set by resolver:
 	HasVarargs bool     // whether params includes *args (convenience)
 	HasKwargs  bool     // whether params includes **kwargs (convenience)
@@ -197,12 +207,21 @@ type LoadStmt struct {
 }
 
 func (x *LoadStmt) Span() (start, end Position) {
-	return x.Load, x.Rparen
+	return x.Load, x.Rparen.add(")")
 }
 
 // ModuleName returns the name of the module loaded by this statement.
 func (x *LoadStmt) ModuleName() string { return x.Module.Value.(string) }
 
+// A BadStmt is a placeholder for a statement containing syntax errors,
+// created by Parse in RecoverErrors mode.
+type BadStmt struct {
+	commentsRef
+	From, To Position // positions of first and offending tokens
+}
+
+func (x *BadStmt) Span() (start, end Position) { return x.From, x.To }
+
 // A BranchStmt changes the flow of control: break, continue, pass.
 type BranchStmt struct {
 	commentsRef
@@ -235,6 +254,7 @@ type Expr interface {
 	expr()
 }
 
+func (*BadExpr) expr()       {}
 func (*BinaryExpr) expr()    {}
 func (*CallExpr) expr()      {}
 func (*Comprehension) expr() {}
@@ -242,6 +262,7 @@ func (*CondExpr) expr()      {}
 func (*DictEntry) expr()     {}
 func (*DictExpr) expr()      {}
 func (*DotExpr) expr()       {}
+func (*FStringExpr) expr()   {}
 func (*Ident) expr()         {}
 func (*IndexExpr) expr()     {}
 func (*LambdaExpr) expr()    {}
@@ -252,6 +273,15 @@ func (*SliceExpr) expr()     {}
 func (*TupleExpr) expr()     {}
 func (*UnaryExpr) expr()     {}
 
+// A BadExpr is a placeholder for an expression containing syntax
+// errors, created by Parse in RecoverErrors mode.
+type BadExpr struct {
+	commentsRef
+	From, To Position
+}
+
+func (x *BadExpr) Span() (start, end Position) { return x.From, x.To }
+
 // An Ident represents an identifier.
 type Ident struct {
 	commentsRef
@@ -268,19 +298,43 @@ func (x *Ident) Span() (start, end Position) {
 	return x.NamePos, x.NamePos.add(x.Name)
 }
 
-// A Literal represents a literal string or number.
+// A Literal represents a literal string, bytes, or number.
 type Literal struct {
 	commentsRef
-	Token    Token // = STRING | INT
+	Token    Token // = STRING | BYTES | INT | FLOAT
 	TokenPos Position
 	Raw      string      // uninterpreted text
-	Value    interface{} // = string | int64 | *big.Int
+	Value    interface{} // = string | int64 | *big.Int | float64
 }
 
 func (x *Literal) Span() (start, end Position) {
 	return x.TokenPos, x.TokenPos.add(x.Raw)
 }
 
+// An FStringExpr represents an f-string literal such as f"{x}/{y!r:>5}":
+// literal text interleaved with replacement fields, whose expressions
+// are evaluated and formatted as if by str.format.
+type FStringExpr struct {
+	commentsRef
+	TokenPos Position
+	Raw      string   // uninterpreted text
+	Literals []string // decoded literal text; len(Literals) == len(Fields)+1
+	Fields   []*FStringField
+}
+
+func (x *FStringExpr) Span() (start, end Position) {
+	return x.TokenPos, x.TokenPos.add(x.Raw)
+}
+
+// An FStringField is a replacement field of an f-string: {X!Conv:Spec}.
+type FStringField struct {
+	Lbrace Position
+	X      Expr
+	Conv   string // "s", "r", or "" if absent
+	Spec   string // format specification, or "" if absent
+	Rbrace Position
+}
+
 // A ParenExpr represents a parenthesized expression: (X).
 type ParenExpr struct {
 	commentsRef
@@ -458,7 +512,7 @@ type TupleExpr struct {
 
 func (x *TupleExpr) Span() (start, end Position) {
 	if x.Lparen.IsValid() {
-		return x.Lparen, x.Rparen
+		return x.Lparen, x.Rparen.add(")")
 	} else {
 		return Start(x.List[0]), End(x.List[len(x.List)-1])
 	}
@@ -503,7 +557,7 @@ type SliceExpr struct {
 
 func (x *SliceExpr) Span() (start, end Position) {
 	start, _ = x.X.Span()
-	return start, x.Rbrack
+	return start, x.Rbrack.add("]")
 }
 
 // An IndexExpr represents an index expression: X[Y].
@@ -517,5 +571,5 @@ type IndexExpr struct {
 
 func (x *IndexExpr) Span() (start, end Position) {
 	start, _ = x.X.Span()
-	return start, x.Rbrack
+	return start, x.Rbrack.add("]")
 }
@@ -0,0 +1,78 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+// This file defines the lossless token representation of a file
+// produced by Parse in RetainTokens mode.
+
+import (
+	"bytes"
+	"sort"
+)
+
+// A SourceToken is a token of a file parsed in RetainTokens mode,
+// along with the trivia---spaces, blank lines, comments, and line
+// continuations---that precede it.
+//
+// The NEWLINE, INDENT, and OUTDENT tokens are included. Their text is
+// empty, except for a NEWLINE that ends a line, whose text is the line
+// terminator. The last token is always EOF; its Leading trivia is the
+// remainder of the file.
+type SourceToken struct {
+	Token      Token
+	Pos        Position // position of the start of the token
+	Start, End int      // byte offsets of the token's text within the file
+	Text       string   // text of the token
+	Leading    string   // trivia between the previous token and this one
+}
+
+// Source returns the text of a file parsed in RetainTokens mode.
+// It is identical to the input to Parse.
+func (f *File) Source() []byte {
+	var buf bytes.Buffer
+	for _, tok := range f.Tokens {
+		buf.WriteString(tok.Leading)
+		buf.WriteString(tok.Text)
+	}
+	return buf.Bytes()
+}
+
+// TokenRange returns the half-open range [i, j) of indices of
+// f.Tokens that comprise the syntax node n,
+// which must belong to file f, parsed in RetainTokens mode.
+// The range excludes the trivia before the first token,
+// and the NEWLINE that ends a statement.
+func (f *File) TokenRange(n Node) (i, j int) {
+	start, end := n.Span()
+	i = sort.Search(len(f.Tokens), func(k int) bool {
+		return !f.Tokens[k].Pos.isBefore(start)
+	})
+	j = i + sort.Search(len(f.Tokens)-i, func(k int) bool {
+		tok := f.Tokens[i+k]
+		return k > 0 && !tok.Pos.isBefore(end)
+	})
+	// Exclude empty tokens (INDENT, OUTDENT, or a final NEWLINE)
+	// at the end of a compound statement.
+	for j > i+1 && f.Tokens[j-1].Text == "" {
+		j--
+	}
+	return i, j
+}
+
+// recordToken appends the token just scanned to sc.tokens,
+// along with its leading trivia.
+func (sc *scanner) recordToken(tok Token, val *tokenValue) {
+	start := len(sc.complete) - len(sc.token)
+	end := len(sc.complete) - len(sc.rest)
+	sc.tokens = append(sc.tokens, SourceToken{
+		Token:   tok,
+		Pos:     val.pos,
+		Start:   start,
+		End:     end,
+		Text:    string(sc.complete[start:end]),
+		Leading: string(sc.complete[sc.prevEnd:start]),
+	})
+	sc.prevEnd = end
+}
@@ -22,7 +22,7 @@ func Walk(n Node, f func(Node) bool) {
 	case *ExprStmt:
 		Walk(n.X, f)
 
-	case *BranchStmt:
+	case *BranchStmt, *BadStmt:
 		// no-op
 
 	case *IfStmt:
@@ -36,8 +36,14 @@ func Walk(n Node, f func(Node) bool) {
 
 	case *DefStmt:
 		Walk(n.Name, f)
-		for _, param := range n.Function.Params {
+		for i, param := range n.Function.Params {
 			Walk(param, f)
+			if n.Function.ParamTypes != nil && n.Function.ParamTypes[i] != nil {
+				Walk(n.Function.ParamTypes[i], f)
+			}
+		}
+		if n.Function.ResultType != nil {
+			Walk(n.Function.ResultType, f)
 		}
 		walkStmts(n.Function.Body, f)
 
@@ -60,9 +66,14 @@ func Walk(n Node, f func(Node) bool) {
 			Walk(to, f)
 		}
 
-	case *Ident, *Literal:
+	case *Ident, *Literal, *BadExpr:
 		// no-op
 
+	case *FStringExpr:
+		for _, field := range n.Fields {
+			Walk(field.X, f)
+		}
+
 	case *ListExpr:
 		for _, x := range n.List {
 			Walk(x, f)
@@ -0,0 +1,693 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package typecheck defines a static type checker for Starlark files.
+//
+// The checker infers an approximate type for each variable of a
+// resolved file from the literals, built-in functions, and type
+// annotations that define it, and for each function from its
+// parameters and return statements. It then reports operations that
+// would certainly fail at run time: calling a value that is not a
+// function, selecting an attribute that a string, list, dict, or
+// other built-in value does not have, and calling a known function
+// with the wrong arguments.
+//
+// Types are inferred without regard to control flow: the type of a
+// variable is the join of the types of all values assigned to it, and
+// a variable that is assigned values of two different types has the
+// Unknown type, as does any expression whose type the checker cannot
+// determine. Consequently the checker reports no errors for correct
+// programs, but may fail to report errors in incorrect ones.
+package typecheck // import "go.starlark.net/typecheck"
+
+import (
+	"fmt"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+// A Config specifies the environment of the file to be checked.
+type Config struct {
+	// Predeclared gives the types of the module's predeclared names.
+	// Names not in the map have the Unknown type.
+	Predeclared map[string]Type
+
+	// Load returns the types of the globals of the named module,
+	// typically the Globals of its Info.
+	// If Load is nil, loaded names have the Unknown type.
+	Load func(module string) (map[string]Type, error)
+}
+
+// An Info holds the results of checking a file.
+type Info struct {
+	// Globals maps the name of each global variable
+	// of the module to its type.
+	Globals map[string]Type
+
+	// Types maps each expression in the file to its type.
+	Types map[syntax.Expr]Type
+}
+
+// An Error describes a likely error detected by the checker.
+type Error struct {
+	Pos syntax.Position
+	Msg string
+}
+
+func (e Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+// File checks the specified file, which must have been
+// successfully resolved by resolve.File.
+// It returns the inferred types and a list of likely errors.
+func File(file *syntax.File, config *Config) (*Info, []Error) {
+	if config == nil {
+		config = new(Config)
+	}
+	c := &checker{
+		file:     file,
+		config:   config,
+		vars:     make(map[*syntax.Ident]Type),
+		funcs:    make(map[*syntax.Function]*Func),
+		types:    make(map[syntax.Expr]Type),
+		modules:  make(map[string]map[string]Type),
+		loadErrs: make(map[string]error),
+	}
+
+	// Iterate to a fixed point. Each variable's type can only
+	// increase, from nil to a specific type to Unknown, so this
+	// terminates.
+	for {
+		c.changed = false
+		c.stmts(file.Stmts)
+		if !c.changed {
+			break
+		}
+	}
+
+	// Make a final pass to report errors.
+	c.report = true
+	c.stmts(file.Stmts)
+
+	info := &Info{
+		Globals: make(map[string]Type),
+		Types:   c.types,
+	}
+	for e, t := range info.Types {
+		if t == nil {
+			info.Types[e] = Unknown // e.g. result of a function that never returns
+		}
+	}
+	for _, id := range file.Globals {
+		t := c.typeOf(id)
+		if t == nil {
+			t = Unknown
+		}
+		info.Globals[id.Name] = t
+	}
+	return info, c.errors
+}
+
+type checker struct {
+	file     *syntax.File
+	config   *Config
+	vars     map[*syntax.Ident]Type     // type of each variable, keyed by its binding
+	funcs    map[*syntax.Function]*Func // type of each function
+	types    map[syntax.Expr]Type       // type of each expression, as of the latest pass
+	modules  map[string]map[string]Type // globals of each loaded module
+	loadErrs map[string]error           // error from each failed load
+	stack    []*syntax.Function         // enclosing functions, innermost last
+	changed  bool                       // whether a type changed during this pass
+	report   bool                       // whether to report errors (final pass)
+	errors   []Error
+}
+
+func (c *checker) errorf(pos syntax.Position, format string, args ...interface{}) {
+	if c.report {
+		c.errors = append(c.errors, Error{pos, fmt.Sprintf(format, args...)})
+	}
+}
+
+// binding returns the identifier that binds the variable referred to by id,
+// or nil if id is not a local, free, or global variable.
+func (c *checker) binding(id *syntax.Ident) *syntax.Ident {
+	locals := func(depth int) []*syntax.Ident {
+		if depth < 0 {
+			return c.file.Locals
+		}
+		return c.stack[depth].Locals
+	}
+	switch resolve.Scope(id.Scope) {
+	case resolve.Local:
+		return locals(len(c.stack) - 1)[id.Index]
+	case resolve.Free:
+		// Follow the chain of free variables outwards
+		// to the function in which the variable is local.
+		index := id.Index
+		for depth := len(c.stack) - 1; depth >= 0; depth-- {
+			fv := c.stack[depth].FreeVars[index]
+			if resolve.Scope(fv.Scope) == resolve.Local {
+				return locals(depth - 1)[fv.Index]
+			}
+			index = fv.Index
+		}
+	case resolve.Global:
+		return c.file.Globals[id.Index]
+	}
+	return nil
+}
+
+// typeOf returns the type of the variable referred to by id,
+// or nil if no value has yet been assigned to it.
+func (c *checker) typeOf(id *syntax.Ident) Type {
+	switch resolve.Scope(id.Scope) {
+	case resolve.Predeclared:
+		if t, ok := c.config.Predeclared[id.Name]; ok {
+			return t
+		}
+	case resolve.Universal:
+		if t, ok := universe[id.Name]; ok {
+			return t
+		}
+	default:
+		if b := c.binding(id); b != nil {
+			return c.vars[b]
+		}
+	}
+	return Unknown
+}
+
+// bind records that the variable bound by id may have type t.
+func (c *checker) bind(id *syntax.Ident, t Type) {
+	b := c.binding(id)
+	if b == nil {
+		return
+	}
+	if old := c.vars[b]; join(old, t) != old {
+		c.vars[b] = join(old, t)
+		c.changed = true
+	}
+}
+
+func (c *checker) stmts(stmts []syntax.Stmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+func (c *checker) stmt(stmt syntax.Stmt) {
+	switch stmt := stmt.(type) {
+	case *syntax.ExprStmt:
+		c.expr(stmt.X)
+
+	case *syntax.BranchStmt, *syntax.BadStmt:
+		// no-op
+
+	case *syntax.IfStmt:
+		c.expr(stmt.Cond)
+		c.stmts(stmt.True)
+		c.stmts(stmt.False)
+
+	case *syntax.AssignStmt:
+		y := c.expr(stmt.RHS)
+		if stmt.Op == syntax.EQ {
+			c.assign(stmt.LHS, stmt.RHS, y)
+		} else {
+			// augmented assignment
+			x := c.expr(stmt.LHS)
+			op := stmt.Op - syntax.PLUS_EQ + syntax.PLUS
+			if id, ok := stmt.LHS.(*syntax.Ident); ok {
+				c.bind(id, binary(op, x, y))
+			}
+		}
+
+	case *syntax.DefStmt:
+		c.bind(stmt.Name, c.function(stmt.Name.Name, &stmt.Function))
+
+	case *syntax.ForStmt:
+		x := c.expr(stmt.X)
+		c.assign(stmt.Vars, nil, elemType(x))
+		c.stmts(stmt.Body)
+
+	case *syntax.ReturnStmt:
+		t := Type(None)
+		if stmt.Result != nil {
+			t = c.expr(stmt.Result)
+		}
+		if len(c.stack) > 0 {
+			c.result(c.funcs[c.stack[len(c.stack)-1]], t)
+		}
+
+	case *syntax.LoadStmt:
+		module := stmt.Module.Value.(string)
+		globals, ok := c.modules[module]
+		if !ok && c.config.Load != nil {
+			var err error
+			globals, err = c.config.Load(module)
+			if err != nil {
+				c.loadErrs[module] = err
+			}
+			c.modules[module] = globals
+		}
+		if err := c.loadErrs[module]; err != nil {
+			c.errorf(stmt.Module.TokenPos, "cannot load %s: %v", module, err)
+		}
+		for i, from := range stmt.From {
+			t, ok := globals[from.Name]
+			if !ok {
+				t = Unknown
+				if globals != nil {
+					c.errorf(from.NamePos, "load: name %s not found in module %s", from.Name, module)
+				}
+			}
+			c.bind(stmt.To[i], t)
+		}
+
+	default:
+		panic(fmt.Sprintf("unexpected stmt %T", stmt))
+	}
+}
+
+// assign records the assignment of a value of type t, computed by the
+// expression rhs (if known), to the expression lhs.
+func (c *checker) assign(lhs, rhs syntax.Expr, t Type) {
+	switch lhs := lhs.(type) {
+	case *syntax.Ident:
+		c.bind(lhs, t)
+		c.types[lhs] = c.typeOf(lhs)
+
+	case *syntax.ParenExpr:
+		if paren, ok := rhs.(*syntax.ParenExpr); ok {
+			rhs = paren.X
+		}
+		c.assign(lhs.X, rhs, t)
+
+	case *syntax.TupleExpr:
+		c.assignSequence(lhs.List, rhs)
+
+	case *syntax.ListExpr:
+		c.assignSequence(lhs.List, rhs)
+
+	default:
+		// x[i] = y or x.f = y
+		c.expr(lhs)
+	}
+}
+
+func (c *checker) assignSequence(lhs []syntax.Expr, rhs syntax.Expr) {
+	// If the RHS is a tuple or list expression of the
+	// same length, assign its elements pairwise.
+	var elems []syntax.Expr
+	switch rhs := rhs.(type) {
+	case *syntax.TupleExpr:
+		elems = rhs.List
+	case *syntax.ListExpr:
+		elems = rhs.List
+	}
+	for i, x := range lhs {
+		if len(elems) == len(lhs) {
+			c.assign(x, elems[i], c.types[elems[i]])
+		} else {
+			c.assign(x, nil, Unknown)
+		}
+	}
+}
+
+// elemType returns the type of the elements of an iterable of type t.
+func elemType(t Type) Type {
+	if t == Range {
+		return Int
+	}
+	return Unknown
+}
+
+// function returns the type of the specified function,
+// after checking its body.
+func (c *checker) function(name string, f *syntax.Function) *Func {
+	fn := c.funcs[f]
+	if fn == nil {
+		fn = &Func{Name: name, Pos: f.StartPos, inferred: f.ResultType == nil}
+		for i, param := range f.Params {
+			switch param := param.(type) {
+			case *syntax.Ident:
+				fn.Params = append(fn.Params, param.Name)
+				fn.Required++
+			case *syntax.BinaryExpr:
+				fn.Params = append(fn.Params, param.X.(*syntax.Ident).Name)
+			case *syntax.UnaryExpr:
+				if param.Op == syntax.STAR {
+					fn.Varargs = true
+				} else {
+					fn.Kwargs = true
+				}
+				continue
+			}
+			if f.ParamTypes != nil {
+				fn.ParamTypes = append(fn.ParamTypes, annotation(f.ParamTypes[i]))
+			}
+		}
+		if f.ResultType != nil {
+			fn.Result = annotation(f.ResultType)
+		}
+		c.funcs[f] = fn
+	}
+
+	// Defaults are evaluated in the enclosing environment.
+	for _, param := range f.Params {
+		if binary, ok := param.(*syntax.BinaryExpr); ok {
+			c.expr(binary.Y)
+		}
+	}
+
+	c.stack = append(c.stack, f)
+	for i, param := range f.Params {
+		switch param := param.(type) {
+		case *syntax.Ident:
+			c.bind(param, c.paramType(fn, i))
+		case *syntax.BinaryExpr:
+			c.bind(param.X.(*syntax.Ident), c.paramType(fn, i))
+		case *syntax.UnaryExpr:
+			if param.Op == syntax.STAR {
+				c.bind(param.X.(*syntax.Ident), Tuple)
+			} else {
+				c.bind(param.X.(*syntax.Ident), Dict)
+			}
+		}
+	}
+	c.stmts(f.Body)
+	if _, ok := f.Body[len(f.Body)-1].(*syntax.ReturnStmt); !ok {
+		c.result(fn, None) // control may reach the end of the body
+	}
+	c.stack = c.stack[:len(c.stack)-1]
+	return fn
+}
+
+// paramType returns the declared type of the ith parameter of fn.
+func (c *checker) paramType(fn *Func, i int) Type {
+	if fn.ParamTypes == nil {
+		return Unknown
+	}
+	return fn.ParamTypes[i]
+}
+
+// result records that function fn may return a value of type t.
+func (c *checker) result(fn *Func, t Type) {
+	if fn.inferred && join(fn.Result, t) != fn.Result {
+		fn.Result = join(fn.Result, t)
+		c.changed = true
+	}
+}
+
+// annotation returns the type denoted by a type annotation.
+func annotation(e syntax.Expr) Type {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		if resolve.Scope(e.Scope) == resolve.Universal {
+			if t, ok := annotations[e.Name]; ok {
+				return t
+			}
+		}
+	case *syntax.IndexExpr:
+		return annotation(e.X) // ignore type arguments
+	}
+	return Unknown
+}
+
+// expr checks an expression and returns its type.
+func (c *checker) expr(e syntax.Expr) Type {
+	t := c.expr0(e)
+	c.types[e] = t
+	return t
+}
+
+func (c *checker) expr0(e syntax.Expr) Type {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		return c.typeOf(e)
+
+	case *syntax.BadExpr:
+		return Unknown
+
+	case *syntax.Literal:
+		switch e.Token {
+		case syntax.STRING:
+			return String
+		case syntax.BYTES:
+			return Bytes
+		case syntax.INT:
+			return Int
+		case syntax.FLOAT:
+			return Float
+		}
+
+	case *syntax.FStringExpr:
+		for _, field := range e.Fields {
+			c.expr(field.X)
+		}
+		return String
+
+	case *syntax.ListExpr:
+		for _, x := range e.List {
+			c.expr(x)
+		}
+		return List
+
+	case *syntax.TupleExpr:
+		for _, x := range e.List {
+			c.expr(x)
+		}
+		return Tuple
+
+	case *syntax.DictExpr:
+		for _, entry := range e.List {
+			entry := entry.(*syntax.DictEntry)
+			c.expr(entry.Key)
+			c.expr(entry.Value)
+		}
+		return Dict
+
+	case *syntax.ParenExpr:
+		return c.expr(e.X)
+
+	case *syntax.CondExpr:
+		c.expr(e.Cond)
+		return join(c.expr(e.True), c.expr(e.False))
+
+	case *syntax.Comprehension:
+		for _, clause := range e.Clauses {
+			switch clause := clause.(type) {
+			case *syntax.IfClause:
+				c.expr(clause.Cond)
+			case *syntax.ForClause:
+				x := c.expr(clause.X)
+				c.assign(clause.Vars, nil, elemType(x))
+			}
+		}
+		if e.Curly {
+			if entry, ok := e.Body.(*syntax.DictEntry); ok {
+				c.expr(entry.Key)
+				c.expr(entry.Value)
+				return Dict
+			}
+			c.expr(e.Body)
+			return Set
+		}
+		c.expr(e.Body)
+		return List
+
+	case *syntax.UnaryExpr:
+		x := c.expr(e.X)
+		switch e.Op {
+		case syntax.NOT:
+			return Bool
+		case syntax.MINUS, syntax.PLUS:
+			if x == Int || x == Float {
+				return x
+			}
+		case syntax.TILDE:
+			if x == Int {
+				return Int
+			}
+		}
+
+	case *syntax.BinaryExpr:
+		return binary(e.Op, c.expr(e.X), c.expr(e.Y))
+
+	case *syntax.DotExpr:
+		x := c.expr(e.X)
+		if b, ok := x.(Basic); ok && !hasAttr(b, e.Name.Name) {
+			c.errorf(e.Dot, "%s has no .%s field or method", b, e.Name.Name)
+		}
+
+	case *syntax.IndexExpr:
+		x := c.expr(e.X)
+		c.expr(e.Y)
+		switch x {
+		case String:
+			return String
+		case Bytes:
+			return Int
+		}
+
+	case *syntax.SliceExpr:
+		x := c.expr(e.X)
+		for _, y := range []syntax.Expr{e.Lo, e.Hi, e.Step} {
+			if y != nil {
+				c.expr(y)
+			}
+		}
+		switch x {
+		case String, Bytes, List, Tuple, Range:
+			return x
+		}
+
+	case *syntax.LambdaExpr:
+		return c.function("lambda", &e.Function)
+
+	case *syntax.CallExpr:
+		return c.call(e)
+
+	default:
+		panic(fmt.Sprintf("unexpected expr %T", e))
+	}
+	return Unknown
+}
+
+// call checks a call expression and returns the type of its result.
+func (c *checker) call(call *syntax.CallExpr) Type {
+	fn := c.expr(call.Fn)
+
+	var args []syntax.Expr     // positional arguments
+	var kwargs []*syntax.Ident // keyword argument names
+	var kwvalues []syntax.Expr // keyword argument values
+	variadic := false          // call has *args or **kwargs
+	for _, arg := range call.Args {
+		switch arg := arg.(type) {
+		case *syntax.BinaryExpr:
+			if arg.Op == syntax.EQ {
+				kwargs = append(kwargs, arg.X.(*syntax.Ident))
+				kwvalues = append(kwvalues, arg.Y)
+				c.expr(arg.Y)
+				continue
+			}
+		case *syntax.UnaryExpr:
+			if arg.Op == syntax.STAR || arg.Op == syntax.STARSTAR {
+				variadic = true
+				c.expr(arg.X)
+				continue
+			}
+		}
+		args = append(args, arg)
+		c.expr(arg)
+	}
+
+	switch fn := fn.(type) {
+	case nil:
+		return nil // not yet inferred
+
+	case Basic:
+		c.errorf(call.Lparen, "invalid call of non-function (%s)", fn)
+		return Unknown
+
+	case *Func:
+		if !variadic {
+			c.checkArgs(call, fn, args, kwargs, kwvalues)
+		}
+		return fn.Result // nil if not yet inferred
+	}
+
+	// method call?
+	if dot, ok := call.Fn.(*syntax.DotExpr); ok {
+		if recv, ok := c.types[dot.X].(Basic); ok {
+			return methodResult(recv, dot.Name.Name)
+		}
+	}
+	return Unknown
+}
+
+// checkArgs checks the arguments of a call of a known function.
+func (c *checker) checkArgs(call *syntax.CallExpr, fn *Func, args []syntax.Expr, kwargs []*syntax.Ident, kwvalues []syntax.Expr) {
+	cond := func(x bool, y, z string) string {
+		if x {
+			return y
+		}
+		return z
+	}
+	plural := func(n int) string { return cond(n == 1, "", "s") }
+
+	nparams := len(fn.Params)
+	if len(args) > nparams && !fn.Varargs {
+		c.errorf(call.Lparen, "function %s takes %s %d argument%s (%d given)",
+			fn.Name,
+			cond(fn.Required < nparams, "at most", "exactly"),
+			nparams, plural(nparams),
+			len(args)+len(kwargs))
+		return
+	}
+
+	defined := make([]bool, nparams)
+	for i := range args {
+		if i < nparams {
+			defined[i] = true
+			c.checkArg(fn, i, args[i])
+		}
+	}
+	for j, k := range kwargs {
+		i := -1
+		for p, name := range fn.Params {
+			if name == k.Name {
+				i = p
+				break
+			}
+		}
+		if i < 0 {
+			if !fn.Kwargs {
+				c.errorf(k.NamePos, "function %s got an unexpected keyword argument %s", fn.Name, k.Name)
+				return
+			}
+			continue
+		}
+		if defined[i] {
+			c.errorf(k.NamePos, "function %s got multiple values for keyword argument %s", fn.Name, k.Name)
+			return
+		}
+		defined[i] = true
+		c.checkArg(fn, i, kwvalues[j])
+	}
+
+	// A keyword argument to a built-in function may
+	// satisfy one of its positional-only parameters.
+	if !fn.Pos.IsValid() && len(kwargs) > 0 {
+		return
+	}
+	ndefined := 0
+	missing := false
+	for i, ok := range defined {
+		if ok {
+			ndefined++
+		} else if i < fn.Required {
+			missing = true
+		}
+	}
+	if missing {
+		c.errorf(call.Lparen, "function %s takes %s %d argument%s (%d given)",
+			fn.Name,
+			cond(fn.Varargs || fn.Required < nparams, "at least", "exactly"),
+			fn.Required, plural(fn.Required),
+			ndefined)
+	}
+}
+
+// checkArg checks the argument for the ith parameter of fn
+// against its declared type.
+func (c *checker) checkArg(fn *Func, i int, arg syntax.Expr) {
+	want := c.paramType(fn, i)
+	if want == Unknown {
+		return
+	}
+	if got := c.types[arg]; got != nil && got != Unknown && got != want {
+		start, _ := arg.Span()
+		c.errorf(start, "function %s: parameter %s has type %s, want %s", fn.Name, fn.Params[i], got, want)
+	}
+}
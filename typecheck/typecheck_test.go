@@ -0,0 +1,186 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package typecheck_test
+
+import (
+	"fmt"
+	"testing"
+
+	"go.starlark.net/internal/chunkedfile"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarktest"
+	"go.starlark.net/syntax"
+	"go.starlark.net/typecheck"
+)
+
+var opts = &syntax.FileOptions{
+	Lambda:    true,
+	NestedDef: true,
+	Float:     true,
+	Set:       true,
+	Bitwise:   true,
+	FString:   true,
+	Types:     true,
+}
+
+// check parses, resolves, and type-checks a file.
+func check(filename string, src interface{}, config *typecheck.Config) (*typecheck.Info, []typecheck.Error, error) {
+	f, err := opts.Parse(filename, src, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	isPredeclared := func(name string) bool { return name == "host" }
+	if err := resolve.File(f, isPredeclared, starlark.Universe.Has); err != nil {
+		return nil, nil, err
+	}
+	info, errors := typecheck.File(f, config)
+	return info, errors, nil
+}
+
+const lib = `
+def greet(name: str, punct = "!") -> str:
+	return "hello, " + name + punct
+
+count = 3
+names = ["a", "b"]
+`
+
+func TestCheck(t *testing.T) {
+	config := &typecheck.Config{
+		Predeclared: map[string]typecheck.Type{"host": typecheck.String},
+		Load: func(module string) (map[string]typecheck.Type, error) {
+			if module != "lib.star" {
+				return nil, fmt.Errorf("no such module")
+			}
+			info, errors, err := check(module, lib, nil)
+			if err != nil || errors != nil {
+				return nil, fmt.Errorf("%v %v", err, errors)
+			}
+			return info.Globals, nil
+		},
+	}
+
+	filename := starlarktest.DataFile("typecheck", "testdata/typecheck.star")
+	for _, chunk := range chunkedfile.Read(filename, t) {
+		_, errors, err := check(filename, chunk.Source, config)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, err := range errors {
+			chunk.GotError(int(err.Pos.Line), err.Msg)
+		}
+		chunk.Done()
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	const src = `
+load("lib.star", "greet", "count")
+
+def f(x):
+	if x:
+		return [x]
+	return []
+
+def g(x):
+	return x + 1
+
+def h(n):
+	return h(n - 1) if n else 0
+
+a = 1
+b = a * 2.0
+c = "%d" % a
+d = f(1)
+e = g
+i = {k: v for k, v in []}
+j = greet("bob")
+k = count
+l = len
+m = host.split(",")
+n = h(3)
+o = [1, "a"][0]
+p = None if a else 1
+`
+	config := &typecheck.Config{
+		Predeclared: map[string]typecheck.Type{"host": typecheck.String},
+		Load: func(module string) (map[string]typecheck.Type, error) {
+			info, _, err := check(module, lib, nil)
+			if err != nil {
+				return nil, err
+			}
+			return info.Globals, nil
+		},
+	}
+	info, errors, err := check("globals.star", src, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors != nil {
+		t.Fatal(errors)
+	}
+	for _, test := range []struct{ name, want string }{
+		{"a", "int"},
+		{"b", "float"},
+		{"c", "string"},
+		{"d", "list"},
+		{"e", "func g(x) -> unknown"},
+		{"f", "func f(x) -> list"},
+		{"greet", "func greet(name: string, punct=...) -> string"},
+		{"h", "func h(n) -> int"},
+		{"i", "dict"},
+		{"j", "string"},
+		{"k", "int"},
+		{"l", "func len(_) -> int"},
+		{"m", "list"},
+		{"n", "int"},
+		{"o", "unknown"},
+		{"p", "unknown"},
+	} {
+		if got := info.Globals[test.name]; fmt.Sprint(got) != test.want {
+			t.Errorf("type of %s = %v, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+// TestUniverse ensures that the types of the built-in functions do not
+// reject calls that are valid at run time.
+func TestUniverse(t *testing.T) {
+	filename := starlarktest.DataFile("typecheck", "testdata/universe.star")
+	f, err := opts.Parse(filename, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := make(map[string]bool)
+	syntax.Walk(f, func(n syntax.Node) bool {
+		if call, ok := n.(*syntax.CallExpr); ok {
+			if id, ok := call.Fn.(*syntax.Ident); ok {
+				called[id.Name] = true
+			}
+		}
+		return true
+	})
+	for name, v := range starlark.Universe {
+		if _, ok := v.(*starlark.Builtin); ok && !called[name] {
+			t.Errorf("%s does not call %s", filename, name)
+		}
+	}
+
+	thread := &starlark.Thread{Print: func(*starlark.Thread, string) {}}
+	if _, err := starlark.ExecFileOptions(opts, thread, filename, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	_, errors, err := check(filename, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range errors {
+		t.Errorf("%s: %s", err.Pos, err.Msg)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package typecheck
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// A Type is a static approximation of the type of a Starlark value.
+// It is either Unknown, a Basic type, or a *Func.
+type Type interface {
+	String() string
+}
+
+// Unknown is the type of an expression whose type cannot be inferred.
+// It is compatible with every operation.
+var Unknown Type = unknown{}
+
+type unknown struct{}
+
+func (unknown) String() string { return "unknown" }
+
+// A Basic is a built-in type, named by the result of the Type method
+// of its values.
+type Basic string
+
+func (b Basic) String() string { return string(b) }
+
+// The basic types.
+const (
+	None   Basic = "NoneType"
+	Bool   Basic = "bool"
+	Int    Basic = "int"
+	Float  Basic = "float"
+	String Basic = "string"
+	Bytes  Basic = "bytes"
+	List   Basic = "list"
+	Tuple  Basic = "tuple"
+	Dict   Basic = "dict"
+	Set    Basic = "set"
+	Range  Basic = "range"
+)
+
+// A Func is the type of a function whose signature is known,
+// either a built-in or one defined by a def statement or lambda expression.
+type Func struct {
+	Name     string
+	Pos      syntax.Position // position of def or lambda; invalid for built-ins
+	Params   []string        // names of ordinary parameters (sans * and **); "" if positional-only
+	Required int             // number of leading Params that are required
+	Varargs  bool            // accepts surplus positional arguments
+	Kwargs   bool            // accepts surplus keyword arguments
+
+	ParamTypes []Type // declared type of each of Params, or nil if none is declared
+	Result     Type   // result type; nil until inferred
+
+	inferred bool // Result is inferred from return statements
+}
+
+func (fn *Func) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "func %s(", fn.Name)
+	for i, name := range fn.Params {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if name == "" {
+			name = "_"
+		}
+		buf.WriteString(name)
+		if fn.ParamTypes != nil && fn.ParamTypes[i] != Unknown {
+			fmt.Fprintf(&buf, ": %s", fn.ParamTypes[i])
+		}
+		if i >= fn.Required {
+			buf.WriteString("=...")
+		}
+	}
+	if fn.Varargs {
+		if len(fn.Params) > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("*args")
+	}
+	if fn.Kwargs {
+		if len(fn.Params) > 0 || fn.Varargs {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("**kwargs")
+	}
+	fmt.Fprintf(&buf, ") -> %s", fn.result())
+	return buf.String()
+}
+
+// result returns the result type of fn, or Unknown if not yet inferred.
+func (fn *Func) result() Type {
+	if fn.Result == nil {
+		return Unknown
+	}
+	return fn.Result
+}
+
+// join returns the least type that includes both x and y.
+// Throughout this package, nil is the type of no values, such as the
+// result of a function whose result has not yet been inferred.
+func join(x, y Type) Type {
+	if x == nil {
+		return y
+	}
+	if y == nil || x == y {
+		return x
+	}
+	return Unknown
+}
+
+// builtin returns the type of a built-in function.
+// Parameters are positional-only unless named.
+func builtin(name string, required, optional int, varargs, kwargs bool, result Type) *Func {
+	return &Func{
+		Name:     name,
+		Params:   make([]string, required+optional),
+		Required: required,
+		Varargs:  varargs,
+		Kwargs:   kwargs,
+		Result:   result,
+	}
+}
+
+// universe gives the types of the names in starlark.Universe.
+var universe = map[string]Type{
+	"None":      None,
+	"True":      Bool,
+	"False":     Bool,
+	"any":       builtin("any", 1, 0, false, false, Bool),
+	"all":       builtin("all", 1, 0, false, false, Bool),
+	"bool":      builtin("bool", 0, 1, false, false, Bool),
+	"bytes":     builtin("bytes", 0, 1, false, false, Bytes),
+	"chr":       builtin("chr", 1, 0, false, false, String),
+	"dict":      builtin("dict", 0, 1, false, true, Dict),
+	"dir":       builtin("dir", 1, 0, false, false, List),
+	"enumerate": builtin("enumerate", 1, 1, false, true, List),
+	"float":     builtin("float", 0, 1, false, false, Float),
+	"getattr":   builtin("getattr", 2, 1, false, false, Unknown),
+	"hasattr":   builtin("hasattr", 2, 0, false, false, Bool),
+	"hash":      builtin("hash", 1, 0, false, false, Int),
+	"int":       builtin("int", 0, 2, false, true, Int),
+	"len":       builtin("len", 1, 0, false, false, Int),
+	"list":      builtin("list", 0, 1, false, false, List),
+	"max":       builtin("max", 1, 0, true, true, Unknown),
+	"min":       builtin("min", 1, 0, true, true, Unknown),
+	"ord":       builtin("ord", 1, 0, false, false, Int),
+	"print":     builtin("print", 0, 0, true, true, None),
+	"range":     builtin("range", 1, 2, false, false, Range),
+	"repr":      builtin("repr", 1, 0, false, false, String),
+	"reversed":  builtin("reversed", 1, 0, false, false, List),
+	"set":       builtin("set", 0, 1, false, false, Set),
+	"sorted":    builtin("sorted", 1, 0, false, true, List),
+	"str":       builtin("str", 1, 0, false, false, String),
+	"tuple":     builtin("tuple", 0, 1, false, false, Tuple),
+	"type":      builtin("type", 1, 0, false, false, String),
+	"zip":       builtin("zip", 0, 0, true, false, List),
+}
+
+// annotations maps the name of each built-in type, as used in a type
+// annotation, to its type.
+var annotations = map[string]Basic{
+	"None":  None,
+	"bool":  Bool,
+	"bytes": Bytes,
+	"dict":  Dict,
+	"float": Float,
+	"int":   Int,
+	"list":  List,
+	"set":   Set,
+	"str":   String,
+	"tuple": Tuple,
+}
+
+// prototypes holds a value of each basic type,
+// from which we obtain its set of attributes.
+var prototypes = map[Basic]starlark.Value{
+	None:   starlark.None,
+	Bool:   starlark.False,
+	Int:    starlark.MakeInt(0),
+	Float:  starlark.Float(0),
+	String: starlark.String(""),
+	Bytes:  starlark.Bytes(""),
+	List:   starlark.NewList(nil),
+	Tuple:  starlark.Tuple(nil),
+	Dict:   new(starlark.Dict),
+	Set:    new(starlark.Set),
+}
+
+// hasAttr reports whether values of type t have the named attribute.
+func hasAttr(t Basic, name string) bool {
+	v, ok := prototypes[t]
+	if !ok {
+		return true // no prototype; assume the best
+	}
+	x, ok := v.(starlark.HasAttrs)
+	if !ok {
+		return false
+	}
+	for _, attr := range x.AttrNames() {
+		if attr == name {
+			return true
+		}
+	}
+	return false
+}
+
+// methodResult returns the result type of a call to the named method
+// of a value of type t.
+func methodResult(t Basic, name string) Type {
+	switch t {
+	case String:
+		switch name {
+		case "capitalize", "format", "join", "lower", "lstrip", "replace",
+			"rstrip", "strip", "title", "upper":
+			return String
+		case "count", "find", "index", "rfind", "rindex":
+			return Int
+		case "endswith", "startswith":
+			return Bool
+		case "partition", "rpartition":
+			return Tuple
+		case "rsplit", "split", "splitlines":
+			return List
+		case "encode":
+			return Bytes
+		}
+		if strings.HasPrefix(name, "is") {
+			return Bool
+		}
+	case Bytes:
+		if name == "decode" {
+			return String
+		}
+	case List:
+		switch name {
+		case "append", "clear", "extend", "insert", "remove":
+			return None
+		case "index":
+			return Int
+		}
+	case Dict:
+		switch name {
+		case "clear", "update":
+			return None
+		case "items", "keys", "values":
+			return List
+		case "popitem":
+			return Tuple
+		}
+	case Set:
+		switch name {
+		case "difference", "intersection", "symmetric_difference", "union":
+			return Set
+		case "add", "clear", "discard", "remove", "update":
+			return None
+		}
+		if strings.HasSuffix(name, "_update") {
+			return None
+		}
+		if strings.HasPrefix(name, "is") {
+			return Bool
+		}
+	}
+	return Unknown
+}
+
+// binary returns the type of x op y.
+func binary(op syntax.Token, x, y Type) Type {
+	switch op {
+	case syntax.EQL, syntax.NEQ, syntax.LT, syntax.LE, syntax.GT, syntax.GE,
+		syntax.IN, syntax.NOT_IN:
+		return Bool
+	case syntax.AND, syntax.OR:
+		return join(x, y)
+	}
+	if x == nil || y == nil {
+		return nil // not yet inferred
+	}
+
+	numeric := func(t Type) bool { return t == Int || t == Float }
+	switch op {
+	case syntax.PLUS:
+		if x == y {
+			switch x {
+			case Int, Float, String, Bytes, List, Tuple:
+				return x
+			}
+		}
+		if numeric(x) && numeric(y) {
+			return Float
+		}
+	case syntax.MINUS, syntax.STAR, syntax.SLASHSLASH, syntax.PERCENT:
+		if x == Int && y == Int {
+			return Int
+		}
+		if numeric(x) && numeric(y) {
+			return Float
+		}
+		if op == syntax.MINUS && x == Set && y == Set {
+			return Set
+		}
+		if op == syntax.STAR {
+			for _, t := range []Type{String, Bytes, List, Tuple} {
+				if x == t && y == Int || x == Int && y == t {
+					return t
+				}
+			}
+		}
+		if op == syntax.PERCENT && (x == String || x == Bytes) {
+			return x
+		}
+	case syntax.SLASH:
+		if numeric(x) && numeric(y) {
+			return Float
+		}
+	case syntax.AMP, syntax.PIPE, syntax.CIRCUMFLEX:
+		if x == y && (x == Int || x == Set) {
+			return x
+		}
+	case syntax.LTLT, syntax.GTGT:
+		if x == Int && y == Int {
+			return Int
+		}
+	}
+	return Unknown
+}